@@ -0,0 +1,140 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/cron"
+	"github.com/shelton-hu/pi/daemon"
+	"github.com/shelton-hu/pi/kafka"
+	"github.com/shelton-hu/pi/redis"
+)
+
+// Prefix is the path prefix of the admin handler, which must be mounted at it.
+const Prefix = "/debug/"
+
+// HandlerOptions ...
+type HandlerOptions func(*HandlerOption)
+
+// HandlerOption ...
+type HandlerOption struct {
+	conf   *config.Config
+	cron   *cron.Cron
+	daemon *daemon.Daemon
+	redis  *redis.Pool
+	kafka  *kafka.Kafka
+}
+
+// applyOpts ...
+func (o *HandlerOption) applyOpts(opts ...HandlerOptions) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// SetConfig ...
+func SetConfig(conf *config.Config) HandlerOptions {
+	return func(o *HandlerOption) {
+		o.conf = conf
+	}
+}
+
+// SetCron ...
+func SetCron(cron *cron.Cron) HandlerOptions {
+	return func(o *HandlerOption) {
+		o.cron = cron
+	}
+}
+
+// SetDaemon ...
+func SetDaemon(daemon *daemon.Daemon) HandlerOptions {
+	return func(o *HandlerOption) {
+		o.daemon = daemon
+	}
+}
+
+// SetRedis ...
+func SetRedis(redis *redis.Pool) HandlerOptions {
+	return func(o *HandlerOption) {
+		o.redis = redis
+	}
+}
+
+// SetKafka ...
+func SetKafka(kafka *kafka.Kafka) HandlerOptions {
+	return func(o *HandlerOption) {
+		o.kafka = kafka
+	}
+}
+
+// NewHandler returns the admin handler which exposes the runtime state as json and
+// pprof under Prefix:
+//
+//	/debug/config   the effective system and custom config with secrets masked
+//	/debug/cron     the registered cron jobs and their next run times
+//	/debug/daemon   the restart counts of the daemon functions
+//	/debug/redis    the stats of the redis pool
+//	/debug/kafka    the running kafka subscriptions
+//	/debug/pprof/   the pprof profiles
+//
+// The endpoints of the components not set are not served.
+func NewHandler(opts ...HandlerOptions) http.Handler {
+	o := new(HandlerOption)
+	o.applyOpts(opts...)
+
+	mux := http.NewServeMux()
+	if o.conf != nil {
+		mux.HandleFunc(Prefix+"config", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"sysconf": config.MaskSecrets(o.conf.SysConf()),
+				"cusconf": config.MaskSecrets(o.conf.CusConf()),
+			})
+		})
+	}
+	if o.cron != nil {
+		mux.HandleFunc(Prefix+"cron", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, o.cron.Jobs())
+		})
+	}
+	if o.daemon != nil {
+		mux.HandleFunc(Prefix+"daemon", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, o.daemon.Stats())
+		})
+	}
+	if o.redis != nil {
+		mux.HandleFunc(Prefix+"redis", func(w http.ResponseWriter, r *http.Request) {
+			address, stats := o.redis.Stats()
+			writeJSON(w, map[string]interface{}{
+				"address":       address,
+				"active_count":  stats.ActiveCount,
+				"idle_count":    stats.IdleCount,
+				"wait_count":    stats.WaitCount,
+				"wait_duration": stats.WaitDuration.String(),
+			})
+		})
+	}
+	if o.kafka != nil {
+		mux.HandleFunc(Prefix+"kafka", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, o.kafka.Subscriptions())
+		})
+	}
+
+	mux.HandleFunc(Prefix+"pprof/", pprof.Index)
+	mux.HandleFunc(Prefix+"pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc(Prefix+"pprof/profile", pprof.Profile)
+	mux.HandleFunc(Prefix+"pprof/symbol", pprof.Symbol)
+	mux.HandleFunc(Prefix+"pprof/trace", pprof.Trace)
+	return mux
+}
+
+// writeJSON ...
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// newTestConfig returns the config loaded from the local file of data.
+func newTestConfig(t *testing.T, data string) *config.Config {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.New(context.Background(), nil, "ns", "app",
+		config.SetLocalConfig(path), config.SetEnvPrefix(""), config.SetSections(config.SectionRegistry, config.SectionRedis))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// get serves the request of the path by the handler.
+func get(handler http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestConfigMasksSecrets(t *testing.T) {
+	c := newTestConfig(t, `{
+		"sysconf": {"registry": {"name": "app"}, "redis": {"host": "127.0.0.1", "port": 6379, "password": "redis-pass"}},
+		"cusconf": {"name": "bob", "api_key": "cus-key", "db": {"password": "cus-pass"}}
+	}`)
+
+	w := get(NewHandler(SetConfig(c)), Prefix+"config")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type = %s", ct)
+	}
+	body := w.Body.String()
+	for _, secret := range []string{"redis-pass", "cus-key", "cus-pass"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config dump leaks %s: %s", secret, body)
+		}
+	}
+
+	var dump struct {
+		Sysconf config.SystemConfig    `json:"sysconf"`
+		Cusconf map[string]interface{} `json:"cusconf"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &dump); err != nil {
+		t.Fatal(err)
+	}
+	masked := config.MaskSecrets(c.SysConf()).(*config.SystemConfig)
+	if dump.Sysconf.Redis != masked.Redis || dump.Sysconf.Redis.Host != "127.0.0.1" {
+		t.Errorf("redis = %+v, want %+v", dump.Sysconf.Redis, masked.Redis)
+	}
+	if dump.Cusconf["name"] != "bob" || dump.Cusconf["api_key"] == "cus-key" {
+		t.Errorf("cusconf = %v, want the secret keys masked only", dump.Cusconf)
+	}
+
+	// the live config isn't masked by the dump.
+	if got := c.SysConf().Redis.Password; got != "redis-pass" {
+		t.Errorf("redis password after the dump = %s, want unchanged", got)
+	}
+	if got := (*c.CusConf())["api_key"]; got != "cus-key" {
+		t.Errorf("cusconf api_key after the dump = %v, want unchanged", got)
+	}
+}
+
+func TestEndpointsOfComponentsNotSet(t *testing.T) {
+	handler := NewHandler()
+	tests := []struct {
+		path string
+		want int
+	}{
+		{Prefix + "config", http.StatusNotFound},
+		{Prefix + "cron", http.StatusNotFound},
+		{Prefix + "daemon", http.StatusNotFound},
+		{Prefix + "redis", http.StatusNotFound},
+		{Prefix + "kafka", http.StatusNotFound},
+		{Prefix + "pprof/", http.StatusOK},
+		{Prefix + "pprof/cmdline", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := get(handler, tt.path); w.Code != tt.want {
+			t.Errorf("%s status code = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+const (
+	// HeaderAuthorization is the header of the bearer token of the user.
+	HeaderAuthorization = "Authorization"
+
+	// HeaderServiceToken is the header of the token of the calling service.
+	HeaderServiceToken = "X-Service-Token"
+
+	// _BearerPrefix is the prefix of the bearer token in HeaderAuthorization.
+	_BearerPrefix = "Bearer "
+)
+
+// Identity is the verified identity of the caller.
+type Identity struct {
+	// Subject is the subject of the bearer token, which is empty when the request
+	// carries only the service token.
+	Subject string
+
+	// Service is the name of the calling service, which is empty when the request
+	// carries no service token.
+	Service string
+
+	// Claims are the claims of the bearer token.
+	Claims map[string]interface{}
+
+	// token is the bearer token, which is forwarded to the services called with
+	// the identity.
+	token string
+}
+
+// String returns the subject and the service of the identity, which omits the
+// bearer token, so the identity can be logged.
+func (id Identity) String() string {
+	return fmt.Sprintf("subject=%s service=%s", id.Subject, id.Service)
+}
+
+// Verifier verifies the bearer token and returns the identity of its subject.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Identity, error)
+}
+
+// identityKey is the context key of the identity.
+type identityKey struct{}
+
+// NewContext returns the context carrying the identity.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of ctx.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// AuthenticatorOptions ...
+type AuthenticatorOptions func(*AuthenticatorOption)
+
+// AuthenticatorOption ...
+type AuthenticatorOption struct {
+	verifier Verifier
+}
+
+// SetVerifier sets the verifier of the bearer tokens, default is the jwt verifier
+// of the config.
+func SetVerifier(verifier Verifier) AuthenticatorOptions {
+	return func(o *AuthenticatorOption) {
+		o.verifier = verifier
+	}
+}
+
+// Authenticator authenticates the requests by their bearer tokens and service
+// tokens, and adds the credentials of the identity to the outgoing requests. The
+// bearer tokens are ignored without the keys or the verifier, and the service
+// tokens are ignored without the services, e.g. they're verified by another
+// service. It can be updated when the config changed.
+type Authenticator struct {
+	// state holds the *authState of the config.
+	state atomic.Value
+
+	// verifier is the verifier of the options, which is used instead of the jwt
+	// verifier of the config.
+	verifier Verifier
+}
+
+// authState is the authenticator of the config.
+type authState struct {
+	verifier Verifier
+	token    string
+	services map[string]string
+	required bool
+	public   []string
+}
+
+// New returns the authenticator of the config.
+func New(authConfig config.Auth, opts ...AuthenticatorOptions) (*Authenticator, error) {
+	o := new(AuthenticatorOption)
+	for _, opt := range opts {
+		opt(o)
+	}
+	a := &Authenticator{verifier: o.verifier}
+	if err := a.Update(authConfig); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Update replaces the config of the authenticator, which keeps unchanged when the
+// keys of the config are invalid.
+func (a *Authenticator) Update(authConfig config.Auth) error {
+	verifier := a.verifier
+	if verifier == nil && len(authConfig.Keys) > 0 {
+		var err error
+		if verifier, err = NewJWTVerifier(authConfig); err != nil {
+			return err
+		}
+	}
+
+	services := make(map[string]string, len(authConfig.Services))
+	for name, service := range authConfig.Services {
+		services[name] = service.Token
+	}
+	a.state.Store(&authState{
+		verifier: verifier,
+		token:    authConfig.Token,
+		services: services,
+		required: authConfig.Required,
+		public:   authConfig.Public,
+	})
+	return nil
+}
+
+// holder holds the default authenticator in the atomic value.
+type holder struct {
+	a *Authenticator
+}
+
+// std holds the default authenticator used by the package level functions.
+var std atomic.Value
+
+func init() {
+	a, _ := New(config.Auth{})
+	std.Store(&holder{a: a})
+}
+
+// SetDefault replaces the default authenticator used by the rpc, web and kafka
+// instrumentation.
+func SetDefault(a *Authenticator) {
+	std.Store(&holder{a: a})
+}
+
+// Default returns the default authenticator.
+func Default() *Authenticator {
+	return std.Load().(*holder).a
+}
+
+// Authenticate authenticates the headers by the default authenticator.
+func Authenticate(ctx context.Context, headers map[string]string) (*Identity, error) {
+	return Default().Authenticate(ctx, headers)
+}
+
+// Inject adds the credentials of ctx to the headers by the default authenticator.
+func Inject(ctx context.Context, headers map[string]string) {
+	Default().Inject(ctx, headers)
+}
+
+// Authenticate returns the identity of the credentials in the headers, or nil when
+// the headers carry none. The unauthenticated error is returned when a credential
+// is invalid.
+func (a *Authenticator) Authenticate(ctx context.Context, headers map[string]string) (*Identity, error) {
+	s := a.load()
+	var id *Identity
+	if authorization := header(headers, HeaderAuthorization); authorization != "" && s.verifier != nil {
+		if !strings.HasPrefix(authorization, _BearerPrefix) {
+			return nil, piErrors.Unauthenticatedf("authorization is not a bearer token")
+		}
+		token := strings.TrimSpace(strings.TrimPrefix(authorization, _BearerPrefix))
+		verified, err := s.verifier.Verify(ctx, token)
+		if err != nil {
+			return nil, piErrors.Unauthenticatedf("invalid bearer token, %s", err.Error())
+		}
+		id = verified
+		id.token = token
+	}
+
+	if token := header(headers, HeaderServiceToken); token != "" && len(s.services) > 0 {
+		service, ok := s.service(token)
+		if !ok {
+			return nil, piErrors.Unauthenticatedf("invalid service token")
+		}
+		if id == nil {
+			id = new(Identity)
+		}
+		id.Service = service
+	}
+	return id, nil
+}
+
+// Check returns the identity of the headers of the request of the endpoint like
+// Authenticate, and the unauthenticated error when the identity is required but
+// the headers carry no credentials.
+func (a *Authenticator) Check(ctx context.Context, endpoint string, headers map[string]string) (*Identity, error) {
+	id, err := a.Authenticate(ctx, headers)
+	if err != nil {
+		return nil, err
+	}
+	if id == nil && a.load().required && !a.IsPublic(endpoint) {
+		return nil, piErrors.Unauthenticatedf("credentials are required")
+	}
+	return id, nil
+}
+
+// IsPublic returns true when the rpc endpoint or the web path doesn't require
+// the credentials.
+func (a *Authenticator) IsPublic(endpoint string) bool {
+	for _, pattern := range a.load().public {
+		if ok, _ := path.Match(pattern, endpoint); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Inject replaces the credentials in the headers of the outgoing request, which
+// may be copied from the incoming request, by the bearer token of the identity of
+// ctx and the token of the service.
+func (a *Authenticator) Inject(ctx context.Context, headers map[string]string) {
+	if id, ok := FromContext(ctx); ok && id.token != "" {
+		deleteHeader(headers, HeaderAuthorization)
+		headers[HeaderAuthorization] = _BearerPrefix + id.token
+	}
+	deleteHeader(headers, HeaderServiceToken)
+	if token := a.load().token; token != "" {
+		headers[HeaderServiceToken] = token
+	}
+}
+
+// load ...
+func (a *Authenticator) load() *authState {
+	return a.state.Load().(*authState)
+}
+
+// service returns the name of the service of the token.
+func (s *authState) service(token string) (string, bool) {
+	for name, serviceToken := range s.services {
+		if subtle.ConstantTimeCompare([]byte(serviceToken), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// header returns the value of the header, whose key is case insensitive.
+func header(headers map[string]string, key string) string {
+	if value, ok := headers[key]; ok {
+		return value
+	}
+	for k, value := range headers {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// deleteHeader deletes the header, whose key is case insensitive.
+func deleteHeader(headers map[string]string, key string) {
+	for k := range headers {
+		if strings.EqualFold(k, key) {
+			delete(headers, k)
+		}
+	}
+}
+
+// httpHeaders returns the first values of the http headers.
+func httpHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for k, values := range h {
+		if len(values) > 0 {
+			headers[k] = values[0]
+		}
+	}
+	return headers
+}
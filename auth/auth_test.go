@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+func TestAuthenticatorUpdate(t *testing.T) {
+	a, err := New(config.Auth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func() error {
+		_, err := a.Check(context.Background(), "svc.User.Get", map[string]string{})
+		return err
+	}
+	if err := check(); err != nil {
+		t.Fatalf("Check() = %v, want permitted", err)
+	}
+
+	if err := a.Update(config.Auth{Required: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := check(); piErrors.CodeOf(err) != piErrors.Unauthenticated {
+		t.Errorf("Check() after update = %v, want unauthenticated", err)
+	}
+
+	// the authenticator keeps unchanged when the keys are invalid.
+	invalid := config.Auth{Keys: map[string]config.AuthKey{"k": {Algorithm: "none"}}}
+	if err := a.Update(invalid); err == nil {
+		t.Error("Update() error = nil, want the invalid keys")
+	}
+	if err := check(); piErrors.CodeOf(err) != piErrors.Unauthenticated {
+		t.Errorf("Check() after invalid update = %v, want unauthenticated", err)
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+// GinMiddleware returns the gin middleware which authenticates the requests by the
+// default authenticator, see (*Authenticator).GinMiddleware.
+func GinMiddleware() gin.HandlerFunc {
+	return ginMiddleware(Default)
+}
+
+// GinMiddleware returns the gin middleware which authenticates the requests by the
+// authenticator like the rpc handler wrapper, the identity is stored in the context
+// of the request, and the rejected requests are responded by the json unauthenticated
+// error.
+func (a *Authenticator) GinMiddleware() gin.HandlerFunc {
+	return ginMiddleware(func() *Authenticator { return a })
+}
+
+// ginMiddleware ...
+func ginMiddleware(authenticator func() *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id, err := authenticator().Check(ctx, c.Request.URL.Path, httpHeaders(c.Request.Header))
+		if err != nil {
+			_ = c.Error(err)
+			piErrors.WriteHTTP(c.Writer, err)
+			c.Abort()
+			return
+		}
+		if id != nil {
+			c.Request = c.Request.WithContext(NewContext(ctx, id))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// jwtKey is the key verifying the jwt.
+type jwtKey struct {
+	algorithm string
+	key       interface{}
+}
+
+// jwtVerifier verifies the jwt by the locally configured keys.
+type jwtVerifier struct {
+	keys     map[string]jwtKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+	parser   *jwt.Parser
+}
+
+// NewJWTVerifier returns the verifier of the jwt signed by the keys of the config,
+// whose subject is the subject of the identity.
+func NewJWTVerifier(authConfig config.Auth) (Verifier, error) {
+	v := &jwtVerifier{
+		keys:     make(map[string]jwtKey, len(authConfig.Keys)),
+		issuer:   authConfig.Issuer,
+		audience: authConfig.Audience,
+		leeway:   time.Duration(authConfig.Leeway) * time.Second,
+		// the time based claims are checked with the leeway by verifyClaims.
+		parser: &jwt.Parser{SkipClaimsValidation: true},
+	}
+	for kid, k := range authConfig.Keys {
+		key, err := parseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %s", kid, err)
+		}
+		v.keys[kid] = jwtKey{algorithm: k.Algorithm, key: key}
+	}
+	return v, nil
+}
+
+// Verify ...
+func (v *jwtVerifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, ok := v.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		// the algorithm of the key is required, so the hmac secret can't verify
+		// the jwt signed by the public key.
+		if t.Method.Alg() != k.algorithm {
+			return nil, fmt.Errorf("unexpected algorithm %s of key %q", t.Method.Alg(), kid)
+		}
+		return k.key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := v.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &Identity{
+		Subject: subject,
+		Claims:  claims,
+	}, nil
+}
+
+// verifyClaims ...
+func (v *jwtVerifier) verifyClaims(claims jwt.MapClaims) error {
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-v.leeway).Unix(), false) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(v.leeway).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return errors.New("unexpected issuer")
+	}
+	if v.audience != "" && !claims.VerifyAudience(v.audience, true) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+// parseKey returns the verifying key of the algorithm.
+func parseKey(k config.AuthKey) (interface{}, error) {
+	switch k.Algorithm {
+	case config.AuthAlgorithmHS256, config.AuthAlgorithmHS384, config.AuthAlgorithmHS512:
+		return []byte(k.Secret), nil
+	case config.AuthAlgorithmRS256, config.AuthAlgorithmRS384, config.AuthAlgorithmRS512:
+		return jwt.ParseRSAPublicKeyFromPEM([]byte(k.PublicKey))
+	case config.AuthAlgorithmES256, config.AuthAlgorithmES384, config.AuthAlgorithmES512:
+		return jwt.ParseECPublicKeyFromPEM([]byte(k.PublicKey))
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", k.Algorithm)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	verifier, err := NewJWTVerifier(config.Auth{
+		Keys: map[string]config.AuthKey{
+			"":   {Algorithm: config.AuthAlgorithmHS256, Secret: "default"},
+			"hs": {Algorithm: config.AuthAlgorithmHS256, Secret: "secret"},
+			"rs": {Algorithm: config.AuthAlgorithmRS256, PublicKey: publicKey},
+		},
+		Issuer:   "issuer",
+		Audience: "audience",
+		Leeway:   60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "user", "iss": "issuer", "aud": "audience", "exp": now.Add(time.Hour).Unix()}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, c jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "hmac", token: sign(jwt.SigningMethodHS256, "hs", []byte("secret"), claims(nil))},
+		{name: "rsa", token: sign(jwt.SigningMethodRS256, "rs", rsaKey, claims(nil))},
+		{name: "without kid", token: sign(jwt.SigningMethodHS256, "", []byte("default"), claims(nil))},
+		{name: "unknown kid", token: sign(jwt.SigningMethodHS256, "other", []byte("secret"), claims(nil)), wantErr: "unknown key"},
+		{name: "wrong secret", token: sign(jwt.SigningMethodHS256, "hs", []byte("other"), claims(nil)), wantErr: "signature is invalid"},
+		{
+			name:    "public key as hmac secret",
+			token:   sign(jwt.SigningMethodHS256, "rs", []byte(publicKey), claims(nil)),
+			wantErr: "unexpected algorithm HS256",
+		},
+		{
+			name:    "other algorithm of the key",
+			token:   sign(jwt.SigningMethodHS512, "hs", []byte("secret"), claims(nil)),
+			wantErr: "unexpected algorithm HS512",
+		},
+		{
+			name:    "none algorithm",
+			token:   sign(jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+			wantErr: "unexpected algorithm none",
+		},
+		{name: "expired within leeway", token: sign(jwt.SigningMethodHS256, "hs", []byte("secret"), claims(jwt.MapClaims{"exp": now.Add(-30 * time.Second).Unix()}))},
+		{
+			name:    "expired",
+			token:   sign(jwt.SigningMethodHS256, "hs", []byte("secret"), claims(jwt.MapClaims{"exp": now.Add(-2 * time.Minute).Unix()})),
+			wantErr: "token is expired",
+		},
+		{
+			name:    "not valid yet",
+			token:   sign(jwt.SigningMethodHS256, "hs", []byte("secret"), claims(jwt.MapClaims{"nbf": now.Add(2 * time.Minute).Unix()})),
+			wantErr: "token is not valid yet",
+		},
+		{
+			name:    "unexpected issuer",
+			token:   sign(jwt.SigningMethodHS256, "hs", []byte("secret"), claims(jwt.MapClaims{"iss": "other"})),
+			wantErr: "unexpected issuer",
+		},
+		{
+			name:    "unexpected audience",
+			token:   sign(jwt.SigningMethodHS256, "hs", []byte("secret"), claims(jwt.MapClaims{"aud": "other"})),
+			wantErr: "unexpected audience",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if id.Subject != "user" {
+				t.Errorf("subject = %s, want user", id.Subject)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifierRejectsUnsupportedAlgorithm(t *testing.T) {
+	_, err := NewJWTVerifier(config.Auth{
+		Keys: map[string]config.AuthKey{"k": {Algorithm: "none"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported algorithm") {
+		t.Errorf("NewJWTVerifier() error = %v, want unsupported algorithm", err)
+	}
+}
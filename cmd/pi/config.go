@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/ghodss/yaml"
+	"github.com/micro/cli/v2"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+const (
+	_SysConf = "sysconf"
+	_CusConf = "cusconf"
+
+	// _EtcdTimeout is the timeout of every etcd request.
+	_EtcdTimeout = 5 * time.Second
+)
+
+// errKeyNotFound is returned by getValue when the key doesn't exist.
+var errKeyNotFound = errors.New("is not found")
+
+// keyFlags are the flags which decide the etcd key of the config.
+var keyFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "etcdAddrs",
+		Value:   "127.0.0.1:2379",
+		Usage:   "etcd addresses separated by comma",
+		EnvVars: []string{"PI_ETCD_ADDRS"},
+	},
+	&cli.StringFlag{
+		Name:     "namespace",
+		Usage:    "namespace of the app",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:     "app",
+		Usage:    "name of the app, or " + config.SharedAppName + " for the shared layer of the namespace",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:  "conf",
+		Value: _SysConf,
+		Usage: "sysconf or cusconf",
+	},
+}
+
+// fileFlag is the local json or yaml file of the config value.
+var fileFlag = &cli.StringFlag{
+	Name:     "file",
+	Usage:    "local json or yaml file of the config value",
+	Required: true,
+}
+
+// sectionsFlag is the sections of the sysconf to validate.
+var sectionsFlag = &cli.StringFlag{
+	Name:  "sections",
+	Usage: "sections of the sysconf to validate separated by comma, e.g. the sections of the components the app uses, default is all",
+}
+
+// configCommand ...
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "manage the sysconf and cusconf of an app in etcd",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "get",
+				Usage:  "print the config",
+				Flags:  keyFlags,
+				Action: getConfig,
+			},
+			{
+				Name:  "put",
+				Usage: "put the config from the local file, the sysconf is validated before put after merged with the layers which the apps load",
+				Flags: append([]cli.Flag{fileFlag, sectionsFlag, &cli.BoolFlag{
+					Name:  "force",
+					Usage: "put the sysconf even if it's invalid",
+				}}, keyFlags...),
+				Action: putConfig,
+			},
+			{
+				Name:   "diff",
+				Usage:  "diff the config against the local file",
+				Flags:  append([]cli.Flag{fileFlag}, keyFlags...),
+				Action: diffConfig,
+			},
+			{
+				Name:  "validate",
+				Usage: "validate the local sysconf file against the system config schema",
+				Flags: []cli.Flag{fileFlag, sectionsFlag},
+				Action: func(c *cli.Context) error {
+					data, err := readFile(c.String("file"))
+					if err != nil {
+						return err
+					}
+					if _, err := config.ParseSysConf(data, sections(c)...); err != nil {
+						return err
+					}
+					fmt.Println("ok")
+					return nil
+				},
+			},
+			{
+				Name:  "history",
+				Usage: "print the revisions of the config, the compacted ones are lost",
+				Flags: append([]cli.Flag{&cli.IntFlag{
+					Name:  "limit",
+					Value: 10,
+					Usage: "max number of the revisions",
+				}}, keyFlags...),
+				Action: configHistory,
+			},
+		},
+	}
+}
+
+// getConfig ...
+func getConfig(c *cli.Context) error {
+	client, key, err := newClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	value, rev, err := getValue(client, key, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# %s, revision %d\n%s\n", key, rev, indent(value))
+	return nil
+}
+
+// putConfig ...
+func putConfig(c *cli.Context) error {
+	data, err := readFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	client, key, err := newClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if c.String("conf") == _SysConf && !c.Bool("force") {
+		if err := validateLayer(client, c.String("namespace"), c.String("app"), sections(c), data); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), _EtcdTimeout)
+	defer cancel()
+	rsp, err := client.Put(ctx, key, string(data))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("put %s, revision %d\n", key, rsp.Header.Revision)
+	return nil
+}
+
+// validateLayer validates the sysconf layer merged with the other layers which the
+// apps load. The layer of an app is merged over the shared layer of the namespace,
+// and the shared layer is merged under every app layer of the namespace, which is
+// only decoded when there is no app layer.
+func validateLayer(kv clientv3.KV, namespace, app string, sections []string, data []byte) error {
+	if _, err := config.ParseSysConfLayer(data); err != nil {
+		return err
+	}
+
+	if app != config.SharedAppName {
+		shared, err := getLayer(kv, config.SysConfKey(namespace, config.SharedAppName))
+		if err != nil {
+			return err
+		}
+		return parseMerged(shared, data, sections)
+	}
+
+	apps, err := appLayers(kv, namespace)
+	if err != nil {
+		return err
+	}
+	var msgs []string
+	for _, name := range sortedKeys(apps) {
+		if err := parseMerged(data, apps[name], sections); err != nil {
+			msgs = append(msgs, fmt.Sprintf("app %s: %s", name, err.Error()))
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+// parseMerged parses the sysconf merged by the shared layer and the app layer.
+func parseMerged(shared, app []byte, sections []string) error {
+	merged, err := config.MergeLayers(shared, app)
+	if err != nil {
+		return err
+	}
+	_, err = config.ParseSysConf(merged, sections...)
+	return err
+}
+
+// getLayer returns the value of the key, or the empty config when it's absent.
+func getLayer(kv clientv3.KV, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), _EtcdTimeout)
+	defer cancel()
+
+	rsp, err := kv.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return []byte("{}"), nil
+	}
+	return rsp.Kvs[0].Value, nil
+}
+
+// appLayers returns the sysconf layers of the apps of the namespace by app name.
+func appLayers(kv clientv3.KV, namespace string) (map[string][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), _EtcdTimeout)
+	defer cancel()
+
+	// the keys of the namespace are <prefix><app>/sysconf, the keys of the other
+	// conf paths and of the nested app names are skipped.
+	emptyKey := config.SysConfKey(namespace, "")
+	suffix := "/" + path.Base(emptyKey)
+	prefix := strings.TrimSuffix(emptyKey, suffix)
+	rsp, err := kv.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	apps := make(map[string][]byte)
+	for _, kv := range rsp.Kvs {
+		name := strings.TrimSuffix(strings.TrimPrefix(string(kv.Key), prefix), suffix)
+		if name == "" || name == config.SharedAppName || strings.Contains(name, "/") || string(kv.Key) != config.SysConfKey(namespace, name) {
+			continue
+		}
+		apps[name] = kv.Value
+	}
+	return apps, nil
+}
+
+// sections returns the sections of the sysconf to validate.
+func sections(c *cli.Context) []string {
+	if c.String("sections") == "" {
+		return nil
+	}
+	return strings.Split(c.String("sections"), ",")
+}
+
+// sortedKeys ...
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffConfig ...
+func diffConfig(c *cli.Context) error {
+	data, err := readFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+
+	client, key, err := newClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// the missing key is diffed as empty, so all the lines of the file are added.
+	value, _, err := getValue(client, key, 0)
+	if err != nil && !errors.Is(err, errKeyNotFound) {
+		return err
+	}
+	lines := diffValues(value, data)
+	if len(lines) == 0 {
+		fmt.Println("no difference")
+		return nil
+	}
+	fmt.Printf("--- %s\n+++ %s\n", key, c.String("file"))
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// configHistory ...
+func configHistory(c *cli.Context) error {
+	client, key, err := newClient(c)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var rev int64
+	for i := 0; i < c.Int("limit"); i++ {
+		value, modRev, err := getValue(client, key, rev)
+		if err != nil {
+			if i > 0 {
+				// the earlier revisions are compacted or the key was created.
+				return nil
+			}
+			return err
+		}
+		fmt.Printf("# %s, revision %d\n%s\n\n", key, modRev, indent(value))
+		rev = modRev - 1
+	}
+	return nil
+}
+
+// newClient returns the etcd client and the config key.
+func newClient(c *cli.Context) (*clientv3.Client, string, error) {
+	var key string
+	switch c.String("conf") {
+	case _SysConf:
+		key = config.SysConfKey(c.String("namespace"), c.String("app"))
+	case _CusConf:
+		key = config.CusConfKey(c.String("namespace"), c.String("app"))
+	default:
+		return nil, "", fmt.Errorf("invalid conf %s, it must be %s or %s", c.String("conf"), _SysConf, _CusConf)
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(c.String("etcdAddrs"), ","),
+		DialTimeout: _EtcdTimeout,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return client, key, nil
+}
+
+// getValue returns the value of the key at the revision and its modified revision,
+// the latest value is returned when rev is 0.
+func getValue(client *clientv3.Client, key string, rev int64) ([]byte, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), _EtcdTimeout)
+	defer cancel()
+
+	var opts []clientv3.OpOption
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+	rsp, err := client.Get(ctx, key, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return nil, 0, fmt.Errorf("%s %w", key, errKeyNotFound)
+	}
+	return rsp.Kvs[0].Value, rsp.Kvs[0].ModRevision, nil
+}
+
+// readFile reads the json or yaml file, and returns the json data.
+func readFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		return yaml.YAMLToJSON(data)
+	}
+	if !json.Valid(data) {
+		return nil, errors.New(path + " is not a valid json")
+	}
+	return data, nil
+}
+
+// indent returns the json with sorted keys and indent, or the data itself when
+// it's not a valid json.
+func indent(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return string(data)
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// diffValues returns the diff lines of the indented old and new config, the empty
+// old config has no lines.
+func diffValues(old, new []byte) []string {
+	var a []string
+	if len(old) > 0 {
+		a = strings.Split(indent(old), "\n")
+	}
+	return diffLines(a, strings.Split(indent(new), "\n"))
+}
+
+// diffLines returns the lines of a and b prefixed by "-" or "+" when they are
+// removed or added, and by " " when they are common, it's empty when a equals b.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	changed := false
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			// the removed lines come before the added ones.
+			lines = append(lines, "-"+a[i])
+			changed = true
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			changed = true
+			j++
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return lines
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// fakeKV serves Get from the map.
+type fakeKV struct {
+	clientv3.KV
+	kvs map[string]string
+}
+
+// Get ...
+func (f *fakeKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	op := clientv3.OpGet(key, opts...)
+	var keys []string
+	for k := range f.kvs {
+		if k == key || (op.RangeBytes() != nil && bytes.Compare([]byte(k), op.KeyBytes()) >= 0 && bytes.Compare([]byte(k), op.RangeBytes()) < 0) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	rsp := new(clientv3.GetResponse)
+	for _, k := range keys {
+		rsp.Kvs = append(rsp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(f.kvs[k])})
+	}
+	return rsp, nil
+}
+
+func TestValidateLayer(t *testing.T) {
+	const (
+		registry = `{"registry":{"name":"app"}}`
+		redis    = `{"redis":{"host":"127.0.0.1","port":6379}}`
+	)
+	sections := []string{config.SectionRegistry, config.SectionRedis}
+	tests := []struct {
+		name    string
+		kvs     map[string]string
+		app     string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "app layer over shared layer",
+			kvs:  map[string]string{config.SysConfKey("ns", config.SharedAppName): redis},
+			app:  "a",
+			data: registry,
+		},
+		{
+			name:    "app layer without shared layer",
+			kvs:     map[string]string{},
+			app:     "a",
+			data:    registry,
+			wantErr: "redis.host: is required",
+		},
+		{
+			name:    "unknown field",
+			kvs:     map[string]string{config.SysConfKey("ns", config.SharedAppName): redis},
+			app:     "a",
+			data:    `{"registry":{"name":"app","nmae":"app"}}`,
+			wantErr: "unknown field",
+		},
+		{
+			name: "shared layer under app layers",
+			kvs: map[string]string{
+				config.SysConfKey("ns", "a"):       registry,
+				config.SysConfKey("ns", "b"):       `{"registry":{}}`,
+				config.CusConfKey("ns", "c"):       `{}`,
+				config.SysConfKey("other", "d"):    `{"registry":{}}`,
+				config.SysConfKey("ns", "e/f"):     `{"registry":{}}`,
+				config.SysConfKey("ns", "_shared"): `{}`,
+			},
+			app:     config.SharedAppName,
+			data:    redis,
+			wantErr: "app b: invalid config: registry.name: is required",
+		},
+		{
+			name: "shared layer without app layers",
+			kvs:  map[string]string{},
+			app:  config.SharedAppName,
+			data: redis,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLayer(&fakeKV{kvs: tt.kvs}, "ns", tt.app, sections, []byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateLayer = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateLayer = %v, want %q", err, tt.wantErr)
+			}
+			for _, app := range []string{"app d", "app e/f", "app _shared"} {
+				if err != nil && strings.Contains(err.Error(), app) {
+					t.Errorf("validateLayer = %v, want %s ignored", err, app)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "equal", a: "a b c", b: "a b c", want: ""},
+		{name: "both empty", a: "", b: "", want: ""},
+		{name: "added", a: "", b: "a b", want: "+a +b"},
+		{name: "removed", a: "a b", b: "", want: "-a -b"},
+		{name: "changed", a: "a b c", b: "a x c", want: " a -b +x  c"},
+		{name: "inserted", a: "a c", b: "a b c", want: " a +b  c"},
+		{name: "moved", a: "a b c", b: "b c a", want: "-a  b  c +a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(diffLines(strings.Fields(tt.a), strings.Fields(tt.b)), " ")
+			if got != tt.want {
+				t.Errorf("diffLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []string
+	}{
+		{name: "missing key", old: "", new: `{"a":1,"b":2}`, want: []string{"+{", `+  "a": 1,`, `+  "b": 2`, "+}"}},
+		{name: "equal", old: `{"a":1}`, new: `{ "a": 1 }`},
+		{name: "changed", old: `{"a":1}`, new: `{"a":2}`, want: []string{" {", `-  "a": 1`, `+  "a": 2`, " }"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffValues([]byte(tt.old), []byte(tt.new)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Command pi is the tool for the apps built by github.com/shelton-hu/pi.
+//
+// The config command manages the system and custom config of an app in etcd, e.g.
+//
+//	pi config get --namespace ns --app app
+//	pi config put --namespace ns --app app --file sysconf.yaml
+//	pi config diff --namespace ns --app app --file sysconf.yaml
+//	pi config validate --file sysconf.yaml
+//	pi config history --namespace ns --app app --conf cusconf
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/micro/cli/v2"
+)
+
+func main() {
+	app := &cli.App{
+		Name:  "pi",
+		Usage: "the tool for the apps built by github.com/shelton-hu/pi",
+		Commands: []*cli.Command{
+			configCommand(),
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
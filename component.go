@@ -0,0 +1,77 @@
+package pi
+
+import (
+	"github.com/shelton-hu/pi/config"
+)
+
+// Component is the infrastructure or service which the pi initializes.
+type Component string
+
+const (
+	Tracing    Component = "tracing"
+	MySQL      Component = "mysql"
+	Redis      Component = "redis"
+	Kafka      Component = "kafka"
+	RpcService Component = "rpc_service"
+	WebService Component = "web_service"
+
+	// Jaeger is the tracing component before the tracing backend is configurable.
+	//
+	// Deprecated: use Tracing.
+	Jaeger = Tracing
+)
+
+// AllComponents are the components initialized by default.
+var AllComponents = []Component{Tracing, MySQL, Redis, Kafka, RpcService, WebService}
+
+// componentSections are the system config sections which the components depend on.
+var componentSections = map[Component][]string{
+	Tracing:    {config.SectionTracing, config.SectionJaeger},
+	MySQL:      {config.SectionMysql},
+	Redis:      {config.SectionRedis},
+	Kafka:      {config.SectionKafka},
+	RpcService: {config.SectionRegistry, config.SectionClient, config.SectionRateLimit, config.SectionAuth},
+	WebService: {config.SectionRegistry, config.SectionAuth, config.SectionWeb},
+}
+
+// SetComponents sets the components which the pi initializes, default is all of them.
+// Only the config sections of the components are validated, and the components not
+// set are neither connected nor available from the pi, e.g. a cron-only worker:
+//
+//	pi.New(ctx, pi.SetComponents(pi.MySQL, pi.Redis))
+func SetComponents(components ...Component) options {
+	return func(o *Option) {
+		o.components = components
+	}
+}
+
+// sections returns the system config sections which the components depend on, the
+// cron, delay queue and redaction sections are always included.
+func sections(components map[Component]bool) []string {
+	sections := []string{config.SectionCron, config.SectionDelayQueue, config.SectionRedaction}
+	seen := make(map[string]bool)
+	for _, c := range AllComponents {
+		if !components[c] {
+			continue
+		}
+		for _, section := range componentSections[c] {
+			if !seen[section] {
+				seen[section] = true
+				sections = append(sections, section)
+			}
+		}
+	}
+	return sections
+}
+
+// Enabled returns true when the component is initialized by the pi.
+func (p *Pi) Enabled(c Component) bool {
+	return p.components[c]
+}
+
+// mustEnabled panics when the component is not initialized by the pi.
+func (p *Pi) mustEnabled(c Component) {
+	if !p.components[c] {
+		panic("github.com/shelton-hu/pi: " + string(c) + " is not enabled by SetComponents")
+	}
+}
@@ -0,0 +1,105 @@
+package pi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+func TestSections(t *testing.T) {
+	always := []string{config.SectionCron, config.SectionDelayQueue, config.SectionRedaction}
+	tests := []struct {
+		name       string
+		components []Component
+		want       []string
+	}{
+		{name: "none", want: always},
+		{name: "redis", components: []Component{Redis}, want: append(always, config.SectionRedis)},
+		{name: "in the order of all components", components: []Component{Redis, Tracing, MySQL},
+			want: append(always, config.SectionTracing, config.SectionJaeger, config.SectionMysql, config.SectionRedis)},
+		{name: "shared sections once", components: []Component{RpcService, WebService},
+			want: append(always, config.SectionRegistry, config.SectionClient, config.SectionRateLimit, config.SectionAuth, config.SectionWeb)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			components := make(map[Component]bool)
+			for _, c := range tt.components {
+				components[c] = true
+			}
+			if got := sections(components); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewValidatesEnabledSections(t *testing.T) {
+	// the sections of mysql, i.e. database, and redis are invalid.
+	invalid := `, "database": {}, "redis": {"host": "127.0.0.1", "port": 6379, "max_idle": -1}`
+	tests := []struct {
+		name       string
+		components []Component
+		wantErr    string
+	}{
+		{name: "disabled", components: []Component{Tracing}},
+		{name: "mysql", components: []Component{Tracing, MySQL}, wantErr: "database.default"},
+		{name: "redis", components: []Component{Tracing, Redis}, wantErr: "redis.max_idle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(context.Background(), testOptions(t, "a", invalid, SetComponents(tt.components...))...)
+			if err == nil {
+				p.Close()
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("New() error = %v, want the disabled sections not validated", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want the validation error of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMustEnabled(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPi(ctx, t, "a", "")
+	tests := []struct {
+		component Component
+		call      func()
+	}{
+		{MySQL, func() { p.Mysql(ctx) }},
+		{Redis, func() { p.Redis(ctx) }},
+		{Kafka, func() { p.Kafka(ctx) }},
+		{Kafka, func() { p.RegisterSubscriber("topic", nil) }},
+		{RpcService, func() { p.MicroRpcService(ctx) }},
+		{WebService, func() { p.MicroWebService(ctx) }},
+		{WebService, func() { p.Gin() }},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.component), func(t *testing.T) {
+			if p.Enabled(tt.component) {
+				t.Fatalf("%s is enabled", tt.component)
+			}
+			defer func() {
+				r := recover()
+				if !strings.Contains(fmt.Sprint(r), string(tt.component)+" is not enabled") {
+					t.Errorf("panic = %v, want %s not enabled", r, tt.component)
+				}
+			}()
+			tt.call()
+		})
+	}
+
+	// the enabled component doesn't panic.
+	if !p.Enabled(Tracing) || p.Tracer() == nil {
+		t.Error("tracer of the enabled tracing is nil")
+	}
+}
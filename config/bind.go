@@ -0,0 +1,256 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/shelton-hu/logger"
+
+	"github.com/shelton-hu/pi/validate"
+)
+
+// durationType ...
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Bind decodes the value at the dotted path of the default custom config into out,
+// see (*Config).Bind.
+func Bind(path string, out interface{}) (*Binding, error) {
+	return Default().Bind(path, out)
+}
+
+// Binding is the value at the dotted path of the custom config bound by Bind,
+// which is decoded again whenever the value changed.
+type Binding struct {
+	// value holds the pointer of the latest decoded value.
+	value atomic.Value
+
+	// unsubscribe stops decoding the changed value.
+	unsubscribe func()
+}
+
+// Load returns the pointer of the latest decoded value, whose type is the type of
+// out of Bind, e.g. *Feature for Bind("feature", &feature). The value is replaced
+// rather than modified when the config changes, so it must not be modified.
+func (b *Binding) Load() interface{} {
+	return b.value.Load()
+}
+
+// Close stops decoding the changed value, and Load keeps returning the last one.
+func (b *Binding) Close() {
+	b.unsubscribe()
+}
+
+// Bind decodes the value at the dotted path of the custom config into out, which
+// must be a pointer. The `default` tag of a struct field is used when the value
+// doesn't contain the field, the `validate` tags are checked by go-playground/validator,
+// and a time.Duration field accepts the duration string or the number of seconds.
+//
+// out is only decoded by Bind itself. The value is decoded again into a new one in
+// the config watching goroutine whenever it changed, which is returned by Load of
+// the binding, and the last one is kept when the new value is invalid, e.g.
+//
+//	b, err := config.Bind("feature", new(Feature))
+//	...
+//	feature := b.Load().(*Feature)
+func (c *Config) Bind(path string, out interface{}) (*Binding, error) {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, errors.New("bind custom config: out must be a non-nil pointer")
+	}
+	newOut, err := bind(c.CusConf(), path, rv.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	rv.Elem().Set(newOut.Elem())
+
+	b := new(Binding)
+	b.value.Store(newOut.Interface())
+	b.unsubscribe = c.subscribe(SectionCusConf, func(old, new interface{}) {
+		oldConf, newConf := old.(CustomConfig), new.(CustomConfig)
+		oldVal, _ := oldConf.Get(path)
+		newVal, _ := newConf.Get(path)
+		if reflect.DeepEqual(oldVal, newVal) {
+			return
+		}
+		newOut, err := bind(&newConf, path, rv.Type().Elem())
+		if err != nil {
+			logger.Error(context.Background(), "bind custom config %s error: %s", path, err.Error())
+			return
+		}
+		b.value.Store(newOut.Interface())
+	})
+	return b, nil
+}
+
+// bind returns the pointer of the new value of the type decoded from the value
+// at the path of the config.
+func bind(conf *CustomConfig, path string, typ reflect.Type) (reflect.Value, error) {
+	// copy the value, which is shared by the config snapshot.
+	raw, _ := conf.Get(path)
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	raw = nil
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return reflect.Value{}, err
+	}
+	if raw, err = normalize(typ, raw); err != nil {
+		return reflect.Value{}, err
+	}
+	if data, err = json.Marshal(raw); err != nil {
+		return reflect.Value{}, err
+	}
+	newOut := reflect.New(typ)
+	if err := json.Unmarshal(data, newOut.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	if err := validateStruct(path, newOut.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return newOut, nil
+}
+
+// normalize fills the default values into the raw value and converts its durations
+// by the type which it will be decoded into.
+func normalize(typ reflect.Type, raw interface{}) (interface{}, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch {
+	case typ == durationType:
+		if raw == nil {
+			return nil, nil
+		}
+		d, ok := toDuration(raw)
+		if !ok {
+			return nil, errors.New("invalid duration: " + toString(raw))
+		}
+		return int64(d), nil
+	case typ.Kind() == reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			if raw != nil {
+				// let the json decoder report the type error.
+				return raw, nil
+			}
+			m = make(map[string]interface{})
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := jsonName(field)
+			if name == "-" {
+				continue
+			}
+			if field.Anonymous && name == field.Name && field.Type.Kind() == reflect.Struct {
+				// the fields of the embedded struct are in the same object.
+				if _, err := normalize(field.Type, m); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			v, ok := m[name]
+			if !ok {
+				if def, hasDef := field.Tag.Lookup("default"); hasDef {
+					v, ok = parseDefault(field.Type, def), true
+				} else if field.Type.Kind() == reflect.Struct {
+					v = make(map[string]interface{})
+				}
+			}
+			nv, err := normalize(field.Type, v)
+			if err != nil {
+				return nil, errors.New(name + ": " + err.Error())
+			}
+			if ok || !isEmptyMap(nv) {
+				m[name] = nv
+			}
+		}
+		return m, nil
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array:
+		vs, ok := raw.([]interface{})
+		if !ok {
+			return raw, nil
+		}
+		for i, v := range vs {
+			nv, err := normalize(typ.Elem(), v)
+			if err != nil {
+				return nil, err
+			}
+			vs[i] = nv
+		}
+		return vs, nil
+	case typ.Kind() == reflect.Map:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return raw, nil
+		}
+		for k, v := range m {
+			nv, err := normalize(typ.Elem(), v)
+			if err != nil {
+				return nil, errors.New(k + ": " + err.Error())
+			}
+			m[k] = nv
+		}
+		return m, nil
+	}
+	return raw, nil
+}
+
+// parseDefault parses the `default` tag by the field type, it's decoded as json
+// unless the field is a string or a duration.
+func parseDefault(typ reflect.Type, def string) interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.String || typ == durationType {
+		return def
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(def), &v); err != nil {
+		return def
+	}
+	return v
+}
+
+// jsonName returns the json name of the struct field.
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// isEmptyMap ...
+func isEmptyMap(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	return ok && len(m) == 0
+}
+
+// validateStruct validates v by the `validate` tags, and returns a *ValidationError
+// whose fields are the json paths prefixed by path.
+func validateStruct(path string, v interface{}) error {
+	violations, err := validate.Struct(v)
+	if err != nil {
+		return err
+	}
+
+	verr := new(ValidationError)
+	for _, violation := range violations {
+		field := violation.Field
+		if path != "" {
+			field = path + "." + field
+		}
+		verr.add(field, "failed on the %s tag", violation.Tag)
+	}
+	return verr.err()
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testFeature struct {
+	Enabled bool          `json:"enabled"`
+	Max     int           `json:"max" default:"10" validate:"min=1"`
+	Timeout time.Duration `json:"timeout" default:"1s"`
+	Limits  struct {
+		Burst int `json:"burst" default:"5"`
+	} `json:"limits"`
+}
+
+// setCusConf replaces the custom config of c, and notifies the change.
+func setCusConf(c *Config, conf CustomConfig) {
+	old := c.CusConf()
+	c.cusconf.Store(&conf)
+	c.notifyCusConf(context.Background(), old, &conf)
+}
+
+func TestBind(t *testing.T) {
+	c := newConfig()
+	setCusConf(c, CustomConfig{"feature": map[string]interface{}{"enabled": true, "timeout": "2m"}})
+
+	var feature testFeature
+	b, err := c.Bind("feature", &feature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !feature.Enabled || feature.Max != 10 || feature.Timeout != 2*time.Minute || feature.Limits.Burst != 5 {
+		t.Errorf("Bind = %+v, want the value with the defaults", feature)
+	}
+	if got := b.Load().(*testFeature); *got != feature {
+		t.Errorf("Load = %+v, want %+v", *got, feature)
+	}
+
+	setCusConf(c, CustomConfig{"feature": map[string]interface{}{"max": 20, "timeout": 3}})
+	got := b.Load().(*testFeature)
+	if got.Enabled || got.Max != 20 || got.Timeout != 3*time.Second {
+		t.Errorf("Load after changed = %+v", *got)
+	}
+	if !feature.Enabled || feature.Max != 10 {
+		t.Errorf("out is modified after changed: %+v", feature)
+	}
+
+	// the invalid value is ignored.
+	setCusConf(c, CustomConfig{"feature": map[string]interface{}{"max": 0}})
+	if got := b.Load().(*testFeature); got.Max != 20 {
+		t.Errorf("Load after the invalid change = %+v, want the last valid value", *got)
+	}
+
+	b.Close()
+	setCusConf(c, CustomConfig{"feature": map[string]interface{}{"max": 30}})
+	if got := b.Load().(*testFeature); got.Max != 20 {
+		t.Errorf("Load after Close = %+v, want the last value before Close", *got)
+	}
+	if n := len(c.listeners[SectionCusConf]); n != 0 {
+		t.Errorf("%d listeners after Close, want 0", n)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	c := newConfig()
+	setCusConf(c, CustomConfig{"feature": map[string]interface{}{"max": 0, "timeout": "soon"}})
+
+	var feature testFeature
+	if _, err := c.Bind("feature", feature); err == nil {
+		t.Error("Bind to the non-pointer: want error")
+	}
+	if _, err := c.Bind("feature", &feature); err == nil {
+		t.Error("Bind the invalid duration: want error")
+	}
+	setCusConf(c, CustomConfig{"feature": map[string]interface{}{"max": 0}})
+	_, err := c.Bind("feature", &feature)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Bind the invalid value = %v, want *ValidationError", err)
+	}
+	if verr.Error() != "invalid config: feature.max: failed on the min tag" {
+		t.Errorf("Bind the invalid value = %q", verr.Error())
+	}
+}
+
+func TestBindConcurrentLoad(t *testing.T) {
+	c := newConfig()
+	b, err := c.Bind("feature", new(testFeature))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 100; i++ {
+			setCusConf(c, CustomConfig{"feature": map[string]interface{}{"max": i}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if got := b.Load().(*testFeature); got.Max < 1 {
+			t.Fatalf("Load = %+v", *got)
+		}
+	}
+	wg.Wait()
+	if got := b.Load().(*testFeature); got.Max != 100 {
+		t.Errorf("Load = %+v, want max 100", *got)
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/shelton-hu/logger"
+)
+
+// Sections of the config which can be subscribed by OnChange. The section of the
+// system config is the json name of its field.
+const (
+	SectionRegistry   = "registry"
+	SectionClient     = "client"
+	SectionRateLimit  = "rate_limit"
+	SectionAuth       = "auth"
+	SectionWeb        = "web"
+	SectionMysql      = "database"
+	SectionRedis      = "redis"
+	SectionJaeger     = "jaeger"
+	SectionTracing    = "tracing"
+	SectionRedaction  = "redaction"
+	SectionKafka      = "kafka"
+	SectionDelayQueue = "delay_queue"
+	SectionCron       = "cron"
+	SectionDomain     = "domain"
+
+	// SectionCusConf is the whole custom config.
+	SectionCusConf = "cusconf"
+)
+
+// ChangeFunc is called with the old and new value of the section after the config
+// was changed, e.g. config.Redis for SectionRedis and CustomConfig for SectionCusConf.
+type ChangeFunc func(old, new interface{})
+
+// OnChange subscribes the changes of the section of the default config.
+func OnChange(section string, fn ChangeFunc) {
+	Default().OnChange(section, fn)
+}
+
+// OnChange subscribes the changes of the config section, fn is called in the config
+// watching goroutine after the new config has been swapped in, so it should not block.
+func (c *Config) OnChange(section string, fn ChangeFunc) {
+	c.subscribe(section, fn)
+}
+
+// listener is the subscribed change function, whose pointer identifies the
+// subscription.
+type listener struct {
+	fn ChangeFunc
+}
+
+// subscribe subscribes the changes of the config section like OnChange, and returns
+// the function which unsubscribes them.
+func (c *Config) subscribe(section string, fn ChangeFunc) func() {
+	c.listenersMu.Lock()
+	defer c.listenersMu.Unlock()
+
+	l := &listener{fn: fn}
+	c.listeners[section] = append(c.listeners[section], l)
+	return func() {
+		c.listenersMu.Lock()
+		defer c.listenersMu.Unlock()
+
+		ls := c.listeners[section]
+		for i := range ls {
+			if ls[i] == l {
+				// copy the listeners, which may be being notified.
+				c.listeners[section] = append(ls[:i:i], ls[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notifySysConf calls the change functions of the changed system config sections.
+func (c *Config) notifySysConf(ctx context.Context, oldConf, newConf *SystemConfig) {
+	oldVal := reflect.ValueOf(oldConf).Elem()
+	newVal := reflect.ValueOf(newConf).Elem()
+	for i := 0; i < oldVal.NumField(); i++ {
+		section := strings.Split(oldVal.Type().Field(i).Tag.Get("json"), ",")[0]
+		oldSection, newSection := oldVal.Field(i).Interface(), newVal.Field(i).Interface()
+		if reflect.DeepEqual(oldSection, newSection) {
+			continue
+		}
+		c.notify(ctx, section, oldSection, newSection)
+	}
+}
+
+// notifyCusConf calls the change functions of the custom config.
+func (c *Config) notifyCusConf(ctx context.Context, oldConf, newConf *CustomConfig) {
+	if reflect.DeepEqual(*oldConf, *newConf) {
+		return
+	}
+	c.notify(ctx, SectionCusConf, *oldConf, *newConf)
+}
+
+// notify ...
+func (c *Config) notify(ctx context.Context, section string, old, new interface{}) {
+	c.listenersMu.RLock()
+	ls := c.listeners[section]
+	c.listenersMu.RUnlock()
+
+	for _, l := range ls {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					s := make([]byte, 2048)
+					n := runtime.Stack(s, false)
+					logger.Error(ctx, "config change function of %s exception, %v, %s", section, p, s[:n])
+				}
+			}()
+			l.fn(old, new)
+		}()
+	}
+}
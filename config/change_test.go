@@ -0,0 +1,84 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestNotifySysConf(t *testing.T) {
+	c := newConfig()
+	var changed []string
+	for _, section := range []string{SectionRegistry, SectionRedis, SectionKafka} {
+		section := section
+		c.OnChange(section, func(old, new interface{}) {
+			changed = append(changed, section)
+		})
+	}
+	var oldRedis, newRedis interface{}
+	c.OnChange(SectionRedis, func(old, new interface{}) {
+		oldRedis, newRedis = old, new
+	})
+
+	oldConf := &SystemConfig{
+		Registry: Registry{Name: "app"},
+		Redis:    Redis{Host: "127.0.0.1", Port: 6379},
+	}
+	newConf := &SystemConfig{
+		Registry: Registry{Name: "app"},
+		Redis:    Redis{Host: "127.0.0.1", Port: 6380},
+	}
+	c.notifySysConf(context.Background(), oldConf, newConf)
+
+	if !reflect.DeepEqual(changed, []string{SectionRedis}) {
+		t.Errorf("changed = %v, want only %s", changed, SectionRedis)
+	}
+	if oldRedis != oldConf.Redis || newRedis != newConf.Redis {
+		t.Errorf("redis change = %+v -> %+v, want %+v -> %+v", oldRedis, newRedis, oldConf.Redis, newConf.Redis)
+	}
+}
+
+func TestNotifyCusConf(t *testing.T) {
+	c := newConfig()
+	n := 0
+	c.OnChange(SectionCusConf, func(old, new interface{}) {
+		n++
+		if _, ok := new.(CustomConfig); !ok {
+			t.Errorf("new = %T, want CustomConfig", new)
+		}
+	})
+
+	c.notifyCusConf(context.Background(), &CustomConfig{"a": 1.0}, &CustomConfig{"a": 1.0})
+	if n != 0 {
+		t.Errorf("notified %d times for the same config, want 0", n)
+	}
+	c.notifyCusConf(context.Background(), &CustomConfig{"a": 1.0}, &CustomConfig{"a": 2.0})
+	if n != 1 {
+		t.Errorf("notified %d times for the changed config, want 1", n)
+	}
+}
+
+func TestNotifyRecoversAndUnsubscribes(t *testing.T) {
+	c := newConfig()
+	c.OnChange(SectionCusConf, func(old, new interface{}) {
+		panic("change")
+	})
+	n := 0
+	unsubscribe := c.subscribe(SectionCusConf, func(old, new interface{}) {
+		n++
+	})
+
+	// the panic of a change function doesn't skip the others.
+	c.notify(context.Background(), SectionCusConf, nil, nil)
+	if n != 1 {
+		t.Fatalf("notified %d times, want 1", n)
+	}
+	unsubscribe()
+	c.notify(context.Background(), SectionCusConf, nil, nil)
+	if n != 1 {
+		t.Errorf("notified %d times after unsubscribed, want 1", n)
+	}
+	if len(c.listeners[SectionCusConf]) != 1 {
+		t.Errorf("listeners = %d, want 1", len(c.listeners[SectionCusConf]))
+	}
+}
@@ -1,93 +1,361 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	microConfig "github.com/micro/go-micro/v2/config"
-	"github.com/micro/go-micro/v2/config/source/etcd"
 
 	"github.com/shelton-hu/logger"
 )
 
+// SharedAppName is the app name of the shared config layer of the namespace, which
+// is deep merged under the config of every app in the namespace.
+const SharedAppName = "_shared"
+
 const (
 	// etcd config key = _BaseKeyPath + namespace + appName + (_SysConfPath or _CusConfPath)
 	_BaseKeyPath = "/micro/config/"
 	_SysConfPath = "/sysconf"
 	_CusConfPath = "/cusconf"
+
+	// _RewatchDuration is the duration between the config watcher failed and rewatched.
+	_RewatchDuration = 1 * time.Second
 )
 
-var (
-	// sysconf is the system config variable.
-	sysconf *SystemConfig
+// std is the default config used by the package level functions, which holds
+// a *Config.
+var std atomic.Value
 
-	// cusconf is the custom config variable.
-	cusconf *CustomConfig
-)
+func init() {
+	std.Store(newConfig())
+}
+
+// Config is the system and custom config of an app, which is loaded from the source
+// and kept updated by watching it.
+type Config struct {
+	// sysconf holds the *SystemConfig.
+	sysconf atomic.Value
+
+	// cusconf holds the *CustomConfig.
+	cusconf atomic.Value
+
+	// effectiveSysConf holds the effective json of the system config.
+	effectiveSysConf atomic.Value
+
+	// effectiveCusConf holds the effective json of the custom config.
+	effectiveCusConf atomic.Value
+
+	// listeners are the change functions of every section.
+	listeners   map[string][]*listener
+	listenersMu sync.RWMutex
+
+	// failingWatches is the number of the watchers which failed and haven't been
+	// rewatched.
+	failingWatches int32
+
+	// closers stop the sources and the watchers of the config.
+	closers   []func()
+	exit      chan struct{}
+	closeOnce sync.Once
+}
+
+// validatable is implemented by the config which needs validating before used.
+type validatable interface {
+	Validate() error
+}
+
+// InitConfig initialize the system and custon config, and exits the process when
+// failed. Use Init instead to handle the error.
+func InitConfig(ctx context.Context, etcdAddresses []string, namespace string, appName string, opts ...InitOptions) {
+	if err := Init(ctx, etcdAddresses, namespace, appName, opts...); err != nil {
+		logger.Error(ctx, "fatal error: init config: %s", err.Error())
+		os.Exit(1)
+	}
+}
+
+// Init initialize the system and custon config of the default config, see New.
+func Init(ctx context.Context, etcdAddresses []string, namespace string, appName string, opts ...InitOptions) error {
+	o := newInitOption(etcdAddresses)
+	o.applyOpts(opts...)
+
+	return Default().load(ctx, o, namespace, appName)
+}
+
+// New returns the system and custon config of the app. The config is loaded from
+// etcd by default, or from the local file when SetLocalConfig is given, and the
+// environment variables can override it in both cases. The system config is
+// validated, and a *ValidationError is returned when it's invalid.
+func New(ctx context.Context, etcdAddresses []string, namespace string, appName string, opts ...InitOptions) (*Config, error) {
+	o := newInitOption(etcdAddresses)
+	o.applyOpts(opts...)
 
-// InitConfig initialize the system and custon config.
-func InitConfig(ctx context.Context, etcdAddresses []string, namespace string, appName string) {
-	initConfig(ctx, etcdAddresses, namespace, appName, _SysConfPath, sysconf)
-	initConfig(ctx, etcdAddresses, namespace, appName, _CusConfPath, cusconf)
+	c := newConfig()
+	if err := c.load(ctx, o, namespace, appName); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Default returns the default config used by the package level functions.
+func Default() *Config {
+	return std.Load().(*Config)
 }
 
-// SysConf returns the system config.
+// SetDefault replaces the default config used by the package level functions.
+func SetDefault(c *Config) {
+	std.Store(c)
+}
+
+// SysConf returns the current snapshot of the default system config.
 func SysConf() *SystemConfig {
-	return sysconf
+	return Default().SysConf()
 }
 
-// CusConf returns the custom config.
+// CusConf returns the current snapshot of the default custom config.
 func CusConf() *CustomConfig {
-	return cusconf
+	return Default().CusConf()
+}
+
+// EffectiveSysConf returns the effective json of the default system config.
+func EffectiveSysConf() []byte {
+	return Default().EffectiveSysConf()
+}
+
+// EffectiveCusConf returns the effective json of the default custom config.
+func EffectiveCusConf() []byte {
+	return Default().EffectiveCusConf()
+}
+
+// newConfig ...
+func newConfig() *Config {
+	c := &Config{
+		listeners: make(map[string][]*listener),
+		exit:      make(chan struct{}),
+	}
+	c.sysconf.Store(new(SystemConfig))
+	c.cusconf.Store(new(CustomConfig))
+	c.effectiveSysConf.Store([]byte(_EmptyConf))
+	c.effectiveCusConf.Store([]byte(_EmptyConf))
+	return c
+}
+
+// SysConf returns the current snapshot of the system config. The snapshot is
+// replaced rather than modified when the config changes, so it must not be modified.
+func (c *Config) SysConf() *SystemConfig {
+	return c.sysconf.Load().(*SystemConfig)
+}
+
+// CusConf returns the current snapshot of the custom config. The snapshot is
+// replaced rather than modified when the config changes, so it must not be modified.
+func (c *Config) CusConf() *CustomConfig {
+	return c.cusconf.Load().(*CustomConfig)
+}
+
+// EffectiveSysConf returns the effective json of the system config for debugging,
+// which is merged by the layers and overridden by the environment variables, and
+// its secret references are not resolved.
+func (c *Config) EffectiveSysConf() []byte {
+	return c.effectiveSysConf.Load().([]byte)
+}
+
+// EffectiveCusConf returns the effective json of the custom config for debugging,
+// which is merged by the layers and overridden by the environment variables.
+func (c *Config) EffectiveCusConf() []byte {
+	return c.effectiveCusConf.Load().([]byte)
+}
+
+// Close stops watching the config, the current snapshots are kept.
+func (c *Config) Close() {
+	c.closeOnce.Do(func() {
+		close(c.exit)
+		for _, fn := range c.closers {
+			fn()
+		}
+	})
+}
+
+// Check returns the error when watching the config is failing.
+func (c *Config) Check(ctx context.Context) error {
+	if n := atomic.LoadInt32(&c.failingWatches); n > 0 {
+		return fmt.Errorf("%d config watchers are failing", n)
+	}
+	return nil
+}
+
+// load loads the system and custom config, and watches them.
+func (c *Config) load(ctx context.Context, o *InitOption, namespace string, appName string) error {
+	if closer, ok := o.source.(io.Closer); ok {
+		c.closers = append(c.closers, func() { _ = closer.Close() })
+	}
+
+	notifySys := func(ctx context.Context, old, new interface{}) {
+		c.notifySysConf(ctx, old.(*SystemConfig), new.(*SystemConfig))
+	}
+	if err := c.initConfig(ctx, o, namespace, appName, _SysConfPath, &c.sysconf, &c.effectiveSysConf, false, notifySys); err != nil {
+		return err
+	}
+	notifyCus := func(ctx context.Context, old, new interface{}) {
+		c.notifyCusConf(ctx, old.(*CustomConfig), new.(*CustomConfig))
+	}
+	return c.initConfig(ctx, o, namespace, appName, _CusConfPath, &c.cusconf, &c.effectiveCusConf, true, notifyCus)
 }
 
-// initConfig watch the config from etcd.
-func initConfig(ctx context.Context, etcdAddresses []string, namespace string, appName string, etcdConfigPathSuffix string, conf interface{}) {
-	source := etcd.NewSource(
-		etcd.WithAddress(etcdAddresses...),
-		etcd.WithPrefix(_BaseKeyPath+namespace+appName+_CusConfPath),
-		etcd.StripPrefix(true),
-	)
+// initConfig loads the config from the source into conf, and watches its changes.
+// The new config is swapped into conf before notify is called, and its effective
+// json is stored into effective. The load error is only logged when the config
+// is optional.
+func (c *Config) initConfig(ctx context.Context, o *InitOption, namespace string, appName string, confPath string, conf *atomic.Value, effective *atomic.Value, optional bool, notify func(ctx context.Context, old, new interface{})) error {
+	sources, path := o.source.NewSource(namespace, appName, confPath)
 
 	mconf, err := microConfig.NewConfig()
 	if err != nil {
-		logger.Error(ctx, err.Error())
-		os.Exit(1)
+		return err
 	}
+	c.closers = append(c.closers, func() { _ = mconf.Close() })
 
-	if err := mconf.Load(source); err != nil {
+	if err := mconf.Load(sources...); err != nil {
+		if !optional {
+			return fmt.Errorf("load %s config: %s", confPath, err.Error())
+		}
 		logger.Error(ctx, "load config error: %s", err.Error())
 	}
 
-	go func(ctx context.Context, mconf microConfig.Config) {
-		w, err := mconf.Watch()
-		if err != nil {
-			logger.Error(ctx, "config watch error: %s", err.Error())
-			os.Exit(1)
-		}
+	typ := reflect.TypeOf(conf.Load()).Elem()
+	newConf, data, err := decodeConfig(o, confPath, mconf.Get(path...).Bytes(), typ)
+	if err != nil {
+		return err
+	}
+	conf.Store(newConf)
+	effective.Store(data)
+
+	w, err := mconf.Watch(path...)
+	if err != nil {
+		return fmt.Errorf("watch %s config: %s", confPath, err.Error())
+	}
+
+	go func(ctx context.Context, mconf microConfig.Config, w microConfig.Watcher) {
+		done := c.stopOnExit(w)
 		for {
 			v, err := w.Next()
 			if err != nil {
-				logger.Error(ctx, "watch next error，%s", err)
-				os.Exit(1)
+				close(done)
+				atomic.AddInt32(&c.failingWatches, 1)
+				// the watcher can't be used after failed, so rewatch it.
+				for {
+					select {
+					case <-c.exit:
+						return
+					case <-time.After(_RewatchDuration):
+					}
+					logger.Error(ctx, "watch next error，%s", err)
+					if w, err = mconf.Watch(path...); err == nil {
+						break
+					}
+				}
+				atomic.AddInt32(&c.failingWatches, -1)
+				done = c.stopOnExit(w)
+				continue
+			}
+			// the value of the watcher is always the whole source.
+			data, err := valueAt(v.Bytes(), path)
+			var newConf interface{}
+			if err == nil {
+				newConf, data, err = decodeConfig(o, confPath, data, typ)
 			}
-			logger.Info(ctx, "system config was changed，%s", string(v.Bytes()))
-
-			oldConfByte, _ := json.Marshal(conf)
-			logger.Info(ctx, "system config old， %s", string(oldConfByte))
-			err = json.Unmarshal(v.Bytes(), conf)
 			if err != nil {
-				logger.Error(ctx, "fatal error: change config value: %s", err.Error())
-				os.Exit(1)
+				// keep the old config when the new one is invalid.
+				logger.Error(ctx, "change config value error: %s", err.Error())
+				continue
 			}
-			newConfByte, _ := json.Marshal(conf)
-			logger.Info(ctx, "system config new，%s", string(newConfByte))
+			if bytes.Equal(data, effective.Load().([]byte)) {
+				continue
+			}
+			oldConf := conf.Load()
+			oldConfByte, _ := json.Marshal(MaskSecrets(oldConf))
+			logger.Info(ctx, "%s config old， %s", confPath, string(oldConfByte))
+			conf.Store(newConf)
+			effective.Store(data)
+			newConfByte, _ := json.Marshal(MaskSecrets(newConf))
+			logger.Info(ctx, "%s config new，%s", confPath, string(newConfByte))
+
+			notify(ctx, oldConf, newConf)
 		}
-	}(ctx, mconf)
+	}(ctx, mconf, w)
 
-	if err := mconf.Scan(conf); err != nil {
-		logger.Error(ctx, "fatal error: scan config value: %s", err.Error())
-		os.Exit(1)
+	return nil
+}
+
+// stopOnExit stops the watcher when the config is closed or the returned channel
+// is closed.
+func (c *Config) stopOnExit(w microConfig.Watcher) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c.exit:
+		case <-done:
+		}
+		_ = w.Stop()
+	}()
+	return done
+}
+
+// decodeConfig decodes the config data into a new config of the type after
+// overriding it by the environment variables, resolves its secrets, and returns
+// the pointer of it with the effective data.
+func decodeConfig(o *InitOption, confPath string, data []byte, typ reflect.Type) (interface{}, []byte, error) {
+	data, err := valueAt(data, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if data, err = overrideByEnv(o.envPrefix, confPath, data); err != nil {
+		return nil, nil, err
+	}
+
+	conf := reflect.New(typ).Interface()
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, nil, err
+	}
+	if err := resolveSecrets(conf, o.secretKey); err != nil {
+		return nil, nil, err
+	}
+	if sc, ok := conf.(*SystemConfig); ok {
+		if err := sc.ValidateSections(o.sections...); err != nil {
+			return nil, nil, err
+		}
+	} else if v, ok := conf.(validatable); ok {
+		if err := v.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return conf, data, nil
+}
+
+// valueAt returns the compact json value with sorted keys at the path of the
+// json data.
+func valueAt(data []byte, path []string) ([]byte, error) {
+	if len(data) == 0 {
+		return []byte("null"), nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return []byte("null"), nil
+		}
+		v = m[key]
 	}
+	return json.Marshal(v)
 }
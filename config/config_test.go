@@ -0,0 +1,39 @@
+package config
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shelton-hu/pi/health"
+)
+
+func TestCheckWhileWatchesFail(t *testing.T) {
+	c := newConfig()
+	h := health.New()
+	h.Register("config", c.Check)
+	h.Register("mysql", func(ctx context.Context) error { return nil })
+
+	if report := h.Check(context.Background()); !report.Healthy() {
+		t.Fatalf("status = %s, want up while watching", report.Status)
+	}
+
+	// two watchers failed, e.g. etcd is unreachable.
+	atomic.AddInt32(&c.failingWatches, 2)
+	report := h.Check(context.Background())
+	if report.Healthy() {
+		t.Error("status = up, want down while watches are failing")
+	}
+	if got := report.Components["config"]; got.Status != health.StatusDown || got.Error != "2 config watchers are failing" {
+		t.Errorf("config = %+v, want down by the failing watches", got)
+	}
+	if got := report.Components["mysql"]; got.Status != health.StatusUp {
+		t.Errorf("mysql = %+v, want up", got)
+	}
+
+	// rewatched
+	atomic.AddInt32(&c.failingWatches, -2)
+	if report := h.Check(context.Background()); !report.Healthy() {
+		t.Errorf("status = %s, want up after rewatched", report.Status)
+	}
+}
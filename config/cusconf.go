@@ -1,4 +1,141 @@
 package config
 
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
 // CustomConfig ...
 type CustomConfig map[string]interface{}
+
+// Get returns the value at the dotted path, e.g. feature.limits.max, and whether
+// it exists.
+func (c *CustomConfig) Get(path string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	var v interface{} = map[string]interface{}(*c)
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// GetString returns the string at the dotted path, numbers and bools are formatted,
+// and it returns "" when the value doesn't exist or is not a scalar.
+func (c *CustomConfig) GetString(path string) string {
+	v, _ := c.Get(path)
+	return toString(v)
+}
+
+// GetInt returns the int at the dotted path, numeric strings are parsed, and it
+// returns 0 when the value doesn't exist or is not a number.
+func (c *CustomConfig) GetInt(path string) int {
+	return int(c.GetInt64(path))
+}
+
+// GetInt64 returns the int64 at the dotted path, numeric strings are parsed, and
+// it returns 0 when the value doesn't exist or is not a number.
+func (c *CustomConfig) GetInt64(path string) int64 {
+	v, _ := c.Get(path)
+	switch v := v.(type) {
+	case float64:
+		return int64(v)
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return int64(f)
+		}
+	}
+	return 0
+}
+
+// GetFloat64 returns the float64 at the dotted path, numeric strings are parsed,
+// and it returns 0 when the value doesn't exist or is not a number.
+func (c *CustomConfig) GetFloat64(path string) float64 {
+	v, _ := c.Get(path)
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
+// GetBool returns the bool at the dotted path, strings like "true" or "1" are
+// parsed, and it returns false when the value doesn't exist or is not a bool.
+func (c *CustomConfig) GetBool(path string) bool {
+	v, _ := c.Get(path)
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+	return false
+}
+
+// GetDuration returns the duration at the dotted path. A string is parsed by
+// time.ParseDuration, e.g. "1m30s", and a number is in seconds like the durations
+// of the system config. It returns 0 when the value doesn't exist or is invalid.
+func (c *CustomConfig) GetDuration(path string) time.Duration {
+	v, _ := c.Get(path)
+	d, _ := toDuration(v)
+	return d
+}
+
+// GetStringSlice returns the strings at the dotted path, and it returns nil when
+// the value doesn't exist or is not an array.
+func (c *CustomConfig) GetStringSlice(path string) []string {
+	v, _ := c.Get(path)
+	vs, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	ss := make([]string, 0, len(vs))
+	for _, v := range vs {
+		ss = append(ss, toString(v))
+	}
+	return ss
+}
+
+// toString ...
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// toDuration converts the duration string or the number of seconds to duration.
+func toDuration(v interface{}) (time.Duration, bool) {
+	switch v := v.(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+		return d, err == nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+const (
+	// _DefaultEnvPrefix is the default prefix of the environment variables which
+	// override the config.
+	_DefaultEnvPrefix = "PI"
+
+	// _EnvKeySep separates the config keys in the name of the environment variable.
+	_EnvKeySep = "__"
+)
+
+// overrideByEnv overrides the config data by the environment variables. The name
+// of the variable is made of the prefix, the config path and the lower case keys
+// of the config value, e.g. PI_SYSCONF__REDIS__MAX_IDLE=10 overrides redis.max_idle
+// of the system config. The value is decoded as json, or used as a string when
+// it is not a valid json.
+func overrideByEnv(prefix, confPath string, data []byte) ([]byte, error) {
+	if prefix == "" {
+		return data, nil
+	}
+	envPrefix := prefix + "_" + strings.ToUpper(strings.TrimPrefix(confPath, "/")) + _EnvKeySep
+
+	conf := make(map[string]interface{})
+	overridden := false
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, envPrefix) {
+			continue
+		}
+		pair := strings.SplitN(strings.TrimPrefix(env, envPrefix), "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			continue
+		}
+		if !overridden {
+			if len(data) > 0 {
+				if err := json.Unmarshal(data, &conf); err != nil {
+					return nil, err
+				}
+			}
+			if conf == nil {
+				conf = make(map[string]interface{})
+			}
+			overridden = true
+		}
+		setValue(conf, strings.Split(strings.ToLower(pair[0]), _EnvKeySep), parseEnvValue(pair[1]))
+	}
+
+	if !overridden {
+		return data, nil
+	}
+	return json.Marshal(conf)
+}
+
+// setValue sets the value into the nested map by the keys.
+func setValue(conf map[string]interface{}, keys []string, value interface{}) {
+	for i, key := range keys {
+		if i == len(keys)-1 {
+			conf[key] = value
+			return
+		}
+		next, ok := conf[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			conf[key] = next
+		}
+		conf = next
+	}
+}
+
+// parseEnvValue ...
+func parseEnvValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOverrideByEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		env     map[string]string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "no variables",
+			env:  map[string]string{"PITEST_CUSCONF__A": "1", "OTHER_SYSCONF__A": "1"},
+			data: `{"a":0}`,
+			want: `{"a":0}`,
+		},
+		{
+			name:   "disabled",
+			prefix: "-",
+			env:    map[string]string{"PITEST_SYSCONF__A": "1"},
+			data:   `{"a":0}`,
+			want:   `{"a":0}`,
+		},
+		{
+			name: "nested keys",
+			env:  map[string]string{"PITEST_SYSCONF__REDIS__MAX_IDLE": "10", "PITEST_SYSCONF__MYSQL__DEFAULT__HOST": "db"},
+			data: `{"redis":{"host":"a","max_idle":1}}`,
+			want: `{"redis":{"host":"a","max_idle":10},"mysql":{"default":{"host":"db"}}}`,
+		},
+		{
+			name: "lower case keys",
+			env:  map[string]string{"PITEST_SYSCONF__Registry__NAME": "app"},
+			data: `{}`,
+			want: `{"registry":{"name":"app"}}`,
+		},
+		{
+			name: "types",
+			env: map[string]string{
+				"PITEST_SYSCONF__INT":    "10",
+				"PITEST_SYSCONF__FLOAT":  "1.5",
+				"PITEST_SYSCONF__BOOL":   "true",
+				"PITEST_SYSCONF__STRING": "a b",
+				"PITEST_SYSCONF__QUOTED": `"10"`,
+				"PITEST_SYSCONF__ARRAY":  `["a","b"]`,
+				"PITEST_SYSCONF__OBJECT": `{"a":1}`,
+				"PITEST_SYSCONF__NULL":   "null",
+			},
+			data: `{"string":1}`,
+			want: `{"int":10,"float":1.5,"bool":true,"string":"a b","quoted":"10","array":["a","b"],"object":{"a":1},"null":null}`,
+		},
+		{
+			name: "scalar replaced by object",
+			env:  map[string]string{"PITEST_SYSCONF__REDIS__HOST": "a"},
+			data: `{"redis":"b"}`,
+			want: `{"redis":{"host":"a"}}`,
+		},
+		{
+			name: "empty data",
+			env:  map[string]string{"PITEST_SYSCONF__A": "1"},
+			data: ``,
+			want: `{"a":1}`,
+		},
+		{
+			name: "null data",
+			env:  map[string]string{"PITEST_SYSCONF__A": "1"},
+			data: `null`,
+			want: `{"a":1}`,
+		},
+		{
+			name: "empty key",
+			env:  map[string]string{"PITEST_SYSCONF__": "1"},
+			data: `{"a":0}`,
+			want: `{"a":0}`,
+		},
+		{
+			name:    "invalid data",
+			env:     map[string]string{"PITEST_SYSCONF__A": "1"},
+			data:    `[1]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			prefix := "PITEST"
+			if tt.prefix == "-" {
+				prefix = ""
+			}
+			data, err := overrideByEnv(prefix, _SysConfPath, []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("overrideByEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("overrideByEnv() = %s, %v", data, err)
+			}
+			_ = json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("overrideByEnv() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	valid := `{"sysconf": {"registry": {"name": "app", "ttl": 10}}, "cusconf": {"a": 1}}`
+
+	tests := []struct {
+		name     string
+		path     string
+		wantErr  bool
+		wantName string
+		wantTtl  int
+	}{
+		{name: "json", path: write("config.json", valid), wantName: "app", wantTtl: 20},
+		{name: "yaml", path: write("config.yaml", "sysconf:\n  registry:\n    name: yaml\ncusconf:\n  a: 1\n"), wantName: "yaml", wantTtl: 20},
+		{name: "missing", path: filepath.Join(dir, "missing.json"), wantErr: true},
+		{name: "invalid json", path: write("invalid.json", `{"sysconf": `), wantErr: true},
+		{name: "invalid config", path: write("unknown.json", `{"sysconf": {"registry": {"nmae": "app"}}}`), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PITEST_SYSCONF__REGISTRY__TTL", "20")
+			c, err := New(context.Background(), nil, "ns", "app",
+				SetLocalConfig(tt.path), SetEnvPrefix("PITEST"), SetSections(SectionRegistry))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer c.Close()
+			if got := c.SysConf().Registry; got.Name != tt.wantName || got.Ttl != tt.wantTtl {
+				t.Errorf("registry = %+v, want name %s and ttl %d overridden by the env", got, tt.wantName, tt.wantTtl)
+			}
+			if got := (*c.CusConf())["a"]; got != 1.0 {
+				t.Errorf("cusconf a = %v, want 1", got)
+			}
+		})
+	}
+}
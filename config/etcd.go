@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/micro/go-micro/v2/config/source"
+)
+
+const (
+	// _EtcdDialTimeout is the dial timeout of the etcd client.
+	_EtcdDialTimeout = 3 * time.Second
+
+	// _EtcdReadTimeout is the timeout of reading the etcd key.
+	_EtcdReadTimeout = 5 * time.Second
+
+	// _EmptyConf is the config data of the absent key.
+	_EmptyConf = "{}"
+)
+
+// etcdKeySource is the go-micro config source of a single etcd key. Unlike the
+// go-micro etcd source, the key is allowed to be absent and loaded as an empty
+// config, so that an optional layer can be created or deleted at any time.
+type etcdKeySource struct {
+	key    string
+	client *clientv3.Client
+	err    error
+	opts   source.Options
+}
+
+// etcdKeyWatcher ...
+type etcdKeyWatcher struct {
+	source *etcdKeySource
+	ch     clientv3.WatchChan
+	cancel context.CancelFunc
+}
+
+// newEtcdKeySource ...
+func newEtcdKeySource(client *clientv3.Client, err error, key string) source.Source {
+	return &etcdKeySource{
+		key:    key,
+		client: client,
+		err:    err,
+		opts:   source.NewOptions(),
+	}
+}
+
+// Read ...
+func (s *etcdKeySource) Read() (*source.ChangeSet, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), _EtcdReadTimeout)
+	defer cancel()
+	rsp, err := s.client.Get(ctx, s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte(_EmptyConf)
+	if len(rsp.Kvs) > 0 {
+		data = rsp.Kvs[0].Value
+	}
+	return s.changeSet(data), nil
+}
+
+// Write ...
+func (s *etcdKeySource) Write(cs *source.ChangeSet) error {
+	return nil
+}
+
+// Watch ...
+func (s *etcdKeySource) Watch() (source.Watcher, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &etcdKeyWatcher{
+		source: s,
+		ch:     s.client.Watch(ctx, s.key),
+		cancel: cancel,
+	}, nil
+}
+
+// String ...
+func (s *etcdKeySource) String() string {
+	return "etcd"
+}
+
+// changeSet ...
+func (s *etcdKeySource) changeSet(data []byte) *source.ChangeSet {
+	cs := &source.ChangeSet{
+		Timestamp: time.Now(),
+		Source:    s.String(),
+		Data:      data,
+		Format:    s.opts.Encoder.String(),
+	}
+	cs.Checksum = cs.Sum()
+	return cs
+}
+
+// Next ...
+func (w *etcdKeyWatcher) Next() (*source.ChangeSet, error) {
+	for {
+		rsp, ok := <-w.ch
+		if !ok {
+			return nil, errors.New("etcd watcher stopped")
+		}
+		if err := rsp.Err(); err != nil {
+			return nil, err
+		}
+		if len(rsp.Events) == 0 {
+			continue
+		}
+
+		// only the latest event of the key matters.
+		ev := rsp.Events[len(rsp.Events)-1]
+		data := []byte(_EmptyConf)
+		if ev.Type == clientv3.EventTypePut {
+			data = ev.Kv.Value
+		}
+		return w.source.changeSet(data), nil
+	}
+}
+
+// Stop ...
+func (w *etcdKeyWatcher) Stop() error {
+	w.cancel()
+	return nil
+}
@@ -0,0 +1,77 @@
+package config
+
+// InitOptions ...
+type InitOptions func(*InitOption)
+
+// InitOption ...
+type InitOption struct {
+	// source is where the config is loaded from.
+	source Source
+
+	// envPrefix is the prefix of the environment variables which override the
+	// config, the overriding is disabled when it's empty.
+	envPrefix string
+
+	// secretKey decrypts the enc: secret references of the config.
+	secretKey []byte
+
+	// sections are the sections of the system config to validate, all the sections
+	// are validated when it's empty.
+	sections []string
+}
+
+// newInitOption ...
+func newInitOption(etcdAddresses []string) *InitOption {
+	return &InitOption{
+		source:    NewEtcdSource(etcdAddresses...),
+		envPrefix: _DefaultEnvPrefix,
+	}
+}
+
+// applyOpts ...
+func (o *InitOption) applyOpts(opts ...InitOptions) {
+	for _, opt := range opts {
+		opt(o)
+	}
+}
+
+// SetSource sets where the config is loaded from, default is etcd.
+func SetSource(source Source) InitOptions {
+	return func(o *InitOption) {
+		o.source = source
+	}
+}
+
+// SetLocalConfig loads the config from the local json or yaml file instead of
+// etcd, it's ignored when the path is empty.
+func SetLocalConfig(path string) InitOptions {
+	return func(o *InitOption) {
+		if path != "" {
+			o.source = NewFileSource(path)
+		}
+	}
+}
+
+// SetEnvPrefix sets the prefix of the environment variables which override the
+// config, default is PI. The empty prefix disables the overriding.
+func SetEnvPrefix(prefix string) InitOptions {
+	return func(o *InitOption) {
+		o.envPrefix = prefix
+	}
+}
+
+// SetSecretKey sets the AES key which decrypts the enc: secret references of the
+// config, default is the base64 decoded environment variable PI_SECRET_KEY.
+func SetSecretKey(key []byte) InitOptions {
+	return func(o *InitOption) {
+		o.secretKey = key
+	}
+}
+
+// SetSections sets the sections of the system config to validate, e.g. the sections
+// of the components which the app uses, default is all the sections.
+func SetSections(sections ...string) InitOptions {
+	return func(o *InitOption) {
+		o.sections = sections
+	}
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const (
+	// The prefixes of the secret reference, e.g. env:DB_PASS, file:/run/secrets/db
+	// and enc:<base64 of the nonce and the AES-GCM sealed secret>.
+	_SecretEnvPrefix  = "env:"
+	_SecretFilePrefix = "file:"
+	_SecretEncPrefix  = "enc:"
+
+	// _SecretKeyEnv is the environment variable of the base64 encoded key which
+	// decrypts the enc: secrets, when SetSecretKey is not given.
+	_SecretKeyEnv = "PI_SECRET_KEY"
+
+	// _SecretMask replaces the secret when the config is printed.
+	_SecretMask = "******"
+)
+
+// secretKeyWords are the words of the keys of the custom config whose values are
+// masked, which are matched case-insensitively regardless of the underscores and
+// hyphens, e.g. db_password and apiKey.
+var secretKeyWords = []string{"password", "passwd", "secret", "token", "authorization", "credential", "apikey", "privatekey", "accesskey"}
+
+// EncryptSecret encrypts the secret by the AES key, which must be 16, 24 or 32
+// bytes, and returns the enc: reference which can be put into the config.
+func EncryptSecret(key []byte, secret string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return _SecretEncPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// resolveSecrets replaces the secret references of the fields tagged by
+// `secret:"true"` in conf by their values, which are the strings or the values of
+// the maps of strings.
+func resolveSecrets(conf interface{}, key []byte) error {
+	v := new(ValidationError)
+	walkSecrets(reflect.ValueOf(conf), "", func(field string, s reflect.Value) {
+		secret, err := resolveSecret(s.String(), key)
+		if err != nil {
+			v.add(field, err.Error())
+			return
+		}
+		s.SetString(secret)
+	})
+	return v.err()
+}
+
+// MaskSecrets returns a copy of conf whose secret fields are masked, conf must be
+// a pointer. The custom config has no secret fields, so its values whose keys look
+// like secrets, e.g. password and api_key, are masked instead.
+func MaskSecrets(conf interface{}) interface{} {
+	// copy deeply by json, the maps of conf must not be modified.
+	masked := reflect.New(reflect.TypeOf(conf).Elem())
+	data, _ := json.Marshal(conf)
+	_ = json.Unmarshal(data, masked.Interface())
+	walkSecrets(masked, "", func(field string, s reflect.Value) {
+		if s.String() != "" {
+			s.SetString(_SecretMask)
+		}
+	})
+	if cus, ok := masked.Interface().(*CustomConfig); ok {
+		maskSecretKeys(*cus)
+	}
+	return masked.Interface()
+}
+
+// maskSecretKeys masks the values of the json value whose keys look like secrets.
+func maskSecretKeys(v interface{}) {
+	switch v := v.(type) {
+	case CustomConfig:
+		maskSecretKeys(map[string]interface{}(v))
+	case map[string]interface{}:
+		for key, value := range v {
+			switch value.(type) {
+			case map[string]interface{}:
+				maskSecretKeys(value)
+			case nil:
+			default:
+				if isSecretKey(key) {
+					v[key] = _SecretMask
+				} else {
+					maskSecretKeys(value)
+				}
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			maskSecretKeys(value)
+		}
+	}
+}
+
+// isSecretKey returns true when the key contains any of secretKeyWords.
+func isSecretKey(key string) bool {
+	key = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	for _, word := range secretKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkSecrets calls fn with the json path and the value of every secret field, the
+// value is settable.
+func walkSecrets(v reflect.Value, path string, fn func(field string, s reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walkSecrets(v.Elem(), path, fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fieldPath := joinPath(path, jsonName(field))
+			if field.Tag.Get("secret") == "true" {
+				switch {
+				case field.Type.Kind() == reflect.String:
+					fn(fieldPath, v.Field(i))
+					continue
+				case field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.String:
+					walkSecretMap(v.Field(i), fieldPath, fn)
+					continue
+				}
+			}
+			walkSecrets(v.Field(i), fieldPath, fn)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// the map value is not settable, so walk a copy of it.
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			walkSecrets(elem, joinPath(path, fmt.Sprint(iter.Key().Interface())), fn)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkSecrets(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
+
+// walkSecretMap calls fn with the json path and the copy of every value of the map
+// of strings, whose values are all secrets, and sets the copy back.
+func walkSecretMap(m reflect.Value, path string, fn func(field string, s reflect.Value)) {
+	iter := m.MapRange()
+	for iter.Next() {
+		elem := reflect.New(m.Type().Elem()).Elem()
+		elem.Set(iter.Value())
+		fn(joinPath(path, fmt.Sprint(iter.Key().Interface())), elem)
+		m.SetMapIndex(iter.Key(), elem)
+	}
+}
+
+// resolveSecret returns the value of the secret reference, the value without
+// reference prefix is returned as is.
+func resolveSecret(s string, key []byte) (string, error) {
+	switch {
+	case strings.HasPrefix(s, _SecretEnvPrefix):
+		name := strings.TrimPrefix(s, _SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(s, _SecretFilePrefix):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(s, _SecretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case strings.HasPrefix(s, _SecretEncPrefix):
+		return decryptSecret(strings.TrimPrefix(s, _SecretEncPrefix), key)
+	}
+	return s, nil
+}
+
+// decryptSecret ...
+func decryptSecret(s string, key []byte) (string, error) {
+	if len(key) == 0 {
+		encoded, ok := os.LookupEnv(_SecretKeyEnv)
+		if !ok {
+			return "", errors.New("secret key is not set")
+		}
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return "", fmt.Errorf("invalid %s: %s", _SecretKeyEnv, err.Error())
+		}
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	secret, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %s", err.Error())
+	}
+	return string(secret), nil
+}
+
+// newGCM ...
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// joinPath ...
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
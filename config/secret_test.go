@@ -0,0 +1,149 @@
+package config
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	otherKey := []byte("fedcba9876543210")
+	enc, err := EncryptSecret(key, "encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(enc, _SecretEncPrefix) {
+		t.Fatalf("EncryptSecret = %s, want the enc: reference", enc)
+	}
+
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(file, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PI_TEST_SECRET", "from env")
+	defer os.Unsetenv("PI_TEST_SECRET")
+	os.Unsetenv(_SecretKeyEnv)
+
+	tests := []struct {
+		name    string
+		s       string
+		key     []byte
+		want    string
+		wantErr string
+	}{
+		{name: "plain", s: "plain", want: "plain"},
+		{name: "env", s: "env:PI_TEST_SECRET", want: "from env"},
+		{name: "env not set", s: "env:PI_TEST_NOT_SET", wantErr: "environment variable PI_TEST_NOT_SET is not set"},
+		{name: "file", s: "file:" + file, want: "from file"},
+		{name: "file not found", s: "file:" + file + ".none", wantErr: "no such file"},
+		{name: "enc", s: enc, key: key, want: "encrypted"},
+		{name: "enc without key", s: enc, wantErr: "secret key is not set"},
+		{name: "enc by other key", s: enc, key: otherKey, wantErr: "decrypt secret"},
+		{name: "enc invalid key", s: enc, key: []byte("short"), wantErr: "invalid key size"},
+		{name: "enc not base64", s: "enc:***", key: key, wantErr: "illegal base64"},
+		{name: "enc too short", s: "enc:" + base64.StdEncoding.EncodeToString([]byte("x")), key: key, wantErr: "too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSecret(tt.s, tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveSecret = %q, %v, want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("resolveSecret = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSecretKeyEnv(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	enc, _ := EncryptSecret(key, "encrypted")
+
+	os.Setenv(_SecretKeyEnv, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(_SecretKeyEnv)
+	if got, err := resolveSecret(enc, nil); err != nil || got != "encrypted" {
+		t.Errorf("resolveSecret = %q, %v, want encrypted", got, err)
+	}
+
+	os.Setenv(_SecretKeyEnv, "***")
+	if _, err := resolveSecret(enc, nil); err == nil || !strings.Contains(err.Error(), "invalid "+_SecretKeyEnv) {
+		t.Errorf("resolveSecret = %v, want the invalid key error", err)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	os.Setenv("PI_TEST_SECRET", "from env")
+	defer os.Unsetenv("PI_TEST_SECRET")
+
+	conf := &SystemConfig{
+		Redis: Redis{Host: "env:PI_TEST_SECRET", Password: "env:PI_TEST_SECRET"},
+		Tracing: Tracing{Otlp: Otlp{Headers: map[string]string{
+			"authorization": "env:PI_TEST_SECRET",
+			"x-missing":     "env:PI_TEST_NOT_SET",
+		}}},
+	}
+	err := resolveSecrets(conf, nil)
+	if err == nil || !strings.Contains(err.Error(), "tracing.otlp.headers.x-missing: environment variable PI_TEST_NOT_SET is not set") {
+		t.Errorf("resolveSecrets = %v, want the error of the missing header", err)
+	}
+	if conf.Redis.Password != "from env" || conf.Tracing.Otlp.Headers["authorization"] != "from env" {
+		t.Errorf("secrets aren't resolved, %+v", conf)
+	}
+	if conf.Redis.Host != "env:PI_TEST_SECRET" {
+		t.Errorf("field which isn't secret is resolved, got %s", conf.Redis.Host)
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	sys := &SystemConfig{
+		Redis:   Redis{Host: "127.0.0.1", Password: "pass"},
+		Auth:    Auth{Services: map[string]ServiceToken{"a": {Token: "token"}}},
+		Tracing: Tracing{Otlp: Otlp{Headers: map[string]string{"authorization": "Bearer key"}}},
+	}
+	masked := MaskSecrets(sys).(*SystemConfig)
+	if masked.Redis.Password != _SecretMask || masked.Auth.Services["a"].Token != _SecretMask ||
+		masked.Tracing.Otlp.Headers["authorization"] != _SecretMask {
+		t.Errorf("secrets aren't masked, %+v", masked)
+	}
+	if masked.Redis.Host != "127.0.0.1" || masked.Redis.KeyPrefix != "" {
+		t.Errorf("other fields are masked, %+v", masked.Redis)
+	}
+	if sys.Redis.Password != "pass" || sys.Tracing.Otlp.Headers["authorization"] != "Bearer key" ||
+		sys.Auth.Services["a"].Token != "token" {
+		t.Error("MaskSecrets modifies the config")
+	}
+
+	cus := &CustomConfig{
+		"name":        "app",
+		"db_password": "pass",
+		"apiKey":      "key",
+		"port":        8080.0,
+		"feature":     map[string]interface{}{"Access-Token": "token", "enabled": true, "secrets": []interface{}{"a"}},
+		"clients":     []interface{}{map[string]interface{}{"client_secret": "s", "id": "c"}},
+		"token_ttl":   nil,
+	}
+	want := &CustomConfig{
+		"name":        "app",
+		"db_password": _SecretMask,
+		"apiKey":      _SecretMask,
+		"port":        8080.0,
+		"feature":     map[string]interface{}{"Access-Token": _SecretMask, "enabled": true, "secrets": _SecretMask},
+		"clients":     []interface{}{map[string]interface{}{"client_secret": _SecretMask, "id": "c"}},
+		"token_ttl":   nil,
+	}
+	if got := MaskSecrets(cus); !reflect.DeepEqual(got, want) {
+		t.Errorf("MaskSecrets = %v, want %v", got, want)
+	}
+	if (*cus)["db_password"] != "pass" {
+		t.Error("MaskSecrets modifies the custom config")
+	}
+}
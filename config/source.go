@@ -0,0 +1,114 @@
+package config
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/micro/go-micro/v2/config/reader/json"
+	"github.com/micro/go-micro/v2/config/source"
+	"github.com/micro/go-micro/v2/config/source/file"
+)
+
+// Source is where the config is loaded from.
+type Source interface {
+	// NewSource returns the go-micro config sources of the config path, which are
+	// deep merged and the latter ones override the former ones, and the path of
+	// the config value in them.
+	NewSource(namespace, appName, confPath string) ([]source.Source, []string)
+}
+
+// etcdSource loads the config from etcd. Each config path is made of two layers,
+// the shared layer of the namespace and the layer of the app which overrides it.
+type etcdSource struct {
+	addresses []string
+
+	// client is shared by the sources of all config paths.
+	client *clientv3.Client
+	err    error
+	once   sync.Once
+}
+
+// NewEtcdSource returns the source which loads the config from etcd.
+func NewEtcdSource(addresses ...string) Source {
+	return &etcdSource{
+		addresses: addresses,
+	}
+}
+
+// NewSource ...
+func (s *etcdSource) NewSource(namespace, appName, confPath string) ([]source.Source, []string) {
+	s.once.Do(func() {
+		s.client, s.err = clientv3.New(clientv3.Config{
+			Endpoints:   s.addresses,
+			DialTimeout: _EtcdDialTimeout,
+		})
+	})
+
+	srcs := []source.Source{
+		newEtcdKeySource(s.client, s.err, confKey(namespace, SharedAppName, confPath)),
+		newEtcdKeySource(s.client, s.err, confKey(namespace, appName, confPath)),
+	}
+	return srcs, nil
+}
+
+// Close closes the etcd client.
+func (s *etcdSource) Close() error {
+	s.once.Do(func() {})
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
+
+// fileSource loads the config from the local json or yaml file, which contains
+// both the system config and the custom config, e.g.
+//
+//	{"sysconf": {...}, "cusconf": {...}}
+type fileSource struct {
+	path string
+}
+
+// NewFileSource returns the source which loads the config from the local file,
+// the format of the file is decided by its extension.
+func NewFileSource(path string) Source {
+	return &fileSource{
+		path: path,
+	}
+}
+
+// NewSource ...
+func (s *fileSource) NewSource(namespace, appName, confPath string) ([]source.Source, []string) {
+	src := file.NewSource(file.WithPath(s.path))
+	return []source.Source{src}, []string{strings.TrimPrefix(confPath, "/")}
+}
+
+// MergeLayers deep merges the json data of the config layers like the layers of
+// the etcd source, the latter ones override the former ones, e.g. the shared layer
+// of the namespace and the layer of the app.
+func MergeLayers(layers ...[]byte) ([]byte, error) {
+	changes := make([]*source.ChangeSet, 0, len(layers))
+	for _, data := range layers {
+		changes = append(changes, &source.ChangeSet{Data: data, Format: "json"})
+	}
+	cs, err := json.NewReader().Merge(changes...)
+	if err != nil {
+		return nil, err
+	}
+	return cs.Data, nil
+}
+
+// SysConfKey returns the etcd key of the system config of the app.
+func SysConfKey(namespace, appName string) string {
+	return confKey(namespace, appName, _SysConfPath)
+}
+
+// CusConfKey returns the etcd key of the custom config of the app.
+func CusConfKey(namespace, appName string) string {
+	return confKey(namespace, appName, _CusConfPath)
+}
+
+// confKey returns the etcd key of the config path.
+func confKey(namespace, appName, confPath string) string {
+	return _BaseKeyPath + namespace + appName + confPath
+}
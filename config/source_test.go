@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestConfKey(t *testing.T) {
+	tests := []struct {
+		namespace, appName string
+		sysConfKey         string
+		cusConfKey         string
+	}{
+		{"dev", "app", "/micro/config/devapp/sysconf", "/micro/config/devapp/cusconf"},
+		{"dev/", "app", "/micro/config/dev/app/sysconf", "/micro/config/dev/app/cusconf"},
+		{"", "app", "/micro/config/app/sysconf", "/micro/config/app/cusconf"},
+		{"dev/", SharedAppName, "/micro/config/dev/_shared/sysconf", "/micro/config/dev/_shared/cusconf"},
+	}
+	for _, tt := range tests {
+		if key := SysConfKey(tt.namespace, tt.appName); key != tt.sysConfKey {
+			t.Errorf("SysConfKey(%q, %q) = %q, want %q", tt.namespace, tt.appName, key, tt.sysConfKey)
+		}
+		if key := CusConfKey(tt.namespace, tt.appName); key != tt.cusConfKey {
+			t.Errorf("CusConfKey(%q, %q) = %q, want %q", tt.namespace, tt.appName, key, tt.cusConfKey)
+		}
+	}
+}
@@ -1,11 +1,24 @@
 package config
 
-// SystemConfig ...
+// SystemConfig is the system config of the app, whose fields tagged by
+// `secret:"true"`, i.e. the strings or the values of the maps of strings, can be
+// the secret references, which are resolved when the config is loaded, and are
+// masked when the config is printed:
+//
+//	env:DB_PASS               the value of the environment variable DB_PASS
+//	file:/run/secrets/db      the content of the file
+//	enc:<base64>              the secret encrypted by EncryptSecret
 type SystemConfig struct {
 	Registry   Registry          `json:"registry"`
+	Client     Client            `json:"client"`
+	RateLimit  RateLimit         `json:"rate_limit"`
+	Auth       Auth              `json:"auth"`
+	Web        Web               `json:"web"`
 	Mysql      map[string]Mysql  `json:"database"`
 	Redis      Redis             `json:"redis"`
 	Jaeger     Jaeger            `json:"jaeger"`
+	Tracing    Tracing           `json:"tracing"`
+	Redaction  Redaction         `json:"redaction"`
 	Kafka      Kafka             `json:"kafka"`
 	DelayQueue DelayQueue        `json:"delay_queue"`
 	Cron       Cron              `json:"cron"`
@@ -22,12 +35,176 @@ type Registry struct {
 	MetaData map[string]string `json:"meta_data"`
 }
 
+// Client is the policy of the rpc calls of the client, the policy of an endpoint
+// is looked up by "service.Endpoint", e.g. go.micro.srv.user.User.Get, then by
+// the service, and the default policy is used for the fields which it doesn't set.
+type Client struct {
+	Default   ClientPolicy            `json:"default"`
+	Endpoints map[string]ClientPolicy `json:"endpoints"`
+}
+
+// ClientPolicy is the policy of the rpc calls.
+type ClientPolicy struct {
+	// Timeout is the timeout in milliseconds of a call including its retries,
+	// default is 5000.
+	Timeout int `json:"timeout"`
+
+	// Retries is the max number of the retries of a call which failed by a retriable
+	// error, e.g. a timeout or an unavailable service, -1 disables the retries and
+	// default is 1.
+	Retries int `json:"retries"`
+
+	// Backoff is the backoff in milliseconds before the first retry, which is doubled
+	// for each next retry up to MaxBackoff, default is 100.
+	Backoff int `json:"backoff"`
+
+	// MaxBackoff is the max backoff in milliseconds, default is 2000.
+	MaxBackoff int `json:"max_backoff"`
+
+	// Breaker is the circuit breaker of the endpoint of the policy, or of each service
+	// for the service and default policy.
+	Breaker Breaker `json:"breaker"`
+}
+
+// Breaker is the circuit breaker which rejects the calls of the endpoint after it
+// failed consecutively, and lets a call through to probe it after a while.
+type Breaker struct {
+	// Failures is the number of the consecutive failures which open the breaker,
+	// 0 disables the breaker.
+	Failures int `json:"failures"`
+
+	// OpenTimeout is the duration in seconds which the breaker stays open before
+	// probing the endpoint, default is 10.
+	OpenTimeout int `json:"open_timeout"`
+}
+
+// RateLimit is the limits of the requests of the rpc service, the limit of an
+// endpoint is looked up like the policy of the Client, and the requests of the
+// endpoints sharing a limit share its rate and concurrency.
+type RateLimit struct {
+	Default   Limit            `json:"default"`
+	Endpoints map[string]Limit `json:"endpoints"`
+}
+
+// Limit is the limit of the requests.
+type Limit struct {
+	// Rate is the number of the requests permitted per second, -1 disables the
+	// rate limit and default is unlimited.
+	Rate float64 `json:"rate"`
+
+	// Burst is the number of the requests permitted at once, default is the rate
+	// rounded up.
+	Burst int `json:"burst"`
+
+	// Concurrency is the number of the concurrent requests permitted by an instance,
+	// -1 disables the concurrency limit and default is unlimited.
+	Concurrency int `json:"concurrency"`
+
+	// Distributed makes the instances of the service share the rate by redis, or
+	// else each instance permits the rate by itself.
+	Distributed bool `json:"distributed"`
+
+	// CallerKey is the metadata key of the caller, e.g. X-Caller, the requests are
+	// limited per caller when it's set, and the requests without it share a limit.
+	CallerKey string `json:"caller_key"`
+}
+
+// The algorithms of the jwt keys.
+const (
+	AuthAlgorithmHS256 = "HS256"
+	AuthAlgorithmHS384 = "HS384"
+	AuthAlgorithmHS512 = "HS512"
+	AuthAlgorithmRS256 = "RS256"
+	AuthAlgorithmRS384 = "RS384"
+	AuthAlgorithmRS512 = "RS512"
+	AuthAlgorithmES256 = "ES256"
+	AuthAlgorithmES384 = "ES384"
+	AuthAlgorithmES512 = "ES512"
+)
+
+// Auth is the authentication of the requests of the rpc and web services, which
+// carry the jwt of the user and the token of the calling service.
+type Auth struct {
+	// Keys are the keys verifying the jwt by its kid, and the key "" verifies the
+	// jwt without kid.
+	Keys map[string]AuthKey `json:"keys"`
+
+	// Issuer and Audience are checked against the claims of the jwt when they're set.
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+
+	// Leeway is the clock skew in seconds allowed when checking the jwt expiration.
+	Leeway int `json:"leeway"`
+
+	// Token is the token of the service, which is sent to the services it calls.
+	Token string `json:"token" secret:"true"`
+
+	// Services are the tokens of the services calling the service by their names.
+	Services map[string]ServiceToken `json:"services"`
+
+	// Required rejects the requests without the credentials, except the public
+	// ones. The requests with the invalid credentials are always rejected.
+	Required bool `json:"required"`
+
+	// Public are the patterns of the rpc endpoints or the web paths which don't
+	// require the credentials, e.g. *.Health.* and /health/*.
+	Public []string `json:"public"`
+}
+
+// AuthKey is the key verifying the jwt.
+type AuthKey struct {
+	// Algorithm is one of the AuthAlgorithmXxx.
+	Algorithm string `json:"algorithm"`
+
+	// Secret is the secret of the HMAC algorithms.
+	Secret string `json:"secret" secret:"true"`
+
+	// PublicKey is the PEM encoded public key of the RSA and ECDSA algorithms.
+	PublicKey string `json:"public_key"`
+}
+
+// ServiceToken is the token of the service.
+type ServiceToken struct {
+	Token string `json:"token" secret:"true"`
+}
+
+// Web is the config of the gin engine of the web service.
+type Web struct {
+	Cors Cors `json:"cors"`
+}
+
+// Cors is the CORS policy of the web service, which is disabled without the allowed
+// origins.
+type Cors struct {
+	// AllowOrigins are the origins allowed to request, e.g. https://example.com,
+	// and * allows any origin.
+	AllowOrigins []string `json:"allow_origins"`
+
+	// AllowMethods are the methods allowed by the preflight requests, default are
+	// GET, POST, PUT, PATCH, DELETE and HEAD.
+	AllowMethods []string `json:"allow_methods"`
+
+	// AllowHeaders are the headers allowed by the preflight requests, default are
+	// Origin, Content-Type, Authorization and X-Request-Id.
+	AllowHeaders []string `json:"allow_headers"`
+
+	// ExposeHeaders are the response headers exposed to the origins.
+	ExposeHeaders []string `json:"expose_headers"`
+
+	// AllowCredentials allows the requests with the cookies and the credentials,
+	// which can't be used with the origin *.
+	AllowCredentials bool `json:"allow_credentials"`
+
+	// MaxAge is the duration in seconds which the preflight responses are cached.
+	MaxAge int `json:"max_age"`
+}
+
 // Mysql ...
 type Mysql struct {
 	Dialect        string `json:"dialect"`
 	Database       string `json:"database"`
 	User           string `json:"user"`
-	Password       string `json:"password"`
+	Password       string `json:"password" secret:"true"`
 	Host           string `json:"host"`
 	Port           int    `json:"port"`
 	Charset        string `json:"charset"`
@@ -39,7 +216,7 @@ type Mysql struct {
 type Redis struct {
 	Host        string `json:"host"`
 	Port        int    `json:"port"`
-	Password    string `json:"password"`
+	Password    string `json:"password" secret:"true"`
 	MaxIdle     int    `json:"max_idle"`
 	MaxActive   int    `json:"max_active"`
 	IdleTimeout int    `json:"idle_timeout"`
@@ -47,11 +224,156 @@ type Redis struct {
 }
 
 // Jaeger ...
+// Host and Port are the UDP address of the jaeger agent, which the spans are sent
+// to unless the reporter sets the collector endpoint.
 type Jaeger struct {
 	Host string  `json:"host"`
 	Port int     `json:"port"`
 	Name string  `json:"name"`
 	Rate float64 `json:"rate"`
+
+	// Sampler is the sampler of the tracer, which is updated without restarting
+	// when it or Rate changed.
+	Sampler JaegerSampler `json:"sampler"`
+
+	// Reporter is the reporter of the spans.
+	Reporter JaegerReporter `json:"reporter"`
+
+	// Tags are the tags of the tracer, which are added to all the spans.
+	Tags map[string]string `json:"tags"`
+}
+
+// Jaeger sampler types.
+const (
+	JaegerSamplerConst         = "const"
+	JaegerSamplerProbabilistic = "probabilistic"
+	JaegerSamplerRateLimiting  = "ratelimiting"
+	JaegerSamplerRemote        = "remote"
+	JaegerSamplerPerOperation  = "per_operation"
+)
+
+// JaegerSampler decides which traces are sampled.
+type JaegerSampler struct {
+	// Type is the type of the sampler, default is probabilistic.
+	//
+	//	const          samples all the traces when Param is not 0, or none of them
+	//	probabilistic  samples the traces by Rate
+	//	ratelimiting   samples Param traces per second
+	//	remote         samples by the strategies of the sampling server, and by
+	//	               Rate before the strategies are fetched
+	//	per_operation  samples the operations by Operations, and the others by Rate
+	Type string `json:"type"`
+
+	// Param is the param of the const and ratelimiting sampler.
+	Param float64 `json:"param"`
+
+	// ServerUrl is the url of the sampling server of the remote sampler, default
+	// is the sampling endpoint of the jaeger agent at Host, e.g. http://host:5778/sampling.
+	ServerUrl string `json:"server_url"`
+
+	// RefreshInterval is the interval in seconds of the remote sampler polling the
+	// sampling server, default is 60.
+	RefreshInterval int `json:"refresh_interval"`
+
+	// MaxOperations is the max number of the operations sampled separately by the
+	// remote and per_operation sampler, default is 2000.
+	MaxOperations int `json:"max_operations"`
+
+	// Operations are the sampling rates of the operations of the per_operation sampler.
+	Operations map[string]float64 `json:"operations"`
+
+	// LowerBound is the min traces per second of each operation of the per_operation
+	// sampler, regardless of the sampling rates.
+	LowerBound float64 `json:"lower_bound"`
+}
+
+// JaegerReporter reports the finished spans.
+type JaegerReporter struct {
+	// QueueSize is the max number of the spans queued in memory, the new spans are
+	// dropped when the queue is full, default is 100.
+	QueueSize int `json:"queue_size"`
+
+	// FlushInterval is the interval in seconds of flushing the spans, default is 1.
+	FlushInterval int `json:"flush_interval"`
+
+	// LogSpans logs the reported spans.
+	LogSpans bool `json:"log_spans"`
+
+	// CollectorEndpoint is the http url of the jaeger collector which the spans are
+	// sent to instead of the agent, e.g. http://collector:14268/api/traces.
+	CollectorEndpoint string `json:"collector_endpoint"`
+
+	// User and Password are the basic auth of the collector.
+	User     string `json:"user"`
+	Password string `json:"password" secret:"true"`
+}
+
+// Tracing backends.
+const (
+	TracingBackendJaeger = "jaeger"
+	TracingBackendOtel   = "otel"
+)
+
+// Tracing is the backend of the tracing, the jaeger section is used when the
+// backend is jaeger.
+type Tracing struct {
+	// Backend is jaeger or otel, default is jaeger.
+	Backend string `json:"backend"`
+
+	// Name is the service name of the otel backend.
+	Name string `json:"name"`
+
+	// Rate is the sample rate of the root spans of the otel backend.
+	Rate float64 `json:"rate"`
+
+	// Otlp is the OTLP exporter of the otel backend.
+	Otlp Otlp `json:"otlp"`
+}
+
+// Otlp is the OTLP/HTTP exporter.
+type Otlp struct {
+	// Endpoint is the base url of the collector, e.g. http://localhost:4318, the
+	// spans are posted to its /v1/traces.
+	Endpoint string `json:"endpoint"`
+
+	// Headers are sent with the spans, e.g. the authorization, whose values are
+	// secrets and can be the secret references.
+	Headers map[string]string `json:"headers" secret:"true"`
+
+	// Timeout is the timeout in seconds of exporting the spans, default is 10.
+	Timeout int `json:"timeout"`
+}
+
+// Redaction is the policy of recording the payloads, e.g. the rpc requests and the
+// kafka messages, in the spans and logs. The field names are matched case-insensitively
+// regardless of the underscores and hyphens, e.g. access_token matches accessToken.
+type Redaction struct {
+	// DenyFields are the names of the fields whose values are masked, including the
+	// fields containing them, e.g. access_token contains token. Default is password,
+	// secret, token and authorization.
+	DenyFields []string `json:"deny_fields"`
+
+	// HashFields are the names of the PII fields whose values are replaced by their
+	// hashes, so they can be correlated but not read.
+	HashFields []string `json:"hash_fields"`
+
+	// HashKey is the HMAC key of hashing the PII fields, which are hashed by SHA-256
+	// without the key when it's empty.
+	HashKey string `json:"hash_key" secret:"true"`
+
+	// MaxPayloadBytes is the max bytes of a payload, the longer ones are truncated,
+	// default is 4096.
+	MaxPayloadBytes int `json:"max_payload_bytes"`
+
+	// OptOut are the patterns of the endpoints whose payloads are not recorded, which
+	// are matched case-insensitively by path.Match, default is *collection*. The
+	// endpoints are:
+	//
+	//	Service.Endpoint  the rpc endpoint
+	//	kafka:topic       the kafka topic
+	//	redis:key         the redis key without the prefix
+	//	mysql:table       the mysql table
+	OptOut []string `json:"opt_out"`
 }
 
 // Kafka ...
@@ -65,7 +387,7 @@ type DelayQueue struct {
 	Host      string `json:"host"`
 	Port      int    `json:"port"`
 	Namespace string `json:"namespace"`
-	Token     string `json:"token"`
+	Token     string `json:"token" secret:"true"`
 }
 
 // Cron ...
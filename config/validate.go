@@ -0,0 +1,511 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	cron "github.com/robfig/cron/v3"
+)
+
+// FieldError is the error of a config field.
+type FieldError struct {
+	// Field is the json path of the field, e.g. database.default.port.
+	Field string
+
+	// Message describes what's wrong with the field.
+	Message string
+}
+
+// Error ...
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError aggregates all the field errors of the config.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+// Error ...
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// add ...
+func (e *ValidationError) add(field string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, &FieldError{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns nil when there is no field error.
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate checks the values of the system config, and returns a *ValidationError
+// which reports every invalid field.
+func (c *SystemConfig) Validate() error {
+	return c.ValidateSections()
+}
+
+// ValidateSections checks the values of the given sections of the system config
+// like Validate, all the sections are checked when none is given.
+func (c *SystemConfig) ValidateSections(sections ...string) error {
+	checked := func(section string) bool {
+		if len(sections) == 0 {
+			return true
+		}
+		for _, s := range sections {
+			if s == section {
+				return true
+			}
+		}
+		return false
+	}
+
+	v := new(ValidationError)
+	if checked(SectionRegistry) {
+		c.Registry.validate(v, SectionRegistry)
+	}
+	if checked(SectionClient) {
+		c.Client.validate(v, SectionClient)
+	}
+	if checked(SectionRateLimit) {
+		c.RateLimit.validate(v, SectionRateLimit)
+	}
+	if checked(SectionAuth) {
+		c.Auth.validate(v, SectionAuth)
+	}
+	if checked(SectionWeb) {
+		c.Web.validate(v, SectionWeb)
+	}
+	if checked(SectionMysql) {
+		validateMysqls(v, SectionMysql, c.Mysql)
+	}
+	if checked(SectionRedis) {
+		c.Redis.validate(v, SectionRedis)
+	}
+	if checked(SectionJaeger) && c.Tracing.Backend != TracingBackendOtel {
+		c.Jaeger.validate(v, SectionJaeger)
+	}
+	if checked(SectionTracing) {
+		c.Tracing.validate(v, SectionTracing)
+	}
+	if checked(SectionRedaction) {
+		c.Redaction.validate(v, SectionRedaction)
+	}
+	if checked(SectionKafka) {
+		c.Kafka.validate(v, SectionKafka)
+	}
+	if checked(SectionDelayQueue) {
+		c.DelayQueue.validate(v, SectionDelayQueue)
+	}
+	if checked(SectionCron) {
+		c.Cron.validate(v, SectionCron)
+	}
+	return v.err()
+}
+
+// ParseSysConf decodes the json data of the system config strictly, the unknown
+// fields are reported, and validates the given sections of it like ValidateSections.
+// The secret references are not resolved.
+func ParseSysConf(data []byte, sections ...string) (*SystemConfig, error) {
+	conf, err := ParseSysConfLayer(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.ValidateSections(sections...); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// ParseSysConfLayer decodes the json data of a layer of the system config strictly
+// like ParseSysConf without validating it, since the layer may set a part of the
+// config only, e.g. the shared layer of the namespace.
+func ParseSysConfLayer(data []byte) (*SystemConfig, error) {
+	conf := new(SystemConfig)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// validate ...
+func (c *Registry) validate(v *ValidationError, field string) {
+	if c.Name == "" {
+		v.add(field+".name", "is required")
+	}
+	if c.Ttl < 0 {
+		v.add(field+".ttl", "must not be negative, got %d", c.Ttl)
+	}
+	if c.Interval < 0 {
+		v.add(field+".interval", "must not be negative, got %d", c.Interval)
+	}
+	if c.Ttl > 0 && c.Interval >= c.Ttl {
+		v.add(field+".interval", "must be less than ttl %d, got %d", c.Ttl, c.Interval)
+	}
+}
+
+// validate ...
+func (c *Client) validate(v *ValidationError, field string) {
+	c.Default.validate(v, field+".default")
+	names := make([]string, 0, len(c.Endpoints))
+	for name := range c.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := c.Endpoints[name]
+		p.validate(v, field+".endpoints."+name)
+	}
+}
+
+// validate ...
+func (c *ClientPolicy) validate(v *ValidationError, field string) {
+	if c.Timeout < 0 {
+		v.add(field+".timeout", "must not be negative, got %d", c.Timeout)
+	}
+	if c.Retries < -1 {
+		v.add(field+".retries", "must not be less than -1, got %d", c.Retries)
+	}
+	if c.Backoff < 0 {
+		v.add(field+".backoff", "must not be negative, got %d", c.Backoff)
+	}
+	if c.MaxBackoff < 0 {
+		v.add(field+".max_backoff", "must not be negative, got %d", c.MaxBackoff)
+	}
+	if c.Breaker.Failures < 0 {
+		v.add(field+".breaker.failures", "must not be negative, got %d", c.Breaker.Failures)
+	}
+	if c.Breaker.OpenTimeout < 0 {
+		v.add(field+".breaker.open_timeout", "must not be negative, got %d", c.Breaker.OpenTimeout)
+	}
+}
+
+// validate ...
+func (c *RateLimit) validate(v *ValidationError, field string) {
+	c.Default.validate(v, field+".default")
+	names := make([]string, 0, len(c.Endpoints))
+	for name := range c.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		l := c.Endpoints[name]
+		l.validate(v, field+".endpoints."+name)
+	}
+}
+
+// validate ...
+func (c *Limit) validate(v *ValidationError, field string) {
+	if c.Rate < 0 && c.Rate != -1 {
+		v.add(field+".rate", "must not be negative except -1, got %v", c.Rate)
+	}
+	if c.Burst < 0 {
+		v.add(field+".burst", "must not be negative, got %d", c.Burst)
+	}
+	if c.Concurrency < -1 {
+		v.add(field+".concurrency", "must not be less than -1, got %d", c.Concurrency)
+	}
+}
+
+// validate ...
+func (c *Auth) validate(v *ValidationError, field string) {
+	kids := make([]string, 0, len(c.Keys))
+	for kid := range c.Keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	for _, kid := range kids {
+		k := c.Keys[kid]
+		k.validate(v, field+".keys."+kid)
+	}
+	if c.Leeway < 0 {
+		v.add(field+".leeway", "must not be negative, got %d", c.Leeway)
+	}
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tokens := make(map[string]string, len(names))
+	for _, name := range names {
+		token := c.Services[name].Token
+		if token == "" {
+			v.add(field+".services."+name+".token", "is required")
+			continue
+		}
+		if other, ok := tokens[token]; ok {
+			v.add(field+".services."+name+".token", "must not be the same as the token of %s", other)
+		}
+		tokens[token] = name
+	}
+	if c.Required && len(c.Keys) == 0 && len(c.Services) == 0 {
+		v.add(field+".required", "requires the keys or the services")
+	}
+	for i, pattern := range c.Public {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(fmt.Sprintf("%s.public[%d]", field, i), "is invalid, %s", err.Error())
+		}
+	}
+}
+
+// validate ...
+func (c *AuthKey) validate(v *ValidationError, field string) {
+	switch c.Algorithm {
+	case AuthAlgorithmHS256, AuthAlgorithmHS384, AuthAlgorithmHS512:
+		if c.Secret == "" {
+			v.add(field+".secret", "is required by %s", c.Algorithm)
+		}
+	case AuthAlgorithmRS256, AuthAlgorithmRS384, AuthAlgorithmRS512,
+		AuthAlgorithmES256, AuthAlgorithmES384, AuthAlgorithmES512:
+		if c.PublicKey == "" {
+			v.add(field+".public_key", "is required by %s", c.Algorithm)
+		}
+	default:
+		v.add(field+".algorithm", "must be one of HS256, HS384, HS512, RS256, RS384, RS512, ES256, ES384 and ES512, got %q", c.Algorithm)
+	}
+}
+
+// validate ...
+func (c *Web) validate(v *ValidationError, field string) {
+	c.Cors.validate(v, field+".cors")
+}
+
+// validate ...
+func (c *Cors) validate(v *ValidationError, field string) {
+	for i, origin := range c.AllowOrigins {
+		if origin == "" {
+			v.add(fmt.Sprintf("%s.allow_origins[%d]", field, i), "must not be empty")
+		}
+		if origin == "*" && c.AllowCredentials {
+			v.add(fmt.Sprintf("%s.allow_origins[%d]", field, i), "must not be * when allow_credentials is true")
+		}
+	}
+	if c.MaxAge < 0 {
+		v.add(field+".max_age", "must not be negative, got %d", c.MaxAge)
+	}
+}
+
+// validateMysqls ...
+func validateMysqls(v *ValidationError, field string, mysqls map[string]Mysql) {
+	if _, ok := mysqls["default"]; !ok {
+		v.add(field+".default", "is required")
+	}
+	names := make([]string, 0, len(mysqls))
+	for name := range mysqls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := mysqls[name]
+		c.validate(v, field+"."+name)
+	}
+}
+
+// validate ...
+func (c *Mysql) validate(v *ValidationError, field string) {
+	if c.Dialect == "" {
+		v.add(field+".dialect", "is required")
+	}
+	if c.Database == "" {
+		v.add(field+".database", "is required")
+	}
+	if c.User == "" {
+		v.add(field+".user", "is required")
+	}
+	validateAddress(v, field, c.Host, c.Port)
+	if c.MaxIdleConnNum < 0 {
+		v.add(field+".max_idle_conn_num", "must not be negative, got %d", c.MaxIdleConnNum)
+	}
+	if c.MaxOpenConnNum < 0 {
+		v.add(field+".max_open_conn_num", "must not be negative, got %d", c.MaxOpenConnNum)
+	}
+	if c.MaxOpenConnNum > 0 && c.MaxIdleConnNum > c.MaxOpenConnNum {
+		v.add(field+".max_idle_conn_num", "must not be greater than max_open_conn_num %d, got %d", c.MaxOpenConnNum, c.MaxIdleConnNum)
+	}
+}
+
+// validate ...
+func (c *Redis) validate(v *ValidationError, field string) {
+	validateAddress(v, field, c.Host, c.Port)
+	if c.MaxIdle < 0 {
+		v.add(field+".max_idle", "must not be negative, got %d", c.MaxIdle)
+	}
+	if c.MaxActive < 0 {
+		v.add(field+".max_active", "must not be negative, got %d", c.MaxActive)
+	}
+	if c.IdleTimeout < 0 {
+		v.add(field+".idle_timeout", "must not be negative, got %d", c.IdleTimeout)
+	}
+}
+
+// validate ...
+func (c *Jaeger) validate(v *ValidationError, field string) {
+	if c.Name == "" {
+		v.add(field+".name", "is required")
+	}
+	// the agent is needed unless both the spans and the sampling strategies are
+	// sent to somewhere else.
+	if c.Reporter.CollectorEndpoint == "" || (c.Sampler.Type == JaegerSamplerRemote && c.Sampler.ServerUrl == "") {
+		validateAddress(v, field, c.Host, c.Port)
+	}
+	if c.Rate < 0 || c.Rate > 1 {
+		v.add(field+".rate", "must be between 0 and 1, got %v", c.Rate)
+	}
+	c.Sampler.validate(v, field+".sampler")
+	c.Reporter.validate(v, field+".reporter")
+}
+
+// validate ...
+func (c *JaegerSampler) validate(v *ValidationError, field string) {
+	switch c.Type {
+	case "", JaegerSamplerConst, JaegerSamplerProbabilistic, JaegerSamplerRemote:
+	case JaegerSamplerRateLimiting:
+		if c.Param <= 0 {
+			v.add(field+".param", "must be positive, got %v", c.Param)
+		}
+	case JaegerSamplerPerOperation:
+		ops := make([]string, 0, len(c.Operations))
+		for op := range c.Operations {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		for _, op := range ops {
+			if rate := c.Operations[op]; rate < 0 || rate > 1 {
+				v.add(field+".operations."+op, "must be between 0 and 1, got %v", rate)
+			}
+		}
+		if c.LowerBound < 0 {
+			v.add(field+".lower_bound", "must not be negative, got %v", c.LowerBound)
+		}
+	default:
+		v.add(field+".type", "must be one of %s, got %q", strings.Join([]string{
+			JaegerSamplerConst, JaegerSamplerProbabilistic, JaegerSamplerRateLimiting,
+			JaegerSamplerRemote, JaegerSamplerPerOperation,
+		}, ", "), c.Type)
+	}
+	if c.RefreshInterval < 0 {
+		v.add(field+".refresh_interval", "must not be negative, got %d", c.RefreshInterval)
+	}
+	if c.MaxOperations < 0 {
+		v.add(field+".max_operations", "must not be negative, got %d", c.MaxOperations)
+	}
+}
+
+// validate ...
+func (c *JaegerReporter) validate(v *ValidationError, field string) {
+	if c.QueueSize < 0 {
+		v.add(field+".queue_size", "must not be negative, got %d", c.QueueSize)
+	}
+	if c.FlushInterval < 0 {
+		v.add(field+".flush_interval", "must not be negative, got %d", c.FlushInterval)
+	}
+}
+
+// validate ...
+func (c *Tracing) validate(v *ValidationError, field string) {
+	switch c.Backend {
+	case "", TracingBackendJaeger:
+	case TracingBackendOtel:
+		if c.Name == "" {
+			v.add(field+".name", "is required")
+		}
+		if c.Rate < 0 || c.Rate > 1 {
+			v.add(field+".rate", "must be between 0 and 1, got %v", c.Rate)
+		}
+		if c.Otlp.Endpoint == "" {
+			v.add(field+".otlp.endpoint", "is required")
+		} else if u, err := url.Parse(c.Otlp.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(field+".otlp.endpoint", "must be the http or https url, got %s", c.Otlp.Endpoint)
+		}
+		if c.Otlp.Timeout < 0 {
+			v.add(field+".otlp.timeout", "must not be negative, got %d", c.Otlp.Timeout)
+		}
+	default:
+		v.add(field+".backend", "must be %s or %s, got %q", TracingBackendJaeger, TracingBackendOtel, c.Backend)
+	}
+}
+
+// validate ...
+func (c *Redaction) validate(v *ValidationError, field string) {
+	if c.MaxPayloadBytes < 0 {
+		v.add(field+".max_payload_bytes", "must not be negative, got %d", c.MaxPayloadBytes)
+	}
+	for i, pattern := range c.OptOut {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(fmt.Sprintf("%s.opt_out[%d]", field, i), "is invalid, %s", err.Error())
+		}
+	}
+}
+
+// validate ...
+func (c *Kafka) validate(v *ValidationError, field string) {
+	if len(c.Addrs) == 0 {
+		v.add(field+".addrs", "is required")
+	}
+	for i, addr := range c.Addrs {
+		if addr == "" {
+			v.add(fmt.Sprintf("%s.addrs[%d]", field, i), "must not be empty")
+		}
+	}
+	if c.Version == "" {
+		v.add(field+".version", "is required")
+	}
+}
+
+// validate ...
+func (c *DelayQueue) validate(v *ValidationError, field string) {
+	// the delay queue is optional.
+	if c.Host == "" && c.Port == 0 {
+		return
+	}
+	validateAddress(v, field, c.Host, c.Port)
+}
+
+// validate ...
+func (c *Cron) validate(v *ValidationError, field string) {
+	names := make(map[string]bool, len(c.Spec))
+	for i, spec := range c.Spec {
+		specField := fmt.Sprintf("%s.spec[%d]", field, i)
+		if spec.Name == "" {
+			v.add(specField+".name", "is required")
+		} else if names[spec.Name] {
+			v.add(specField+".name", "is duplicated, got %s", spec.Name)
+		}
+		names[spec.Name] = true
+		if _, err := cron.ParseStandard(spec.Schedule); err != nil {
+			v.add(specField+".schedule", "is invalid, %s", err.Error())
+		}
+		if spec.Parallelism < 0 {
+			v.add(specField+".parallelism", "must not be negative, got %d", spec.Parallelism)
+		}
+	}
+}
+
+// validateAddress ...
+func validateAddress(v *ValidationError, field string, host string, port int) {
+	if host == "" {
+		v.add(field+".host", "is required")
+	}
+	if port <= 0 || port > 65535 {
+		v.add(field+".port", "must be between 1 and 65535, got %d", port)
+	}
+}
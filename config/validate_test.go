@@ -0,0 +1,150 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validSysConf is the system config whose every section is valid.
+const validSysConf = `{
+	"registry": {"name": "app", "ttl": 30, "interval": 15},
+	"database": {"default": {"dialect": "mysql", "database": "app", "user": "app", "host": "127.0.0.1", "port": 3306}},
+	"redis": {"host": "127.0.0.1", "port": 6379},
+	"jaeger": {"name": "app", "host": "127.0.0.1", "port": 6831, "rate": 1},
+	"kafka": {"addrs": ["127.0.0.1:9092"], "version": "2.0.0"},
+	"cron": {"spec": [{"name": "job", "schedule": "*/5 * * * *"}]}
+}`
+
+func TestParseSysConf(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		sections []string
+		wantErrs []string
+	}{
+		{name: "valid", data: validSysConf},
+		{
+			name:     "unknown field",
+			data:     `{"registry": {"nmae": "app"}}`,
+			wantErrs: []string{`unknown field "nmae"`},
+		},
+		{
+			name:     "type error",
+			data:     `{"redis": {"port": "6379"}}`,
+			wantErrs: []string{"cannot unmarshal string"},
+		},
+		{
+			name: "every field error",
+			data: `{"registry": {"ttl": 10, "interval": 10}, "redis": {"port": 70000}}`,
+			wantErrs: []string{
+				"registry.name: is required",
+				"registry.interval: must be less than ttl 10, got 10",
+				"database.default: is required",
+				"redis.host: is required",
+				"redis.port: must be between 1 and 65535, got 70000",
+				"kafka.addrs: is required",
+			},
+		},
+		{
+			name:     "given sections",
+			data:     `{"registry": {"name": "app"}, "redis": {"port": 70000}}`,
+			sections: []string{SectionRegistry, SectionKafka},
+			wantErrs: []string{"kafka.addrs: is required", "kafka.version: is required"},
+		},
+		{
+			name:     "sections of other fields",
+			data:     `{"registry": {"name": "app"}, "redis": {"port": 70000}}`,
+			sections: []string{SectionRegistry, SectionCron},
+		},
+		{
+			name:     "cors",
+			data:     `{"web": {"cors": {"allow_origins": ["", "*"], "allow_credentials": true, "max_age": -1}}}`,
+			sections: []string{SectionWeb},
+			wantErrs: []string{
+				"web.cors.allow_origins[0]: must not be empty",
+				"web.cors.allow_origins[1]: must not be * when allow_credentials is true",
+				"web.cors.max_age: must not be negative, got -1",
+			},
+		},
+		{
+			name:     "otel backend skips jaeger",
+			data:     `{"tracing": {"backend": "otel", "name": "app", "otlp": {"endpoint": "http://collector:4318"}}}`,
+			sections: []string{SectionJaeger, SectionTracing},
+		},
+		{
+			name:     "cron",
+			data:     `{"cron": {"spec": [{"name": "job", "schedule": "* * *"}, {"name": "job", "schedule": "@daily", "parallelism": -1}]}}`,
+			sections: []string{SectionCron},
+			wantErrs: []string{
+				"cron.spec[0].schedule: is invalid",
+				"cron.spec[1].name: is duplicated, got job",
+				"cron.spec[1].parallelism: must not be negative, got -1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := ParseSysConf([]byte(tt.data), tt.sections...)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("ParseSysConf = %v, want nil", err)
+				}
+				if conf == nil {
+					t.Fatal("ParseSysConf returns nil config")
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ParseSysConf = nil, want %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("ParseSysConf = %q, want it to contain %q", err.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSectionsReportsFields(t *testing.T) {
+	conf := &SystemConfig{Redis: Redis{Port: 6379, MaxIdle: -1}}
+	err := conf.ValidateSections(SectionRedis)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("ValidateSections = %v, want *ValidationError", err)
+	}
+	var fields []string
+	for _, fieldErr := range verr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	if want := []string{"redis.host", "redis.max_idle"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+}
+
+func TestParseSysConfLayer(t *testing.T) {
+	if _, err := ParseSysConfLayer([]byte(`{"redis": {"host": "127.0.0.1"}}`)); err != nil {
+		t.Errorf("ParseSysConfLayer of the partial layer = %v, want nil", err)
+	}
+	if _, err := ParseSysConfLayer([]byte(`{"reids": {}}`)); err == nil {
+		t.Error("ParseSysConfLayer of the unknown field = nil, want error")
+	}
+}
+
+func TestMergeLayers(t *testing.T) {
+	shared := `{"redis": {"host": "shared", "port": 6379}, "kafka": {"addrs": ["a", "b"]}}`
+	app := `{"redis": {"host": "app"}, "kafka": {"addrs": ["c"]}, "registry": {"name": "app"}}`
+	data, err := MergeLayers([]byte(shared), []byte(_EmptyConf), []byte(app))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	_ = json.Unmarshal(data, &got)
+	// the objects are merged deeply, and the arrays are replaced.
+	_ = json.Unmarshal([]byte(`{"redis": {"host": "app", "port": 6379}, "kafka": {"addrs": ["c"]}, "registry": {"name": "app"}}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeLayers = %s", data)
+	}
+}
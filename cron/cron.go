@@ -3,17 +3,18 @@ package cron
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 
-	microTracing "github.com/micro/go-plugins/wrapper/trace/opentracing/v2"
-	"github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
 	cron "github.com/robfig/cron/v3"
 
 	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/tracing"
 )
 
 // shutdownSignal is the os signal what's need exit the exec gracefully.
@@ -29,11 +30,25 @@ type Cron struct {
 	// jobs is the task list of the cron.
 	jobs map[string]*Job
 
-	// cfg is the config if the cron.
-	cfg *config.SystemConfig
+	// cfg is the config of the cron, which is updated when the config changed.
+	cfg config.Cron
+
+	// mu protects cfg.
+	mu sync.RWMutex
+
+	// exit is closed when the cron is stopped.
+	exit     chan struct{}
+	stopOnce sync.Once
+
+	// scheduleMu is held while scheduling the jobs, so that the cron isn't started
+	// again after stopped.
+	scheduleMu sync.Mutex
 
 	// context ...
 	ctx context.Context
+
+	// tracer is the tracer of the jobs, the global tracer is used when it's nil.
+	tracer tracing.Tracer
 }
 
 type Job struct {
@@ -50,18 +65,50 @@ type Job struct {
 // JobFn is the function of the job.
 type JobFn func(ctx context.Context)
 
+// CronOptions ...
+type CronOptions func(*CronOption)
+
+// CronOption ...
+type CronOption struct {
+	tracer tracing.Tracer
+}
+
+// SetCronTracer sets the tracer of the jobs, default is the global tracer.
+func SetCronTracer(tracer tracing.Tracer) CronOptions {
+	return func(o *CronOption) {
+		o.tracer = tracer
+	}
+}
+
 // NewCron ...
-func NewCron(ctx context.Context, cfg *config.SystemConfig) *Cron {
-	return &Cron{
+func NewCron(ctx context.Context, cfg *config.SystemConfig, opts ...CronOptions) *Cron {
+	o := new(CronOption)
+	for _, opt := range opts {
+		opt(o)
+	}
+	c := &Cron{
 		cr: cron.New(cron.WithChain(
 			//注入此函数是为了防并发
 			cron.SkipIfStillRunning(cron.DefaultLogger),
 		)),
 		jobs: make(map[string]*Job),
-		cfg:  cfg,
+		cfg:  cfg.Cron,
+		exit: make(chan struct{}),
 
-		ctx: ctx,
+		ctx:    ctx,
+		tracer: o.tracer,
 	}
+
+	return c
+}
+
+// SetConfig replaces the config of the cron, the jobs are rescheduled by the new
+// specs within a second.
+func (c *Cron) SetConfig(cfg config.Cron) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cfg = cfg
 }
 
 // Register ...
@@ -75,7 +122,7 @@ func (c *Cron) Register(jobName string, jobFn JobFn) {
 // Run run the cron. It has completed watching c.ctx.Done() and four os signals what are
 // syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL for exiting gracfully
 func (c *Cron) Run() {
-	go c.run()
+	c.Start()
 
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, shutdownSignal...)
@@ -84,75 +131,152 @@ func (c *Cron) Run() {
 	case <-c.ctx.Done():
 	}
 
-	<-c.cr.Stop().Done()
+	<-c.Stop().Done()
+}
+
+// Start schedules the jobs by the config without blocking.
+func (c *Cron) Start() {
+	go c.run()
+}
+
+// Stop stops scheduling the jobs, and returns a context which is done when the
+// running jobs have completed.
+func (c *Cron) Stop() context.Context {
+	c.stopOnce.Do(func() {
+		close(c.exit)
+	})
+
+	c.scheduleMu.Lock()
+	defer c.scheduleMu.Unlock()
+	return c.cr.Stop()
 }
 
 // run ...
 func (c *Cron) run() {
 	for {
-		newSpecs := c.getSpecsFromCfg()
+		c.schedule()
 
-		for k, v := range c.jobs {
-			name, job := k, v
-			newSpec := newSpecs[name]
+		select {
+		case <-c.exit:
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
 
-			if !c.verifySpec(newSpec) {
-				continue
-			}
-			if c.equalSpec(job.spec, newSpec) {
-				continue
-			}
+// schedule reschedules the jobs whose spec changed.
+func (c *Cron) schedule() {
+	c.scheduleMu.Lock()
+	defer c.scheduleMu.Unlock()
 
-			for _, id := range job.entryIds {
-				c.cr.Remove(id)
-			}
-			job.entryIds = []cron.EntryID{}
+	select {
+	case <-c.exit:
+		return
+	default:
+	}
 
-			if newSpec.Suspend {
-				job.spec = newSpec
-				continue
-			}
+	newSpecs := c.getSpecsFromCfg()
 
-			cmd := func() {
-				ctx, span, _ := microTracing.StartSpanFromContext(context.Background(), opentracing.GlobalTracer(), "cron: "+name)
-				defer span.Finish()
-				sepc, _ := json.Marshal(job.spec)
-				span.LogKV("spec", string(sepc))
+	for k, v := range c.jobs {
+		name, job := k, v
+		newSpec := newSpecs[name]
 
-				defer func() {
-					if e := recover(); e != nil {
-						span.SetTag("job.result", "fail")
-						ext.Error.Set(span, true)
-						span.LogKV("err", e.(string))
-					}
-				}()
+		if !c.verifySpec(newSpec) {
+			continue
+		}
+		if c.equalSpec(job.spec, newSpec) {
+			continue
+		}
 
-				job.fn(ctx)
+		for _, id := range job.entryIds {
+			c.cr.Remove(id)
+		}
+		job.entryIds = []cron.EntryID{}
 
-				span.SetTag("job.result", "success")
-			}
+		if newSpec.Suspend {
+			job.spec = newSpec
+			continue
+		}
 
-			for i := 0; i < newSpec.Parallelism; i++ {
-				entryId, err := c.cr.AddFunc(newSpec.Schedule, cmd)
-				if err != nil {
-					continue
+		cmd := func() {
+			ctx, span := tracing.StartSpan(tracing.NewContext(context.Background(), c.tracer), "cron: "+name)
+			defer span.Finish()
+			sepc, _ := json.Marshal(job.spec)
+			span.LogKV("spec", string(sepc))
+
+			begin := time.Now()
+			defer func() {
+				if e := recover(); e != nil {
+					span.SetTag("job.result", "fail")
+					span.SetError(fmt.Errorf("%v", e))
+					observeJob(name, "fail", time.Since(begin).Seconds())
 				}
-				job.entryIds = append(job.entryIds, entryId)
-			}
+			}()
 
-			job.spec = newSpec
+			job.fn(ctx)
 
-			c.cr.Start()
+			span.SetTag("job.result", "success")
+			observeJob(name, "success", time.Since(begin).Seconds())
 		}
 
-		time.Sleep(1 * time.Second)
+		for i := 0; i < newSpec.Parallelism; i++ {
+			entryId, err := c.cr.AddFunc(newSpec.Schedule, cmd)
+			if err != nil {
+				continue
+			}
+			job.entryIds = append(job.entryIds, entryId)
+		}
+
+		job.spec = newSpec
+
+		c.cr.Start()
 	}
 }
 
+// JobInfo is the schedule of a registered job.
+type JobInfo struct {
+	Name        string      `json:"name"`
+	Schedule    string      `json:"schedule"`
+	Suspend     bool        `json:"suspend"`
+	Parallelism int         `json:"parallelism"`
+	Next        []time.Time `json:"next"`
+	Prev        []time.Time `json:"prev"`
+}
+
+// Jobs returns the schedules of the registered jobs, the job whose spec is not
+// configured has no schedule.
+func (c *Cron) Jobs() []*JobInfo {
+	c.scheduleMu.Lock()
+	defer c.scheduleMu.Unlock()
+
+	infos := make([]*JobInfo, 0, len(c.jobs))
+	for name, job := range c.jobs {
+		info := &JobInfo{
+			Name:        name,
+			Schedule:    job.spec.Schedule,
+			Suspend:     job.spec.Suspend,
+			Parallelism: job.spec.Parallelism,
+		}
+		for _, id := range job.entryIds {
+			entry := c.cr.Entry(id)
+			info.Next = append(info.Next, entry.Next)
+			info.Prev = append(info.Prev, entry.Prev)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
 // getSpecsFromCfg ...
 func (c *Cron) getSpecsFromCfg() map[string]*config.CronSpec {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	specs := make(map[string]*config.CronSpec)
-	for _, v := range c.cfg.Cron.Spec {
+	for _, v := range c.cfg.Spec {
 		spec := &config.CronSpec{
 			Name:        v.Name,
 			Schedule:    v.Schedule,
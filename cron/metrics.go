@@ -0,0 +1,39 @@
+package cron
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	_MetricsNamespace = "pi"
+	_MetricsSubsystem = "cron"
+)
+
+var (
+	// jobRuns is the number of the job runs by result.
+	jobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "job_runs_total",
+		Help:      "The number of the job runs.",
+	}, []string{"job", "result"})
+
+	// jobDuration is the duration of the job runs.
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "job_duration_seconds",
+		Help:      "The duration of the job runs.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"job"})
+)
+
+func init() {
+	prometheus.MustRegister(jobRuns, jobDuration)
+}
+
+// observeJob ...
+func observeJob(job, result string, seconds float64) {
+	jobRuns.WithLabelValues(job, result).Inc()
+	jobDuration.WithLabelValues(job).Observe(seconds)
+}
@@ -3,6 +3,10 @@ package daemon
 import (
 	"context"
 	"math"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shelton-hu/nb/goroutine"
@@ -35,12 +39,22 @@ type Daemon struct {
 	// daemonFuncs is the functions which registered into here.
 	daemonFuncs []*DaemonFunc
 
+	// exit is closed when the daemon is stopped.
+	exit     chan struct{}
+	stopOnce sync.Once
+
 	// context ...
 	ctx context.Context
 }
 
 // DaemonFunc ...
 type DaemonFunc struct {
+	// name is the function name of fn.
+	name string
+
+	// restarts is the number of the restarts of fn.
+	restarts int64
+
 	// fn is the function body of DaemonFunc.
 	fn interface{}
 
@@ -54,6 +68,7 @@ func NewDaemon(ctx context.Context) *Daemon {
 		baseDuration:    _BaseDuration,
 		maxRetryIndex:   _MaxRetryIndex,
 		recountDuration: _RecountDuration,
+		exit:            make(chan struct{}),
 
 		ctx: ctx,
 	}
@@ -77,16 +92,20 @@ func (d *Daemon) SetRecountDuration(recountDuration time.Duration) {
 // Register ...
 func (d *Daemon) Register(function interface{}, args ...interface{}) {
 	d.daemonFuncs = append(d.daemonFuncs, &DaemonFunc{
+		name: funcName(function),
 		fn:   function,
 		args: args,
 	})
 }
 
 // Run ...
-// Which will block.
+// Which will block until the daemon is stopped or its context is done.
 func (d *Daemon) Run() {
 	d.run()
-	select {}
+	select {
+	case <-d.exit:
+	case <-d.ctx.Done():
+	}
 }
 
 // RunWithoutBlock ...
@@ -95,6 +114,31 @@ func (d *Daemon) RunWithoutBlock() {
 	d.run()
 }
 
+// DaemonStat is the stat of a daemon function.
+type DaemonStat struct {
+	Name     string `json:"name"`
+	Restarts int64  `json:"restarts"`
+}
+
+// Stats returns the stats of the registered daemon functions.
+func (d *Daemon) Stats() []*DaemonStat {
+	stats := make([]*DaemonStat, 0, len(d.daemonFuncs))
+	for _, daemonFunc := range d.daemonFuncs {
+		stats = append(stats, &DaemonStat{
+			Name:     daemonFunc.name,
+			Restarts: atomic.LoadInt64(&daemonFunc.restarts),
+		})
+	}
+	return stats
+}
+
+// Stop stops restarting the daemon functions, the running ones are not interrupted.
+func (d *Daemon) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.exit)
+	})
+}
+
 // run ...
 func (d *Daemon) run() {
 	for i := range d.daemonFuncs {
@@ -113,10 +157,31 @@ func (d *Daemon) run() {
 				}
 
 				sleepDuration := d.baseDuration * time.Duration(math.Pow(2, math.Min(float64(count), float64(d.maxRetryIndex))))
-				time.Sleep(sleepDuration)
+				select {
+				case <-d.exit:
+					return
+				case <-time.After(sleepDuration):
+				}
 
 				count++
+				atomic.AddInt64(&daemonFunc.restarts, 1)
+				restarts.WithLabelValues(daemonFunc.name).Inc()
 			}
 		}(d, i)
 	}
 }
+
+// funcName returns the name of the function.
+func funcName(function interface{}) string {
+	v := reflect.ValueOf(function)
+	if !v.IsValid() {
+		return "nil"
+	}
+	if v.Kind() != reflect.Func {
+		return v.Type().String()
+	}
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return v.Type().String()
+}
@@ -0,0 +1,22 @@
+package daemon
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	_MetricsNamespace = "pi"
+	_MetricsSubsystem = "daemon"
+)
+
+// restarts is the number of the daemon function restarts.
+var restarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: _MetricsNamespace,
+	Subsystem: _MetricsSubsystem,
+	Name:      "restarts_total",
+	Help:      "The number of the daemon function restarts.",
+}, []string{"func"})
+
+func init() {
+	prometheus.MustRegister(restarts)
+}
@@ -0,0 +1,290 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"net/http"
+
+	microErrors "github.com/micro/go-micro/v2/errors"
+)
+
+// Code is the code of the error, which is the canonical gRPC code name.
+type Code string
+
+// The codes of the errors.
+const (
+	OK                 Code = "OK"
+	Canceled           Code = "CANCELED"
+	Unknown            Code = "UNKNOWN"
+	InvalidArgument    Code = "INVALID_ARGUMENT"
+	DeadlineExceeded   Code = "DEADLINE_EXCEEDED"
+	NotFound           Code = "NOT_FOUND"
+	AlreadyExists      Code = "ALREADY_EXISTS"
+	PermissionDenied   Code = "PERMISSION_DENIED"
+	ResourceExhausted  Code = "RESOURCE_EXHAUSTED"
+	FailedPrecondition Code = "FAILED_PRECONDITION"
+	Aborted            Code = "ABORTED"
+	OutOfRange         Code = "OUT_OF_RANGE"
+	Unimplemented      Code = "UNIMPLEMENTED"
+	Internal           Code = "INTERNAL"
+	Unavailable        Code = "UNAVAILABLE"
+	DataLoss           Code = "DATA_LOSS"
+	Unauthenticated    Code = "UNAUTHENTICATED"
+)
+
+const (
+	// _StatusClientClosedRequest is the non-standard http status of the canceled
+	// requests.
+	_StatusClientClosedRequest = 499
+
+	// _MicroClientId is the id of the errors returned by the go-micro client.
+	_MicroClientId = "go.micro.client"
+)
+
+// codeStatus is the http status of the codes.
+var codeStatus = map[Code]int{
+	OK:                 http.StatusOK,
+	Canceled:           _StatusClientClosedRequest,
+	Unknown:            http.StatusInternalServerError,
+	InvalidArgument:    http.StatusBadRequest,
+	DeadlineExceeded:   http.StatusGatewayTimeout,
+	NotFound:           http.StatusNotFound,
+	AlreadyExists:      http.StatusConflict,
+	PermissionDenied:   http.StatusForbidden,
+	ResourceExhausted:  http.StatusTooManyRequests,
+	FailedPrecondition: http.StatusBadRequest,
+	Aborted:            http.StatusConflict,
+	OutOfRange:         http.StatusBadRequest,
+	Unimplemented:      http.StatusNotImplemented,
+	Internal:           http.StatusInternalServerError,
+	Unavailable:        http.StatusServiceUnavailable,
+	DataLoss:           http.StatusInternalServerError,
+	Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus returns the http status of the code, which is 500 for the unknown codes.
+func (c Code) HTTPStatus() int {
+	if status, ok := codeStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Retriable returns true when the calls failed with the code may succeed by retrying.
+func (c Code) Retriable() bool {
+	switch c {
+	case DeadlineExceeded, ResourceExhausted, Aborted, Unavailable:
+		return true
+	}
+	return false
+}
+
+// Error is the error returned by the handlers, which is propagated to the clients
+// with its code, message, details and retriable flag.
+type Error struct {
+	Code      Code              `json:"code"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+	Retriable bool              `json:"retriable"`
+}
+
+// New returns the error of the code, which is retriable by the default of the code.
+func New(code Code, format string, a ...interface{}) *Error {
+	return &Error{
+		Code:      code,
+		Message:   fmt.Sprintf(format, a...),
+		Retriable: code.Retriable(),
+	}
+}
+
+// Error ...
+func (e *Error) Error() string {
+	if len(e.Details) == 0 {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s %v", e.Code, e.Message, e.Details)
+}
+
+// WithDetail returns the copy of the error with the detail added.
+func (e *Error) WithDetail(key, value string) *Error {
+	newErr := *e
+	newErr.Details = make(map[string]string, len(e.Details)+1)
+	for k, v := range e.Details {
+		newErr.Details[k] = v
+	}
+	newErr.Details[key] = value
+	return &newErr
+}
+
+// WithRetriable returns the copy of the error with the retriable flag.
+func (e *Error) WithRetriable(retriable bool) *Error {
+	newErr := *e
+	newErr.Retriable = retriable
+	return &newErr
+}
+
+// HTTPStatus returns the http status of the error.
+func (e *Error) HTTPStatus() int {
+	return e.Code.HTTPStatus()
+}
+
+// The constructors of the errors of the codes.
+
+// InvalidArgumentf ...
+func InvalidArgumentf(format string, a ...interface{}) *Error {
+	return New(InvalidArgument, format, a...)
+}
+
+// NotFoundf ...
+func NotFoundf(format string, a ...interface{}) *Error {
+	return New(NotFound, format, a...)
+}
+
+// AlreadyExistsf ...
+func AlreadyExistsf(format string, a ...interface{}) *Error {
+	return New(AlreadyExists, format, a...)
+}
+
+// PermissionDeniedf ...
+func PermissionDeniedf(format string, a ...interface{}) *Error {
+	return New(PermissionDenied, format, a...)
+}
+
+// Unauthenticatedf ...
+func Unauthenticatedf(format string, a ...interface{}) *Error {
+	return New(Unauthenticated, format, a...)
+}
+
+// ResourceExhaustedf ...
+func ResourceExhaustedf(format string, a ...interface{}) *Error {
+	return New(ResourceExhausted, format, a...)
+}
+
+// FailedPreconditionf ...
+func FailedPreconditionf(format string, a ...interface{}) *Error {
+	return New(FailedPrecondition, format, a...)
+}
+
+// Unavailablef ...
+func Unavailablef(format string, a ...interface{}) *Error {
+	return New(Unavailable, format, a...)
+}
+
+// Internalf ...
+func Internalf(format string, a ...interface{}) *Error {
+	return New(Internal, format, a...)
+}
+
+// FromError returns the pi error of err, or nil when err is nil. The go-micro
+// errors, e.g. returned by the rpc client, are decoded from their details when
+// they carry the pi errors, or else converted by their http status, and the
+// other errors are unknown errors.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if stdErrors.As(err, &e) {
+		return e
+	}
+	var me *microErrors.Error
+	if stdErrors.As(err, &me) {
+		return fromMicro(me)
+	}
+	switch {
+	case stdErrors.Is(err, context.DeadlineExceeded):
+		return New(DeadlineExceeded, "%s", err.Error())
+	case stdErrors.Is(err, context.Canceled):
+		return New(Canceled, "%s", err.Error())
+	}
+	return New(Unknown, "%s", err.Error())
+}
+
+// CodeOf returns the code of err, which is OK when err is nil.
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	return FromError(err).Code
+}
+
+// IsRetriable returns true when err is retriable.
+func IsRetriable(err error) bool {
+	if err == nil {
+		return false
+	}
+	return FromError(err).Retriable
+}
+
+// HTTPStatus returns the http status of err, which is 200 when err is nil.
+func HTTPStatus(err error) int {
+	return CodeOf(err).HTTPStatus()
+}
+
+// ToMicro returns the go-micro error of err returned by the handler of the service,
+// whose details carry the pi error, so the clients get it by FromError. The go-micro
+// errors are returned as they are.
+func ToMicro(id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var me *microErrors.Error
+	if stdErrors.As(err, &me) {
+		return me
+	}
+
+	e := FromError(err)
+	detail, _ := json.Marshal(e)
+	status := e.HTTPStatus()
+	return &microErrors.Error{
+		Id:     id,
+		Code:   int32(status),
+		Detail: string(detail),
+		Status: http.StatusText(status),
+	}
+}
+
+// fromMicro ...
+func fromMicro(me *microErrors.Error) *Error {
+	e := new(Error)
+	if err := json.Unmarshal([]byte(me.Detail), e); err == nil && e.Code != "" {
+		return e
+	}
+
+	var code Code
+	switch status := int(me.Code); {
+	case status == http.StatusBadRequest:
+		code = InvalidArgument
+	case status == http.StatusUnauthorized:
+		code = Unauthenticated
+	case status == http.StatusForbidden:
+		code = PermissionDenied
+	case status == http.StatusNotFound:
+		code = NotFound
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		code = DeadlineExceeded
+	case status == http.StatusConflict:
+		code = AlreadyExists
+	case status == http.StatusTooManyRequests:
+		code = ResourceExhausted
+	case status == _StatusClientClosedRequest:
+		code = Canceled
+	case status == http.StatusNotImplemented:
+		code = Unimplemented
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable:
+		code = Unavailable
+	case status == http.StatusInternalServerError && me.Id == _MicroClientId:
+		// the client failed to select or reach the service.
+		code = Unavailable
+	case status >= 400 && status < 500:
+		code = FailedPrecondition
+	case status >= 500:
+		code = Internal
+	default:
+		code = Unknown
+	}
+	return New(code, "%s", me.Detail)
+}
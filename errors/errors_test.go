@@ -0,0 +1,119 @@
+package errors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	microErrors "github.com/micro/go-micro/v2/errors"
+)
+
+func TestToMicroRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want *Error
+	}{
+		{
+			name: "pi error",
+			err:  NotFoundf("user %d", 1).WithDetail("id", "1"),
+			want: &Error{Code: NotFound, Message: "user 1", Details: map[string]string{"id": "1"}},
+		},
+		{
+			name: "retriable",
+			err:  Unavailablef("busy"),
+			want: &Error{Code: Unavailable, Message: "busy", Retriable: true},
+		},
+		{
+			name: "not retriable",
+			err:  Unavailablef("down").WithRetriable(false),
+			want: &Error{Code: Unavailable, Message: "down"},
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("get user: %w", PermissionDeniedf("denied")),
+			want: &Error{Code: PermissionDenied, Message: "denied"},
+		},
+		{
+			name: "deadline",
+			err:  context.DeadlineExceeded,
+			want: &Error{Code: DeadlineExceeded, Message: "context deadline exceeded", Retriable: true},
+		},
+		{
+			name: "canceled",
+			err:  context.Canceled,
+			want: &Error{Code: Canceled, Message: "context canceled"},
+		},
+		{
+			name: "other",
+			err:  fmt.Errorf("boom"),
+			want: &Error{Code: Unknown, Message: "boom"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			me := ToMicro("svc", tt.err)
+			if _, ok := me.(*microErrors.Error); !ok {
+				t.Fatalf("ToMicro = %T, want *errors.Error of go-micro", me)
+			}
+			if got := FromError(me); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromError(ToMicro(err)) = %+v, want %+v", got, tt.want)
+			}
+			if got := HTTPStatus(me); got != tt.want.HTTPStatus() {
+				t.Errorf("HTTPStatus = %d, want %d", got, tt.want.HTTPStatus())
+			}
+		})
+	}
+}
+
+func TestToMicroKeepsMicroErrors(t *testing.T) {
+	me := microErr("svc", http.StatusNotFound)
+	if got := ToMicro("other", me); got != me {
+		t.Errorf("ToMicro = %v, want the go-micro error as it is", got)
+	}
+	if ToMicro("svc", nil) != nil || FromError(nil) != nil {
+		t.Error("nil error isn't kept nil")
+	}
+}
+
+// microErr returns the go-micro error of the status, whose detail isn't a pi error.
+func microErr(id string, status int32) *microErrors.Error {
+	return &microErrors.Error{Id: id, Code: status, Detail: "detail"}
+}
+
+func TestFromMicro(t *testing.T) {
+	tests := []struct {
+		err  *microErrors.Error
+		want Code
+	}{
+		{microErr("svc", http.StatusBadRequest), InvalidArgument},
+		{microErr("svc", http.StatusUnauthorized), Unauthenticated},
+		{microErr("svc", http.StatusForbidden), PermissionDenied},
+		{microErr("svc", http.StatusNotFound), NotFound},
+		{microErr("svc", http.StatusRequestTimeout), DeadlineExceeded},
+		{microErr("svc", http.StatusConflict), AlreadyExists},
+		{microErr("svc", http.StatusTooManyRequests), ResourceExhausted},
+		{microErr("svc", _StatusClientClosedRequest), Canceled},
+		{microErr("svc", http.StatusServiceUnavailable), Unavailable},
+		{microErr(_MicroClientId, http.StatusInternalServerError), Unavailable},
+		{microErr("svc", http.StatusInternalServerError), Internal},
+		{microErr("svc", http.StatusTeapot), FailedPrecondition},
+		{microErr("svc", 0), Unknown},
+		// the detail which isn't a pi error is the message.
+		{&microErrors.Error{Id: "svc", Code: 404, Detail: `{"foo": "bar"}`}, NotFound},
+	}
+	for _, tt := range tests {
+		got := FromError(tt.err)
+		if got.Code != tt.want {
+			t.Errorf("FromError(%d %s) = %s, want %s", tt.err.Code, tt.err.Id, got.Code, tt.want)
+		}
+		if got.Message != tt.err.Detail {
+			t.Errorf("FromError(%d %s) message = %q, want %q", tt.err.Code, tt.err.Id, got.Message, tt.err.Detail)
+		}
+		if got.Retriable != tt.want.Retriable() {
+			t.Errorf("FromError(%d %s) retriable = %v", tt.err.Code, tt.err.Id, got.Retriable)
+		}
+	}
+}
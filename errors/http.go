@@ -0,0 +1,23 @@
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HTTPBody is the json body of the http error responses.
+type HTTPBody struct {
+	Error *Error `json:"error"`
+}
+
+// WriteHTTP writes the http status and the json body of err, so the web handlers
+// respond with the same errors as the rpc handlers.
+func WriteHTTP(w http.ResponseWriter, err error) {
+	e := FromError(err)
+	if e == nil {
+		e = New(Unknown, "unknown error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(e.HTTPStatus())
+	_ = json.NewEncoder(w).Encode(HTTPBody{Error: e})
+}
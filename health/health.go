@@ -0,0 +1,172 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StatusUp is the status of the healthy component.
+	StatusUp = "up"
+
+	// StatusDown is the status of the unhealthy component.
+	StatusDown = "down"
+
+	// _CheckTimeout is the timeout of checking all the components.
+	_CheckTimeout = 3 * time.Second
+)
+
+// Checker checks the health of a component, and returns the error when it's unhealthy.
+type Checker func(ctx context.Context) error
+
+// Health aggregates the checkers of all the components.
+type Health struct {
+	// checkers are the checkers by component name.
+	checkers map[string]Checker
+
+	// mu protects checkers.
+	mu sync.RWMutex
+
+	// ready is 1 when the service is ready to serve.
+	ready int32
+}
+
+// Report is the result of checking all the components.
+type Report struct {
+	Status     string                      `json:"status"`
+	Ready      bool                        `json:"ready"`
+	Components map[string]*ComponentReport `json:"components,omitempty"`
+}
+
+// ComponentReport is the result of checking a component.
+type ComponentReport struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// New returns the health which is not ready.
+func New() *Health {
+	return &Health{
+		checkers: make(map[string]Checker),
+	}
+}
+
+// Register registers the checker of the component, the former one of the same
+// name is replaced.
+func (h *Health) Register(name string, checker Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checkers[name] = checker
+}
+
+// SetReady sets whether the service is ready to serve, it's set to false when the
+// service starts draining.
+func (h *Health) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&h.ready, v)
+}
+
+// Ready returns whether the service is ready to serve.
+func (h *Health) Ready() bool {
+	return atomic.LoadInt32(&h.ready) == 1
+}
+
+// Check checks all the components concurrently within the check timeout.
+func (h *Health) Check(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, _CheckTimeout)
+	defer cancel()
+
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checkers))
+	for name := range h.checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checkers := make([]Checker, len(names))
+	for i, name := range names {
+		checkers[i] = h.checkers[name]
+	}
+	h.mu.RUnlock()
+
+	errs := make([]error, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			errs[i] = check(ctx, checker)
+		}(i, checker)
+	}
+	wg.Wait()
+
+	report := &Report{
+		Status:     StatusUp,
+		Ready:      h.Ready(),
+		Components: make(map[string]*ComponentReport, len(names)),
+	}
+	for i, name := range names {
+		cr := &ComponentReport{Status: StatusUp}
+		if errs[i] != nil {
+			cr.Status, cr.Error = StatusDown, errs[i].Error()
+			report.Status = StatusDown
+		}
+		report.Components[name] = cr
+	}
+	return report
+}
+
+// Healthy returns true when all the components are up.
+func (r *Report) Healthy() bool {
+	return r.Status == StatusUp
+}
+
+// LivenessHandler serves the report of all the components, the status code is 503
+// when any of them is down.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context())
+		writeReport(w, report, report.Healthy())
+	})
+}
+
+// ReadinessHandler serves the report of all the components, the status code is 503
+// when the service isn't ready or any of them is down.
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context())
+		writeReport(w, report, report.Ready && report.Healthy())
+	})
+}
+
+// check runs the checker, and returns the context error when it doesn't return
+// in time.
+func check(ctx context.Context, checker Checker) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- checker(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeReport ...
+func writeReport(w http.ResponseWriter, report *Report, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
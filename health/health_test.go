@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Second)
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		checkers   map[string]Checker
+		wantStatus string
+		want       map[string]*ComponentReport
+	}{
+		{name: "no checkers", wantStatus: StatusUp, want: map[string]*ComponentReport{}},
+		{name: "all up", checkers: map[string]Checker{"mysql": up, "redis": up}, wantStatus: StatusUp,
+			want: map[string]*ComponentReport{"mysql": {Status: StatusUp}, "redis": {Status: StatusUp}}},
+		{name: "one down", checkers: map[string]Checker{"mysql": up, "redis": down}, wantStatus: StatusDown,
+			want: map[string]*ComponentReport{"mysql": {Status: StatusUp}, "redis": {Status: StatusDown, Error: "connection refused"}}},
+		{name: "timed out", checkers: map[string]Checker{"kafka": hang, "mysql": down}, wantStatus: StatusDown,
+			want: map[string]*ComponentReport{
+				"kafka": {Status: StatusDown, Error: context.DeadlineExceeded.Error()},
+				"mysql": {Status: StatusDown, Error: "connection refused"},
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New()
+			for name, checker := range tt.checkers {
+				h.Register(name, checker)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			report := h.Check(ctx)
+			if report.Status != tt.wantStatus || report.Healthy() != (tt.wantStatus == StatusUp) {
+				t.Errorf("status = %s, want %s", report.Status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(report.Components, tt.want) {
+				got, _ := json.Marshal(report.Components)
+				want, _ := json.Marshal(tt.want)
+				t.Errorf("components = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRegisterReplaces(t *testing.T) {
+	h := New()
+	h.Register("redis", func(ctx context.Context) error { return errors.New("down") })
+	h.Register("redis", func(ctx context.Context) error { return nil })
+	if report := h.Check(context.Background()); !report.Healthy() {
+		t.Errorf("status = %s, want the former checker replaced", report.Status)
+	}
+}
+
+func TestSetReady(t *testing.T) {
+	h := New()
+	if h.Ready() || h.Check(context.Background()).Ready {
+		t.Fatal("new health is ready")
+	}
+	h.SetReady(true)
+	if !h.Ready() || !h.Check(context.Background()).Ready {
+		t.Error("health isn't ready after SetReady(true)")
+	}
+	// draining
+	h.SetReady(false)
+	if h.Ready() || h.Check(context.Background()).Ready {
+		t.Error("health is ready after SetReady(false)")
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		ready         bool
+		down          bool
+		wantLiveness  int
+		wantReadiness int
+	}{
+		{name: "ready", ready: true, wantLiveness: http.StatusOK, wantReadiness: http.StatusOK},
+		{name: "not ready", wantLiveness: http.StatusOK, wantReadiness: http.StatusServiceUnavailable},
+		{name: "down", ready: true, down: true, wantLiveness: http.StatusServiceUnavailable, wantReadiness: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New()
+			h.SetReady(tt.ready)
+			h.Register("component", func(ctx context.Context) error {
+				if tt.down {
+					return errors.New("down")
+				}
+				return nil
+			})
+
+			check := func(endpoint string, handler http.Handler, want int) {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+endpoint, nil))
+				if w.Code != want {
+					t.Errorf("%s status code = %d, want %d", endpoint, w.Code, want)
+				}
+				if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+					t.Errorf("%s content type = %s", endpoint, ct)
+				}
+				var report Report
+				if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+					t.Fatalf("%s body = %s: %v", endpoint, w.Body, err)
+				}
+				if report.Ready != tt.ready || report.Healthy() == tt.down || report.Components["component"] == nil {
+					t.Errorf("%s report = %s", endpoint, w.Body)
+				}
+			}
+			check("liveness", h.LivenessHandler(), tt.wantLiveness)
+			check("readiness", h.ReadinessHandler(), tt.wantReadiness)
+		})
+	}
+}
@@ -4,54 +4,160 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"reflect"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/uber/jaeger-client-go"
+	opentracing "github.com/opentracing/opentracing-go"
 	jaegerConfigure "github.com/uber/jaeger-client-go/config"
 
 	"github.com/shelton-hu/logger"
 
 	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/tracing"
 )
 
-var j *Jaeger
+// std is the default jaeger used by the package level functions.
+var std *Jaeger
 
 // Jaeger ...
 type Jaeger struct {
-	close io.Closer
+	tracer  opentracing.Tracer
+	close   io.Closer
+	sampler *sampler
+
+	// cfg is the config which the tracer was created with, and whose sampling
+	// config was applied last.
+	cfg config.Jaeger
+	mu  sync.Mutex
 }
 
-// ConnectJaeger connects to jaeger.
-func ConnectJaeger(ctx context.Context, jaegerConfig config.Jaeger, opts ...jaegerConfigure.Option) {
-	address := fmt.Sprintf("%s:%d", jaegerConfig.Host, jaegerConfig.Port)
+// New returns the jaeger with the config, whose tracer is not set as the global
+// tracer of opentracing. The spans are sent to the agent at the host and port of
+// the config, or to the collector endpoint of the reporter when it's set.
+func New(ctx context.Context, jaegerConfig config.Jaeger, opts ...jaegerConfigure.Option) (*Jaeger, error) {
+	delegate, err := buildSampler(jaegerConfig)
+	if err != nil {
+		return nil, err
+	}
+	s := newSampler(delegate)
+
+	flushInterval := time.Second
+	if jaegerConfig.Reporter.FlushInterval > 0 {
+		flushInterval = time.Duration(jaegerConfig.Reporter.FlushInterval) * time.Second
+	}
 
 	// @wiki https://github.com/jaegertracing/jaeger-client-go/blob/master/config/config.go
 	configure := jaegerConfigure.Configuration{
 		ServiceName: jaegerConfig.Name,
-		Sampler: &jaegerConfigure.SamplerConfig{
-			Type:  jaeger.SamplerTypeProbabilistic,
-			Param: jaegerConfig.Rate,
-		},
 		Reporter: &jaegerConfigure.ReporterConfig{
-			LogSpans:            true,
-			BufferFlushInterval: 1 * time.Second,
-			LocalAgentHostPort:  address,
+			QueueSize:           jaegerConfig.Reporter.QueueSize,
+			LogSpans:            jaegerConfig.Reporter.LogSpans,
+			BufferFlushInterval: flushInterval,
+			LocalAgentHostPort:  fmt.Sprintf("%s:%d", jaegerConfig.Host, jaegerConfig.Port),
+			CollectorEndpoint:   jaegerConfig.Reporter.CollectorEndpoint,
+			User:                jaegerConfig.Reporter.User,
+			Password:            jaegerConfig.Reporter.Password,
 		},
+		Tags: tags(jaegerConfig.Tags),
 	}
 
-	closer, err := configure.InitGlobalTracer(jaegerConfig.Name, opts...)
+	// the sampler of the options takes precedence.
+	opts = append([]jaegerConfigure.Option{jaegerConfigure.Sampler(s)}, opts...)
+	tracer, closer, err := configure.NewTracer(opts...)
 	if err != nil {
-		panic(fmt.Errorf("fatal error: connect jaeger: %s\n", err))
+		s.Close()
+		return nil, err
 	}
 
-	j = &Jaeger{
-		close: closer,
+	return &Jaeger{
+		tracer:  tracer,
+		close:   closer,
+		sampler: s,
+		cfg:     jaegerConfig,
+	}, nil
+}
+
+// ConnectJaeger connects to jaeger, and sets its tracer as the global tracer.
+func ConnectJaeger(ctx context.Context, jaegerConfig config.Jaeger, opts ...jaegerConfigure.Option) error {
+	j, err := New(ctx, jaegerConfig, opts...)
+	if err != nil {
+		return err
 	}
+	SetDefault(j)
+	return nil
+}
+
+// SetDefault replaces the default jaeger, and sets its tracer as the global tracer
+// of both opentracing and the tracing package.
+func SetDefault(j *Jaeger) {
+	std = j
+	opentracing.SetGlobalTracer(j.tracer)
+	tracing.SetGlobal(tracing.NewOpenTracer(j.tracer, nil))
 }
 
 // CloseJaeger ...
 func CloseJaeger(ctx context.Context) {
+	if std != nil {
+		std.Close(ctx)
+	}
+}
+
+// Update applies the sampling config, i.e. the rate and the sampler, to the tracer
+// without recreating it. The other config needs the jaeger to be recreated, which
+// is logged when it changed.
+func (j *Jaeger) Update(ctx context.Context, jaegerConfig config.Jaeger) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.cfg.Rate != jaegerConfig.Rate || !reflect.DeepEqual(j.cfg.Sampler, jaegerConfig.Sampler) {
+		// the sampler belongs to the service of the tracer.
+		sampling := j.cfg
+		sampling.Rate, sampling.Sampler = jaegerConfig.Rate, jaegerConfig.Sampler
+		delegate, err := buildSampler(sampling)
+		if err != nil {
+			return err
+		}
+		j.sampler.set(delegate)
+		logger.Info(ctx, "jaeger sampler is updated, type: %s, rate: %v", jaegerConfig.Sampler.Type, jaegerConfig.Rate)
+	}
+
+	// compare the config except the sampling config.
+	oldCfg, newCfg := j.cfg, jaegerConfig
+	oldCfg.Rate, oldCfg.Sampler = 0, config.JaegerSampler{}
+	newCfg.Rate, newCfg.Sampler = 0, config.JaegerSampler{}
+	if !reflect.DeepEqual(oldCfg, newCfg) {
+		logger.Warn(ctx, "jaeger config except the sampler is changed, which is applied after restarting")
+	}
+
+	j.cfg.Rate, j.cfg.Sampler = jaegerConfig.Rate, jaegerConfig.Sampler
+	return nil
+}
+
+// Tracer returns the tracer of the jaeger.
+func (j *Jaeger) Tracer() opentracing.Tracer {
+	return j.tracer
+}
+
+// Close flushes the spans and closes the tracer.
+func (j *Jaeger) Close(ctx context.Context) {
 	if err := j.close.Close(); err != nil {
 		logger.Error(ctx, err.Error())
 	}
 }
+
+// tags converts the tags of the config, which are sorted by key.
+func tags(m map[string]string) []opentracing.Tag {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tags := make([]opentracing.Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, opentracing.Tag{Key: k, Value: m[k]})
+	}
+	return tags
+}
@@ -0,0 +1,77 @@
+package jaeger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/uber/jaeger-client-go"
+	jaegerConfigure "github.com/uber/jaeger-client-go/config"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// sampled returns whether the span of the operation is sampled by the tracer.
+func sampled(j *Jaeger, operation string) bool {
+	span := j.Tracer().StartSpan(operation)
+	defer span.Finish()
+	return span.Context().(jaeger.SpanContext).IsSampled()
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Jaeger{Name: "svc", Host: "127.0.0.1", Port: 6831, Sampler: config.JaegerSampler{Type: config.JaegerSamplerConst}}
+	j, err := New(ctx, cfg, jaegerConfigure.Reporter(jaeger.NewInMemoryReporter()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close(ctx)
+	if sampled(j, "a") {
+		t.Fatal("span sampled by the const sampler of 0")
+	}
+
+	tests := []struct {
+		name    string
+		sampler config.JaegerSampler
+		rate    float64
+		wantErr bool
+		want    map[string]bool
+	}{
+		{name: "const", sampler: config.JaegerSampler{Type: config.JaegerSamplerConst, Param: 1},
+			want: map[string]bool{"a": true, "b": true}},
+		{name: "invalid keeps the sampler", rate: 2, wantErr: true,
+			want: map[string]bool{"a": true, "b": true}},
+		{name: "probabilistic", rate: 0, want: map[string]bool{"a": false, "b": false}},
+		{name: "per operation", sampler: config.JaegerSampler{Type: config.JaegerSamplerPerOperation,
+			Operations: map[string]float64{"a": 1}}, want: map[string]bool{"a": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newCfg := cfg
+			newCfg.Rate, newCfg.Sampler = tt.rate, tt.sampler
+			old := j.sampler.get()
+			if err := j.Update(ctx, newCfg); (err != nil) != tt.wantErr {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if replaced := j.sampler.get() != old; replaced == tt.wantErr {
+				t.Errorf("sampler replaced = %v, want %v", replaced, !tt.wantErr)
+			}
+			for operation, want := range tt.want {
+				if got := sampled(j, operation); got != want {
+					t.Errorf("span %s sampled = %v, want %v", operation, got, want)
+				}
+			}
+		})
+	}
+
+	// the unchanged sampling config keeps the sampler.
+	old := j.sampler.get()
+	newCfg := cfg
+	newCfg.Sampler = config.JaegerSampler{Type: config.JaegerSamplerPerOperation, Operations: map[string]float64{"a": 1}}
+	newCfg.Tags = map[string]string{"k": "v"}
+	if err := j.Update(ctx, newCfg); err != nil {
+		t.Fatal(err)
+	}
+	if j.sampler.get() != old {
+		t.Error("sampler replaced by the unchanged sampling config")
+	}
+}
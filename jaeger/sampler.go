@@ -0,0 +1,129 @@
+package jaeger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/thrift-gen/sampling"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// _AgentSamplingPort is the port of the sampling endpoint of the jaeger agent.
+const _AgentSamplingPort = 5778
+
+// sampler is the sampler of the tracer whose delegate can be replaced, so the
+// sampling config is applied without recreating the tracer.
+type sampler struct {
+	jaeger.SamplerV2Base
+
+	delegate jaeger.SamplerV2
+	mu       sync.RWMutex
+}
+
+// newSampler ...
+func newSampler(delegate jaeger.SamplerV2) *sampler {
+	return &sampler{
+		delegate: delegate,
+	}
+}
+
+// set replaces the delegate, and closes the old one.
+func (s *sampler) set(delegate jaeger.SamplerV2) {
+	s.mu.Lock()
+	old := s.delegate
+	s.delegate = delegate
+	s.mu.Unlock()
+
+	old.Close()
+}
+
+// get ...
+func (s *sampler) get() jaeger.SamplerV2 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.delegate
+}
+
+// OnCreateSpan ...
+func (s *sampler) OnCreateSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return s.get().OnCreateSpan(span)
+}
+
+// OnSetOperationName ...
+func (s *sampler) OnSetOperationName(span *jaeger.Span, operationName string) jaeger.SamplingDecision {
+	return s.get().OnSetOperationName(span, operationName)
+}
+
+// OnSetTag ...
+func (s *sampler) OnSetTag(span *jaeger.Span, key string, value interface{}) jaeger.SamplingDecision {
+	return s.get().OnSetTag(span, key, value)
+}
+
+// OnFinishSpan ...
+func (s *sampler) OnFinishSpan(span *jaeger.Span) jaeger.SamplingDecision {
+	return s.get().OnFinishSpan(span)
+}
+
+// Close ...
+func (s *sampler) Close() {
+	s.get().Close()
+}
+
+// buildSampler returns the sampler of the config.
+func buildSampler(jaegerConfig config.Jaeger) (jaeger.SamplerV2, error) {
+	c := jaegerConfig.Sampler
+	switch c.Type {
+	case config.JaegerSamplerConst:
+		return jaeger.NewConstSampler(c.Param != 0), nil
+	case "", config.JaegerSamplerProbabilistic:
+		return jaeger.NewProbabilisticSampler(jaegerConfig.Rate)
+	case config.JaegerSamplerRateLimiting:
+		return jaeger.NewRateLimitingSampler(c.Param), nil
+	case config.JaegerSamplerRemote:
+		initial, err := jaeger.NewProbabilisticSampler(jaegerConfig.Rate)
+		if err != nil {
+			return nil, err
+		}
+		serverUrl := c.ServerUrl
+		if serverUrl == "" {
+			serverUrl = fmt.Sprintf("http://%s:%d/sampling", jaegerConfig.Host, _AgentSamplingPort)
+		}
+		opts := []jaeger.SamplerOption{
+			jaeger.SamplerOptions.InitialSampler(initial),
+			jaeger.SamplerOptions.SamplingServerURL(serverUrl),
+			jaeger.SamplerOptions.MaxOperations(c.MaxOperations),
+		}
+		if c.RefreshInterval > 0 {
+			opts = append(opts, jaeger.SamplerOptions.SamplingRefreshInterval(time.Duration(c.RefreshInterval)*time.Second))
+		}
+		return jaeger.NewRemotelyControlledSampler(jaegerConfig.Name, opts...), nil
+	case config.JaegerSamplerPerOperation:
+		ops := make([]string, 0, len(c.Operations))
+		for op := range c.Operations {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		strategies := &sampling.PerOperationSamplingStrategies{
+			DefaultSamplingProbability:       jaegerConfig.Rate,
+			DefaultLowerBoundTracesPerSecond: c.LowerBound,
+		}
+		for _, op := range ops {
+			strategies.PerOperationStrategies = append(strategies.PerOperationStrategies, &sampling.OperationSamplingStrategy{
+				Operation: op,
+				ProbabilisticSampling: &sampling.ProbabilisticSamplingStrategy{
+					SamplingRate: c.Operations[op],
+				},
+			})
+		}
+		return jaeger.NewPerOperationSampler(jaeger.PerOperationSamplerParams{
+			MaxOperations: c.MaxOperations,
+			Strategies:    strategies,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown sampler type %q", c.Type)
+}
@@ -0,0 +1,75 @@
+package jaeger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/uber/jaeger-client-go"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+func TestBuildSampler(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Jaeger
+		want    string
+		wantErr bool
+	}{
+		{name: "const", cfg: config.Jaeger{Sampler: config.JaegerSampler{Type: config.JaegerSamplerConst, Param: 1}},
+			want: "ConstSampler(decision=true)"},
+		{name: "const none", cfg: config.Jaeger{Rate: 1, Sampler: config.JaegerSampler{Type: config.JaegerSamplerConst}},
+			want: "ConstSampler(decision=false)"},
+		{name: "default", cfg: config.Jaeger{Rate: 0.5}, want: "ProbabilisticSampler(samplingRate=0.5)"},
+		{name: "probabilistic", cfg: config.Jaeger{Rate: 0.1, Sampler: config.JaegerSampler{Type: config.JaegerSamplerProbabilistic}},
+			want: "ProbabilisticSampler(samplingRate=0.1)"},
+		{name: "invalid rate", cfg: config.Jaeger{Rate: 2}, wantErr: true},
+		{name: "ratelimiting", cfg: config.Jaeger{Sampler: config.JaegerSampler{Type: config.JaegerSamplerRateLimiting, Param: 3}},
+			want: "RateLimitingSampler(maxTracesPerSecond=3)"},
+		{name: "remote samples by rate initially", cfg: config.Jaeger{Name: "svc", Rate: 0.3,
+			Sampler: config.JaegerSampler{Type: config.JaegerSamplerRemote, ServerUrl: "http://127.0.0.1:1/sampling"}},
+			want: "ProbabilisticSampler(samplingRate=0.3)"},
+		{name: "remote invalid rate", cfg: config.Jaeger{Rate: -1, Sampler: config.JaegerSampler{Type: config.JaegerSamplerRemote}},
+			wantErr: true},
+		{name: "unknown", cfg: config.Jaeger{Sampler: config.JaegerSampler{Type: "unknown"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := buildSampler(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildSampler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer s.Close()
+
+			got := s
+			if remote, ok := s.(*jaeger.RemotelyControlledSampler); ok {
+				got = remote.Sampler()
+			}
+			if str := fmt.Sprint(got); str != tt.want {
+				t.Errorf("buildSampler() = %s, want %s", str, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPerOperationSampler(t *testing.T) {
+	s, err := buildSampler(config.Jaeger{Rate: 0.2, Sampler: config.JaegerSampler{
+		Type:          config.JaegerSamplerPerOperation,
+		MaxOperations: 10,
+		LowerBound:    0.5,
+		Operations:    map[string]float64{"b": 1, "a": 0},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	want := "PerOperationSampler(defaultSampler=ProbabilisticSampler(samplingRate=0.2), lowerBound=0.500000, maxOperations=10"
+	if got := fmt.Sprint(s); !strings.HasPrefix(got, want) {
+		t.Errorf("buildSampler() = %s, want prefix %s", got, want)
+	}
+}
@@ -2,17 +2,27 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 
 	"github.com/Shopify/sarama"
 	cluster "github.com/bsm/sarama-cluster"
 
 	"github.com/shelton-hu/logger"
 
+	"github.com/shelton-hu/pi/auth"
 	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
 )
 
-var kafka *Kafka
+// std holds the default kafka used by the package level functions.
+var std atomic.Value
+
+func init() {
+	std.Store(new(Kafka))
+}
 
 // Kafka ...
 type Kafka struct {
@@ -23,63 +33,224 @@ type Kafka struct {
 	cs    []sarama.Client
 	clcfg *cluster.Config
 
-	mu sync.Mutex
+	// subscriptions are the running subscriptions.
+	subscriptions map[*Subscription]struct{}
+
+	// mu protects the fields above, it's held for reading while publishing, so
+	// reconnecting waits for the publishing messages.
+	mu sync.RWMutex
+
+	// tracer, redaction and authenticator are the tracer, the redaction policy and
+	// the authenticator of the messages, the globals are used when they're nil.
+	tracer        tracing.Tracer
+	redaction     *redact.Policy
+	authenticator *auth.Authenticator
 }
 
-// ConnectKafka ...
-func ConnectKafka(ctx context.Context, kafkaConfig config.Kafka) {
-	// kafka.addrs
-	kafka.addrs = kafkaConfig.Addrs
-	// kafka.cfg
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Partitioner = sarama.NewRandomPartitioner
-	config.Producer.Return.Successes = true
-	config.Producer.Return.Errors = true
-	var err error
-	config.Version, err = sarama.ParseKafkaVersion(kafkaConfig.Version)
-	if err != nil {
-		panic(err)
+// KafkaOptions ...
+type KafkaOptions func(*KafkaOption)
+
+// KafkaOption ...
+type KafkaOption struct {
+	tracer        tracing.Tracer
+	redaction     *redact.Policy
+	authenticator *auth.Authenticator
+}
+
+// SetKafkaTracer sets the tracer of the messages, default is the global tracer.
+func SetKafkaTracer(tracer tracing.Tracer) KafkaOptions {
+	return func(o *KafkaOption) {
+		o.tracer = tracer
+	}
+}
+
+// SetKafkaRedaction sets the redaction policy of the messages, default is the
+// default policy of the redact package.
+func SetKafkaRedaction(policy *redact.Policy) KafkaOptions {
+	return func(o *KafkaOption) {
+		o.redaction = policy
+	}
+}
+
+// SetKafkaAuthenticator sets the authenticator of the messages, default is the
+// default authenticator of the auth package.
+func SetKafkaAuthenticator(authenticator *auth.Authenticator) KafkaOptions {
+	return func(o *KafkaOption) {
+		o.authenticator = authenticator
 	}
-	kafka.cfg = config
-	// kafka.c
-	c, err := sarama.NewClient(kafka.addrs, kafka.cfg)
+}
+
+// NewKafka connects to kafka with the config.
+func NewKafka(ctx context.Context, kafkaConfig config.Kafka, opts ...KafkaOptions) (*Kafka, error) {
+	o := new(KafkaOption)
+	for _, opt := range opts {
+		opt(o)
+	}
+	k, err := newKafka(kafkaConfig)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	kafka.c = c
-	// kafka.p
-	p, err := sarama.NewAsyncProducerFromClient(c)
+	k.tracer, k.redaction, k.authenticator = o.tracer, o.redaction, o.authenticator
+	return k, nil
+}
+
+// SetDefault replaces the default kafka used by the package level functions.
+func SetDefault(k *Kafka) {
+	std.Store(k)
+}
+
+// Default returns the default kafka used by the package level functions.
+func Default() *Kafka {
+	return std.Load().(*Kafka)
+}
+
+// ConnectKafka connects the default kafka.
+func ConnectKafka(ctx context.Context, kafkaConfig config.Kafka) error {
+	k, err := NewKafka(ctx, kafkaConfig)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	kafka.p = p
-	// kafka.cs
-	kafka.mu.Lock()
-	defer kafka.mu.Unlock()
-	kafka.cs = make([]sarama.Client, 0)
-	// kafka.clcfg
-	kafka.clcfg = cluster.NewConfig()
-	kafka.clcfg.Consumer.Offsets.Initial = sarama.OffsetNewest
-	kafka.clcfg.Group.Return.Notifications = true
-	kafka.clcfg.Version = kafka.cfg.Version
+	SetDefault(k)
+	return nil
+}
+
+// ReconnectKafka reconnects the default kafka, see (*Kafka).Reconnect.
+func ReconnectKafka(ctx context.Context, kafkaConfig config.Kafka) error {
+	return Default().Reconnect(ctx, kafkaConfig)
 }
 
 // CloseKafka ...
 func CloseKafka(ctx context.Context) {
-	for _, client := range kafka.cs {
+	Default().Close(ctx)
+}
+
+// GetConnect returns the default kafka instance.
+func GetConnect(ctx context.Context) *Kafka {
+	return Default()
+}
+
+// Reconnect replaces the kafka client and producer by the new ones with the
+// config after the publishing messages are done, and closes the old ones. The running
+// subscriptions are restarted with the new config after their messages in progress
+// are handled, and the ones failing to restart keep consuming by the old config.
+func (k *Kafka) Reconnect(ctx context.Context, kafkaConfig config.Kafka) error {
+	nk, err := newKafka(kafkaConfig)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	oldP, oldC := k.p, k.c
+	k.addrs, k.cfg, k.c, k.p, k.clcfg = nk.addrs, nk.cfg, nk.c, nk.p, nk.clcfg
+	for sub := range k.subscriptions {
+		select {
+		case sub.restart <- struct{}{}:
+		default:
+			// the restart is pending.
+		}
+	}
+	k.mu.Unlock()
+
+	if oldP != nil {
+		if err := oldP.Close(); err != nil {
+			logger.Error(ctx, err.Error())
+		}
+	}
+	if oldC != nil && !oldC.Closed() {
+		if err := oldC.Close(); err != nil {
+			logger.Error(ctx, err.Error())
+		}
+	}
+	return nil
+}
+
+// Check refreshes the metadata of the cluster, which fails when none of the brokers
+// is reachable.
+func (k *Kafka) Check(ctx context.Context) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.c == nil || k.c.Closed() {
+		return errors.New("kafka client is closed")
+	}
+	return k.c.RefreshMetadata()
+}
+
+// Close closes the clients and the producer.
+func (k *Kafka) Close(ctx context.Context) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, client := range k.cs {
 		if err := client.Close(); err != nil {
 			logger.Error(ctx, err.Error())
 		}
 	}
-	kafka.cs = nil
-	if err := kafka.p.Close(); err != nil {
-		logger.Error(ctx, err.Error())
+	k.cs = nil
+	if k.p != nil {
+		if err := k.p.Close(); err != nil {
+			logger.Error(ctx, err.Error())
+		}
+		k.p = nil
+	}
+	if k.c != nil && !k.c.Closed() {
+		if err := k.c.Close(); err != nil {
+			logger.Error(ctx, err.Error())
+		}
 	}
-	kafka = nil
 }
 
-// GetConnect returns the kafka instance.
-func GetConnect(ctx context.Context) *Kafka {
-	return kafka
+// policy returns the redaction policy of the messages.
+func (k *Kafka) policy() *redact.Policy {
+	if k.redaction == nil {
+		return redact.Default()
+	}
+	return k.redaction
+}
+
+// auth returns the authenticator of the messages.
+func (k *Kafka) auth() *auth.Authenticator {
+	if k.authenticator == nil {
+		return auth.Default()
+	}
+	return k.authenticator
+}
+
+// newKafka connects to kafka with the config.
+func newKafka(kafkaConfig config.Kafka) (*Kafka, error) {
+	k := &Kafka{
+		// k.addrs
+		addrs: kafkaConfig.Addrs,
+	}
+	// k.cfg
+	config := sarama.NewConfig()
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Partitioner = sarama.NewRandomPartitioner
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	var err error
+	config.Version, err = sarama.ParseKafkaVersion(kafkaConfig.Version)
+	if err != nil {
+		return nil, err
+	}
+	k.cfg = config
+	// k.c
+	c, err := sarama.NewClient(k.addrs, k.cfg)
+	if err != nil {
+		return nil, err
+	}
+	k.c = c
+	// k.p
+	p, err := sarama.NewAsyncProducerFromClient(c)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	k.p = p
+	// k.clcfg
+	k.clcfg = cluster.NewConfig()
+	k.clcfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	k.clcfg.Group.Return.Notifications = true
+	k.clcfg.Version = k.cfg.Version
+	return k, nil
 }
@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// newBroker starts the mock broker which replies the metadata, and returns the
+// kafka config of it.
+func newBroker(t *testing.T, id int32) config.Kafka {
+	broker := sarama.NewMockBroker(t, id)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()),
+	})
+	return config.Kafka{Addrs: []string{broker.Addr()}, Version: "1.0.0"}
+}
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+	k, err := NewKafka(ctx, newBroker(t, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close(ctx)
+	sub := &Subscription{Topic: "topic", restart: make(chan struct{}, 1)}
+	k.addSubscription(sub)
+
+	oldClient := k.c
+	if err := k.Reconnect(ctx, config.Kafka{Addrs: k.addrs, Version: "invalid"}); err == nil {
+		t.Fatal("Reconnect with the invalid version: want error")
+	}
+	if k.c != oldClient || oldClient.Closed() {
+		t.Fatal("client after failed Reconnect is replaced or closed, want kept")
+	}
+	select {
+	case <-sub.restart:
+		t.Fatal("subscription restarted by failed Reconnect")
+	default:
+	}
+
+	newConfig := newBroker(t, 2)
+	if err := k.Reconnect(ctx, newConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Reconnect(ctx, newConfig); err != nil {
+		t.Fatal(err)
+	}
+	if !oldClient.Closed() {
+		t.Error("old client isn't closed after Reconnect")
+	}
+	if len(k.addrs) != 1 || k.addrs[0] != newConfig.Addrs[0] {
+		t.Errorf("addrs after Reconnect = %v, want %v", k.addrs, newConfig.Addrs)
+	}
+	if err := k.Check(ctx); err != nil {
+		t.Errorf("Check after Reconnect: %s", err)
+	}
+
+	// the subscription restarts once for the reconnections before it's done.
+	select {
+	case <-sub.restart:
+	default:
+		t.Fatal("subscription isn't restarted by Reconnect")
+	}
+	select {
+	case <-sub.restart:
+		t.Error("subscription restarted twice, want the pending restart coalesced")
+	default:
+	}
+
+	k.removeSubscription(sub)
+	if err := k.Reconnect(ctx, newConfig); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-sub.restart:
+		t.Error("removed subscription restarted by Reconnect")
+	default:
+	}
+}
@@ -3,16 +3,15 @@ package kafka
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/signal"
+	"sort"
+	"time"
 
 	"github.com/Shopify/sarama"
 	cluster "github.com/bsm/sarama-cluster"
-	microTracing "github.com/micro/go-plugins/wrapper/trace/opentracing/v2"
-	opentracing "github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
-
 	"github.com/shelton-hu/logger"
+
+	"github.com/shelton-hu/pi/auth"
+	"github.com/shelton-hu/pi/tracing"
 )
 
 const (
@@ -23,6 +22,9 @@ const (
 	_KafkaProducer      = "kafka.producer"
 	_KafkaComponent     = "go-kafka"
 	_KafkaPeerService   = "kafka"
+
+	// _KafkaEndpointPrefix is the prefix of the topic as the endpoint of the redaction.
+	_KafkaEndpointPrefix = "kafka:"
 )
 
 // Handler ...
@@ -38,19 +40,20 @@ type SubscribeOption struct {
 
 // Publish ...
 func (k *Kafka) Publish(ctx context.Context, topic string, m []byte) (err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
 	headers := make(map[string]string)
-	// build msg head by jaeger start
+	// build msg head by the span
 	name := fmt.Sprintf("%s.%s", _KafkaProducer, topic)
-	_, span, err := microTracing.StartSpanFromContext(ctx, opentracing.GlobalTracer(), name)
-	if err == nil {
-		ext.SpanKindProducer.Set(span)
-		ext.Component.Set(span, _KafkaComponent)
-		ext.PeerService.Set(span, _KafkaPeerService)
-		ext.MessageBusDestination.Set(span, topic)
-		_ = opentracing.GlobalTracer().Inject(span.Context(), opentracing.TextMap, opentracing.TextMapCarrier(headers))
-		span.LogKV("data", string(m))
-		defer span.Finish()
-	}
+	ctx, span := tracing.StartSpan(tracing.NewContext(ctx, k.tracer), name, tracing.SetSpanKind(tracing.KindProducer))
+	defer span.Finish()
+	span.SetTag("component", _KafkaComponent)
+	span.SetTag("peer.service", _KafkaPeerService)
+	span.SetTag("message_bus.destination", topic)
+	tracing.Inject(ctx, headers)
+	k.auth().Inject(ctx, headers)
+	span.LogKV("data", k.policy().Payload(_KafkaEndpointPrefix+topic, m))
 
 	msg := &sarama.ProducerMessage{}
 	if k.cfg.Version.IsAtLeast(sarama.V0_11_0_0) {
@@ -68,104 +71,207 @@ func (k *Kafka) Publish(ctx context.Context, topic string, m []byte) (err error)
 	k.p.Input() <- msg
 	select {
 	case <-k.p.Successes():
-		return
+		err = nil
 	case fail := <-k.p.Errors():
-		return fail.Err
+		err = fail.Err
 	}
+	observePublish(topic, err)
+	span.SetError(err)
+	return err
 }
 
-// Subscribe ...
+// Subscribe consumes the messages of the topic until ctx is done. The handler of the
+// message in progress gets the context which keeps the values of ctx but isn't
+// canceled with it, so the message can be completed. The consumer is replaced by
+// the one of the new config after the kafka is reconnected, see Reconnect.
 func (k *Kafka) Subscribe(ctx context.Context, topic string, handler Handler, opts ...SubscribeOptions) error {
 	// apply opts
 	s := newSubscribeOption()
 	s.applyOpts(opts...)
 
 	// create consumer peer subscribe
-	topics := []string{topic}
-	consumer, err := cluster.NewConsumer(k.addrs, s.groupId, topics, k.clcfg)
+	consumer, version, err := k.newConsumer(ctx, topic, s.groupId)
 	if err != nil {
 		logger.Error(ctx, err.Error())
 		return err
 	}
 	defer func() {
-		if err := consumer.Close(); err != nil {
-			logger.Error(ctx, err.Error())
-		}
+		closeConsumer(ctx, consumer)
 	}()
 
-	// trap SIGINT to trigger a shutdown.
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
-
-	// consume errors
-	go func(ctx context.Context) {
-		for err := range consumer.Errors() {
-			logger.Error(ctx, err.Error())
-			return
-		}
-	}(ctx)
-
-	// consume notifications
-	go func(ctx context.Context) {
-		for ntf := range consumer.Notifications() {
-			logger.Info(ctx, "rebalanced: %+v", ntf)
-		}
-	}(ctx)
+	sub := &Subscription{
+		Topic:   topic,
+		Group:   s.groupId,
+		Since:   time.Now(),
+		restart: make(chan struct{}, 1),
+	}
+	k.addSubscription(sub)
+	defer k.removeSubscription(sub)
 
-	// consume messages, watch signals
+	// consume messages until ctx is done
+	done := ctx.Done()
+	ctx = tracing.NewContext(detachedContext{ctx}, k.tracer)
 	for {
 		select {
 		case msg, ok := <-consumer.Messages():
 			if !ok {
-				continue
+				return nil
 			}
-			span := opentracing.SpanFromContext(ctx)
-			name := fmt.Sprintf("%s.%s", _KafkaConsumer, topic)
-			if span == nil {
-				// 解析header到jaeger中
-				headers := make(map[string]string)
-				// kafka从0.11版本开始支持header
-				if k.cfg.Version.IsAtLeast(sarama.V0_11_0_0) {
-					for _, header := range msg.Headers {
-						headers[string(header.Key)] = string(header.Value)
-					}
-				}
-				spanContext, _ := opentracing.GlobalTracer().Extract(
-					opentracing.TextMap,
-					opentracing.TextMapCarrier(headers),
-				)
-				if spanContext != nil {
-					ctx, span, _ = microTracing.StartSpanFromContext(ctx, opentracing.GlobalTracer(), name, opentracing.ChildOf(spanContext))
-				} else {
-					ctx, span, _ = microTracing.StartSpanFromContext(ctx, opentracing.GlobalTracer(), name)
+			// each message has its own span, which is the child of the span in the
+			// headers, or of the span in ctx when the headers have none.
+			headers := make(map[string]string)
+			// kafka从0.11版本开始支持header
+			if version.IsAtLeast(sarama.V0_11_0_0) {
+				for _, header := range msg.Headers {
+					headers[string(header.Key)] = string(header.Value)
 				}
 			}
-			ext.Component.Set(span, _KafkaComponent)
-			ext.PeerService.Set(span, _KafkaPeerService)
+			name := fmt.Sprintf("%s.%s", _KafkaConsumer, topic)
+			msgCtx, span := tracing.StartSpan(tracing.Extract(ctx, headers), name, tracing.SetSpanKind(tracing.KindConsumer))
+			span.SetTag("component", _KafkaComponent)
+			span.SetTag("peer.service", _KafkaPeerService)
 
 			span.SetTag(_KafkaPartition, msg.Partition)
 			span.SetTag(_KafkaOffset, msg.Offset)
 
-			span.LogKV("data", string(msg.Value))
+			span.LogKV("data", k.policy().Payload(_KafkaEndpointPrefix+topic, msg.Value))
 
-			// handler msg
-			err = handler(ctx, msg.Value)
-			if err != nil {
-				ext.Error.Set(span, true)
-				span.LogKV("error_msg", err.Error())
+			// the message is handled without the identity when its credentials are
+			// invalid, e.g. the token expired before the message was consumed.
+			if id, err := k.auth().Authenticate(msgCtx, headers); err != nil {
+				logger.Warn(msgCtx, "authenticate message of %s: %s", topic, err.Error())
+			} else if id != nil {
+				msgCtx = auth.NewContext(msgCtx, id)
 			}
 
+			// handler msg
+			begin := time.Now()
+			err = handler(msgCtx, msg.Value)
+			lag := consumer.HighWaterMarks()[msg.Topic][msg.Partition] - msg.Offset - 1
+			observeConsume(topic, s.groupId, msg.Partition, lag, time.Since(begin).Seconds(), err)
+			span.SetError(err)
+
 			// 不能通过defer的方式声明
 			span.Finish()
 
 			// mark message as processed
 			consumer.MarkOffset(msg, "")
-		case <-signals:
+		case <-sub.restart:
+			// the old consumer is kept when the new one fails, so the subscription
+			// is never stopped by reconnecting.
+			newConsumer, newVersion, err := k.newConsumer(ctx, topic, s.groupId)
+			if err != nil {
+				logger.Error(ctx, "resubscribe %s: %s, keep consuming by the old config", topic, err.Error())
+				continue
+			}
+			closeConsumer(ctx, consumer)
+			consumer, version = newConsumer, newVersion
+			logger.Info(ctx, "resubscribed %s with the new config", topic)
+		case <-done:
 			return nil
 		}
 	}
 }
 
+// newConsumer returns the consumer of the topic with the current config, and the
+// kafka version of the config.
+func (k *Kafka) newConsumer(ctx context.Context, topic string, groupId string) (*cluster.Consumer, sarama.KafkaVersion, error) {
+	k.mu.RLock()
+	addrs, clcfg, version := k.addrs, k.clcfg, k.cfg.Version
+	k.mu.RUnlock()
+	consumer, err := cluster.NewConsumer(addrs, groupId, []string{topic}, clcfg)
+	if err != nil {
+		return nil, version, err
+	}
+
+	// consume errors
+	go func(ctx context.Context) {
+		for err := range consumer.Errors() {
+			logger.Error(ctx, err.Error())
+			return
+		}
+	}(ctx)
+
+	// consume notifications
+	go func(ctx context.Context) {
+		for ntf := range consumer.Notifications() {
+			logger.Info(ctx, "rebalanced: %+v", ntf)
+		}
+	}(ctx)
+	return consumer, version, nil
+}
+
+// closeConsumer ...
+func closeConsumer(ctx context.Context, consumer *cluster.Consumer) {
+	if err := consumer.Close(); err != nil {
+		logger.Error(ctx, err.Error())
+	}
+}
+
+// Subscription is a running subscription.
+type Subscription struct {
+	Topic string    `json:"topic"`
+	Group string    `json:"group"`
+	Since time.Time `json:"since"`
+
+	// restart is signaled to replace the consumer by the one of the new config.
+	restart chan struct{}
+}
+
+// Subscriptions returns the running subscriptions.
+func (k *Kafka) Subscriptions() []*Subscription {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	subs := make([]*Subscription, 0, len(k.subscriptions))
+	for sub := range k.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Since.Before(subs[j].Since)
+	})
+	return subs
+}
+
+// addSubscription ...
+func (k *Kafka) addSubscription(sub *Subscription) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.subscriptions == nil {
+		k.subscriptions = make(map[*Subscription]struct{})
+	}
+	k.subscriptions[sub] = struct{}{}
+}
+
+// removeSubscription ...
+func (k *Kafka) removeSubscription(sub *Subscription) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.subscriptions, sub)
+}
+
+// detachedContext keeps the values of the parent context, but is never canceled.
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline ...
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done ...
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err ...
+func (detachedContext) Err() error {
+	return nil
+}
+
 // newSubscribeOption ...
 func newSubscribeOption() *SubscribeOption {
 	return &SubscribeOption{
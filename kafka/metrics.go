@@ -0,0 +1,83 @@
+package kafka
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	_MetricsNamespace = "pi"
+	_MetricsSubsystem = "kafka"
+)
+
+var (
+	// publishTotal is the number of the published messages by result.
+	publishTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "publish_total",
+		Help:      "The number of the published messages.",
+	}, []string{"topic", "result"})
+
+	// consumeTotal is the number of the consumed messages.
+	consumeTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "consume_total",
+		Help:      "The number of the consumed messages.",
+	}, []string{"topic", "group"})
+
+	// handlerErrors is the number of the messages which the handler failed.
+	handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "handler_errors_total",
+		Help:      "The number of the messages which the handler failed.",
+	}, []string{"topic", "group"})
+
+	// handlerDuration is the duration of handling the messages.
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "handler_duration_seconds",
+		Help:      "The duration of handling the messages.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"topic", "group"})
+
+	// consumerLag is the number of the messages behind the high water mark of the
+	// partition when the last message was consumed.
+	consumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "consumer_lag",
+		Help:      "The number of the messages behind the high water mark of the partition.",
+	}, []string{"topic", "group", "partition"})
+)
+
+func init() {
+	prometheus.MustRegister(publishTotal, consumeTotal, handlerErrors, handlerDuration, consumerLag)
+}
+
+// observePublish ...
+func observePublish(topic string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	publishTotal.WithLabelValues(topic, result).Inc()
+}
+
+// observeConsume records the consumed message, the duration and the error of its
+// handler, and the lag of its partition.
+func observeConsume(topic, group string, partition int32, lag int64, seconds float64, err error) {
+	consumeTotal.WithLabelValues(topic, group).Inc()
+	handlerDuration.WithLabelValues(topic, group).Observe(seconds)
+	if err != nil {
+		handlerErrors.WithLabelValues(topic, group).Inc()
+	}
+	if lag < 0 {
+		lag = 0
+	}
+	consumerLag.WithLabelValues(topic, group, strconv.Itoa(int(partition))).Set(float64(lag))
+}
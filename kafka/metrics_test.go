@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObservePublish(t *testing.T) {
+	success, failure := publishTotal.WithLabelValues("metrics", "success"), publishTotal.WithLabelValues("metrics", "error")
+	successBefore, failureBefore := testutil.ToFloat64(success), testutil.ToFloat64(failure)
+
+	observePublish("metrics", nil)
+	observePublish("metrics", errors.New("leader not available"))
+	observePublish("metrics", nil)
+	if got := testutil.ToFloat64(success) - successBefore; got != 2 {
+		t.Errorf("published = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(failure) - failureBefore; got != 1 {
+		t.Errorf("failed to publish = %v, want 1", got)
+	}
+}
+
+func TestObserveConsume(t *testing.T) {
+	tests := []struct {
+		name      string
+		lag       int64
+		err       error
+		wantLag   float64
+		wantError float64
+	}{
+		{name: "ok", lag: 3, wantLag: 3},
+		{name: "handler error", lag: 0, err: errors.New("failed"), wantError: 1},
+		{name: "negative lag", lag: -1, wantLag: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic := "metrics-" + tt.name
+			observeConsume(topic, "group", 1, tt.lag, 0.1, tt.err)
+			if got := testutil.ToFloat64(consumeTotal.WithLabelValues(topic, "group")); got != 1 {
+				t.Errorf("consumed = %v, want 1", got)
+			}
+			if got := testutil.ToFloat64(handlerErrors.WithLabelValues(topic, "group")); got != tt.wantError {
+				t.Errorf("handler errors = %v, want %v", got, tt.wantError)
+			}
+			if got := testutil.ToFloat64(consumerLag.WithLabelValues(topic, "group", "1")); got != tt.wantLag {
+				t.Errorf("lag = %v, want %v", got, tt.wantLag)
+			}
+		})
+	}
+}
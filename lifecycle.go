@@ -0,0 +1,193 @@
+package pi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	goMicro "github.com/micro/go-micro/v2"
+	"github.com/micro/go-micro/v2/web"
+
+	"github.com/shelton-hu/logger"
+
+	"github.com/shelton-hu/pi/kafka"
+)
+
+const (
+	// _DrainTimeout is the default duration which the components are given to stop
+	// when shutting down.
+	_DrainTimeout = 30 * time.Second
+
+	// _HardStopTimeout is the duration which the components are waited for after
+	// they were all cancelled by the drain timeout, before their connections are
+	// closed anyway.
+	_HardStopTimeout = 5 * time.Second
+)
+
+// shutdownSignals are the os signals which shut the pi down gracefully.
+var shutdownSignals = []os.Signal{
+	syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT,
+}
+
+// subscriber is the kafka subscription started by Run.
+type subscriber struct {
+	topic   string
+	handler kafka.Handler
+	opts    []kafka.SubscribeOptions
+}
+
+// runner is the component started by Run, run blocks until ctx is done and the
+// component has stopped.
+type runner struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// SetDrainTimeout sets the duration which the components are given to stop when
+// shutting down, default is 30s.
+func SetDrainTimeout(timeout time.Duration) options {
+	return func(o *Option) {
+		o.drainTimeout = timeout
+	}
+}
+
+// RegisterSubscriber registers the kafka subscription which is started by Run.
+func (p *Pi) RegisterSubscriber(topic string, handler kafka.Handler, opts ...kafka.SubscribeOptions) {
+	p.mustEnabled(Kafka)
+	p.subscribers = append(p.subscribers, &subscriber{
+		topic:   topic,
+		handler: handler,
+		opts:    opts,
+	})
+}
+
+// Run runs the global pi, see (*Pi).Run.
+func Run() error {
+	return G().Run()
+}
+
+// Run starts the daemons, cron, kafka subscribers, web service and rpc service of
+// the pi, which is marked ready by New. It blocks until a shutdown signal is received,
+// the context of the pi is done or any of them fails. Then the pi is marked not
+// ready, they are stopped in the reverse order within the drain timeout, and the
+// config and connections of the pi are closed after they all stopped. When the drain
+// timeout exceeds, the rest of them are cancelled together, and the connections
+// are closed after they stopped or the hard stop timeout exceeded. The error of
+// the failed component is returned.
+func (p *Pi) Run() error {
+	runners := p.runners()
+
+	type running struct {
+		name   string
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+	errs := make(chan error, len(runners))
+	runnings := make([]*running, 0, len(runners))
+	for _, r := range runners {
+		ctx, cancel := context.WithCancel(p.ctx)
+		rn := &running{
+			name:   r.name,
+			cancel: cancel,
+			done:   make(chan struct{}),
+		}
+		go func(r *runner) {
+			defer close(rn.done)
+			if err := r.run(ctx); err != nil {
+				errs <- fmt.Errorf("%s: %s", r.name, err)
+			}
+		}(r)
+		runnings = append(runnings, rn)
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, shutdownSignals...)
+	defer signal.Stop(ch)
+
+	var err error
+	select {
+	case sig := <-ch:
+		logger.Info(p.ctx, "received signal %s, shutting down", sig)
+	case <-p.ctx.Done():
+		logger.Info(p.ctx, "context done, shutting down")
+	case err = <-errs:
+		logger.Error(p.ctx, "%s, shutting down", err.Error())
+	}
+
+	// not ready while draining.
+	p.health.SetReady(false)
+	timer := time.NewTimer(p.drainTimeout)
+	defer timer.Stop()
+drain:
+	for i := len(runnings) - 1; i >= 0; i-- {
+		rn := runnings[i]
+		rn.cancel()
+		select {
+		case <-rn.done:
+		case <-timer.C:
+			logger.Error(p.ctx, "drain timeout %s exceeded when stopping %s", p.drainTimeout, rn.name)
+			for _, rn := range runnings[:i] {
+				rn.cancel()
+			}
+			break drain
+		}
+	}
+
+	// the components may still use the connections until they stopped.
+	hardTimer := time.NewTimer(_HardStopTimeout)
+	defer hardTimer.Stop()
+wait:
+	for _, rn := range runnings {
+		select {
+		case <-rn.done:
+		case <-hardTimer.C:
+			logger.Error(p.ctx, "hard stop timeout %s exceeded when waiting for %s to stop", _HardStopTimeout, rn.name)
+			break wait
+		}
+	}
+
+	p.Close()
+	return err
+}
+
+// runners returns the components of the pi in the order of starting them.
+func (p *Pi) runners() []*runner {
+	runners := []*runner{
+		{name: "daemon", run: func(ctx context.Context) error {
+			p.daemon.RunWithoutBlock()
+			<-ctx.Done()
+			p.daemon.Stop()
+			return nil
+		}},
+		{name: "cron", run: func(ctx context.Context) error {
+			p.cron.Start()
+			<-ctx.Done()
+			<-p.cron.Stop().Done()
+			return nil
+		}},
+	}
+	for _, s := range p.subscribers {
+		s := s
+		runners = append(runners, &runner{name: "kafka subscriber " + s.topic, run: func(ctx context.Context) error {
+			return p.kafka.Subscribe(ctx, s.topic, s.handler, s.opts...)
+		}})
+	}
+	if p.Enabled(WebService) {
+		runners = append(runners, &runner{name: "web service", run: func(ctx context.Context) error {
+			if err := p.microWebService.Init(web.Context(ctx), web.HandleSignal(false)); err != nil {
+				return err
+			}
+			return p.microWebService.Run()
+		}})
+	}
+	if p.Enabled(RpcService) {
+		runners = append(runners, &runner{name: "rpc service", run: func(ctx context.Context) error {
+			p.microRpcService.Init(goMicro.Context(ctx), goMicro.HandleSignal(false))
+			return p.microRpcService.Run()
+		}})
+	}
+	return runners
+}
@@ -0,0 +1,37 @@
+package pi
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWaitsForStoppingAfterDrainTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newTestPi(ctx, t, "a", `, "cron": {"spec": [{"name": "job", "schedule": "@every 1s"}]}`,
+		SetDrainTimeout(10*time.Millisecond))
+
+	started := make(chan struct{})
+	var finished int32
+	p.Cron().Register("job", func(ctx context.Context) {
+		if atomic.CompareAndSwapInt32(&finished, 0, 1) {
+			close(started)
+			// the job outlives the drain timeout.
+			time.Sleep(500 * time.Millisecond)
+			atomic.StoreInt32(&finished, 2)
+		}
+	})
+
+	go func() {
+		<-started
+		cancel()
+	}()
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&finished) != 2 {
+		t.Error("Run returns before the running job finished")
+	}
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shelton-hu/logger"
+
+	"github.com/shelton-hu/pi/tracing"
+)
+
+// The keys of the log fields.
+const (
+	KeyTraceId   = "trace_id"
+	KeySpanId    = "span_id"
+	KeyService   = "service"
+	KeyNamespace = "namespace"
+	KeyApp       = "app"
+	KeyRequestId = "request_id"
+)
+
+// Field is a field of the log records.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Identity is the identity of the process added to all the log records.
+type Identity struct {
+	Service   string
+	Namespace string
+	App       string
+}
+
+// std holds the identity of the process.
+var std atomic.Value
+
+func init() {
+	std.Store(Identity{})
+}
+
+// Setup sets the identity of the process, and makes the logger append the fields
+// of the context to every log record, e.g.
+//
+//	2006-01-02 15:04:05 -INFO- message (file.go:10) trace_id=... span_id=... service=... namespace=... app=...
+func Setup(identity Identity) {
+	std.Store(identity)
+	logger.SetSuffixFn(Suffix)
+}
+
+// fieldsKey is the context key of the fields added by WithFields.
+type fieldsKey struct{}
+
+// WithFields returns the context whose log records carry the fields, which are
+// appended to the fields of ctx.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	old, _ := ctx.Value(fieldsKey{}).([]Field)
+	newFields := make([]Field, 0, len(old)+len(fields))
+	newFields = append(newFields, old...)
+	newFields = append(newFields, fields...)
+	return context.WithValue(ctx, fieldsKey{}, newFields)
+}
+
+// Fields returns the fields of the log records of ctx, which are the trace id and
+// span id of the span in ctx, the identity of the process and the fields added by
+// WithFields. The empty fields are omitted. The application code using another
+// logger can log with the same fields by it.
+func Fields(ctx context.Context) []Field {
+	var fields []Field
+	add := func(key, value string) {
+		if value != "" {
+			fields = append(fields, Field{Key: key, Value: value})
+		}
+	}
+
+	if ctx != nil {
+		if span := tracing.SpanFromContext(ctx); span != nil {
+			add(KeyTraceId, span.TraceID())
+			add(KeySpanId, span.SpanID())
+		}
+	}
+	identity := std.Load().(Identity)
+	add(KeyService, identity.Service)
+	add(KeyNamespace, identity.Namespace)
+	add(KeyApp, identity.App)
+	if ctx != nil {
+		extra, _ := ctx.Value(fieldsKey{}).([]Field)
+		for _, field := range extra {
+			add(field.Key, field.Value)
+		}
+	}
+	return fields
+}
+
+// Suffix returns the fields of ctx in the logfmt format, which is the suffix of
+// the log records.
+func Suffix(ctx context.Context) string {
+	var b strings.Builder
+	for _, field := range Fields(ctx) {
+		b.WriteString(" ")
+		b.WriteString(field.Key)
+		b.WriteString("=")
+		b.WriteString(quote(field.Value))
+	}
+	return b.String()
+}
+
+// quote quotes the value which contains the spaces, quotes or equal signs.
+func quote(value string) string {
+	if !strings.ContainsAny(value, " \"=") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
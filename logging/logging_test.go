@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/shelton-hu/pi/tracing"
+)
+
+// setIdentity sets the identity of the process during the test.
+func setIdentity(t *testing.T, identity Identity) {
+	old := std.Load()
+	std.Store(identity)
+	t.Cleanup(func() { std.Store(old) })
+}
+
+func TestWithFields(t *testing.T) {
+	setIdentity(t, Identity{})
+	parent := WithFields(context.Background(), Field{KeyRequestId, "1"})
+	a := WithFields(parent, Field{"user", "a"})
+	b := WithFields(parent, Field{"user", "b"}, Field{"empty", ""})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []Field
+	}{
+		{name: "none", ctx: context.Background()},
+		{name: "nil context"},
+		{name: "parent", ctx: parent, want: []Field{{KeyRequestId, "1"}}},
+		{name: "appended to the parent", ctx: a, want: []Field{{KeyRequestId, "1"}, {"user", "a"}}},
+		{name: "siblings don't share", ctx: b, want: []Field{{KeyRequestId, "1"}, {"user", "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fields(tt.ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	setIdentity(t, Identity{Service: "svc", App: "app"})
+	tracer, _ := tracing.NewMemoryTracer("svc")
+	ctx, span := tracing.StartSpan(tracing.NewContext(context.Background(), tracer), "op")
+	defer span.Finish()
+	ctx = WithFields(ctx, Field{KeyRequestId, "1"})
+
+	want := []Field{
+		{KeyTraceId, span.TraceID()},
+		{KeySpanId, span.SpanID()},
+		{KeyService, "svc"},
+		{KeyApp, "app"},
+		{KeyRequestId, "1"},
+	}
+	if got := Fields(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields() = %v, want %v", got, want)
+	}
+	if span.TraceID() == "" || span.SpanID() == "" {
+		t.Errorf("span ids = %q, %q, want recorded", span.TraceID(), span.SpanID())
+	}
+}
+
+func TestSuffix(t *testing.T) {
+	setIdentity(t, Identity{Service: "svc", Namespace: "dev"})
+	tests := []struct {
+		name   string
+		fields []Field
+		want   string
+	}{
+		{name: "identity", want: " service=svc namespace=dev"},
+		{name: "plain", fields: []Field{{"user", "bob"}}, want: " service=svc namespace=dev user=bob"},
+		{name: "space", fields: []Field{{"msg", "a b"}}, want: ` service=svc namespace=dev msg="a b"`},
+		{name: "equal sign", fields: []Field{{"q", "a=b"}}, want: ` service=svc namespace=dev q="a=b"`},
+		{name: "quote and backslash", fields: []Field{{"q", `say "hi" \o/`}}, want: ` service=svc namespace=dev q="say \"hi\" \\o/"`},
+		{name: "backslash only", fields: []Field{{"path", `a\b`}}, want: ` service=svc namespace=dev path=a\b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Suffix(WithFields(context.Background(), tt.fields...)); got != tt.want {
+				t.Errorf("Suffix() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	setIdentity(t, Identity{})
+	if got := Suffix(context.Background()); got != "" {
+		t.Errorf("Suffix() without fields = %q, want empty", got)
+	}
+}
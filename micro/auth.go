@@ -0,0 +1,69 @@
+package micro
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+
+	"github.com/shelton-hu/pi/auth"
+	"github.com/shelton-hu/pi/tracing"
+)
+
+// authHandlerWrapper authenticates the requests by the authenticator of inst, and
+// stores the identity in ctx, so it's forwarded by the rpc calls of the handler.
+func authHandlerWrapper(inst *Instrumentation) server.HandlerWrapper {
+	return func(hf server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, resp interface{}) error {
+			md, _ := metadata.FromContext(ctx)
+			id, err := inst.authenticator().Check(ctx, req.Service()+"."+req.Endpoint(), md)
+			if err != nil {
+				return err
+			}
+			if id != nil {
+				if span := tracing.SpanFromContext(ctx); span != nil && id.Service != "" {
+					span.SetTag("auth.service", id.Service)
+				}
+				ctx = auth.NewContext(ctx, id)
+			}
+			return hf(ctx, req, resp)
+		}
+	}
+}
+
+// authClient adds the credentials of the identity of ctx and the service to the
+// metadata of the calls and the messages.
+type authClient struct {
+	client.Client
+	inst *Instrumentation
+}
+
+// authClientWrapper ...
+func authClientWrapper(inst *Instrumentation) client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &authClient{c, inst}
+	}
+}
+
+// Call ...
+func (c *authClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	return c.Client.Call(c.injectAuth(ctx), req, rsp, opts...)
+}
+
+// Publish ...
+func (c *authClient) Publish(ctx context.Context, msg client.Message, opts ...client.PublishOption) error {
+	return c.Client.Publish(c.injectAuth(ctx), msg, opts...)
+}
+
+// injectAuth injects the credentials of ctx into the copy of the metadata of ctx
+// like injectMetadata.
+func (c *authClient) injectAuth(ctx context.Context) context.Context {
+	md, _ := metadata.FromContext(ctx)
+	newMd := make(metadata.Metadata, len(md))
+	for k, v := range md {
+		newMd[k] = v
+	}
+	c.inst.authenticator().Inject(ctx, newMd)
+	return metadata.NewContext(ctx, newMd)
+}
@@ -0,0 +1,248 @@
+package micro
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+const (
+	// The defaults of the client policy.
+	_DefaultClientTimeout      = 5000
+	_DefaultClientRetries      = 1
+	_DefaultClientBackoff      = 100
+	_DefaultClientMaxBackoff   = 2000
+	_DefaultBreakerOpenTimeout = 10
+)
+
+// ClientPolicy applies the timeouts, retries and circuit breakers of the config
+// to the rpc calls of the client.
+type ClientPolicy struct {
+	cfg config.Client
+
+	// breakers are the circuit breakers of the endpoints, which are keyed by the
+	// breaker key of the endpoint, see lookup.
+	breakers map[string]*breaker
+
+	mu sync.RWMutex
+}
+
+// NewClientPolicy returns the client policy of the config.
+func NewClientPolicy(clientConfig config.Client) *ClientPolicy {
+	return &ClientPolicy{
+		cfg:      clientConfig,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// Update replaces the config of the policy, the breakers are reset.
+func (p *ClientPolicy) Update(clientConfig config.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cfg = clientConfig
+	p.breakers = make(map[string]*breaker)
+}
+
+// Wrapper returns the client wrapper which applies the policy.
+func (p *ClientPolicy) Wrapper() client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &policyClient{
+			Client: c,
+			policy: p,
+		}
+	}
+}
+
+// lookup returns the policy of the endpoint and the key of its breaker. The key is
+// the endpoint when the endpoint has its own policy, or else the service, so the
+// endpoints using the default policy share the breaker of their service only.
+func (p *ClientPolicy) lookup(service, endpoint string) (string, config.ClientPolicy) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key := service + "." + endpoint
+	policy, ok := p.cfg.Endpoints[key]
+	if !ok {
+		key = service
+		policy = p.cfg.Endpoints[key]
+	}
+	return key, mergePolicy(policy, p.cfg.Default)
+}
+
+// breaker returns the breaker of the key, or nil when the breaker is disabled.
+func (p *ClientPolicy) breaker(key string, policy config.ClientPolicy) *breaker {
+	if policy.Breaker.Failures == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b, ok := p.breakers[key]
+	if !ok {
+		b = newBreaker(policy.Breaker.Failures, time.Duration(policy.Breaker.OpenTimeout)*time.Second)
+		p.breakers[key] = b
+	}
+	return b
+}
+
+// mergePolicy returns the policy whose unset fields are set by the default policy,
+// and then by the defaults.
+func mergePolicy(policy, def config.ClientPolicy) config.ClientPolicy {
+	merge := func(v *int, defs ...int) {
+		for _, d := range defs {
+			if *v != 0 {
+				return
+			}
+			*v = d
+		}
+	}
+	merge(&policy.Timeout, def.Timeout, _DefaultClientTimeout)
+	merge(&policy.Retries, def.Retries, _DefaultClientRetries)
+	merge(&policy.Backoff, def.Backoff, _DefaultClientBackoff)
+	merge(&policy.MaxBackoff, def.MaxBackoff, _DefaultClientMaxBackoff)
+	merge(&policy.Breaker.Failures, def.Breaker.Failures)
+	merge(&policy.Breaker.OpenTimeout, def.Breaker.OpenTimeout, _DefaultBreakerOpenTimeout)
+	if policy.Retries < 0 {
+		policy.Retries = 0
+	}
+	return policy
+}
+
+// policyClient ...
+type policyClient struct {
+	client.Client
+	policy *ClientPolicy
+}
+
+// Call rejects the call when the breaker of the endpoint is open, or else calls
+// with the timeout and retries of the endpoint. The options of the call take
+// precedence over the policy except the timeout.
+func (c *policyClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	key, policy := c.policy.lookup(req.Service(), req.Endpoint())
+	b := c.policy.breaker(key, policy)
+	if b != nil && !b.allow() {
+		return piErrors.Unavailablef("circuit breaker of %s.%s is open", req.Service(), req.Endpoint())
+	}
+
+	// the request timeout of the client is ignored when ctx has a deadline, e.g. the
+	// ctx of a handler, so the earlier one of them is used.
+	timeout := time.Duration(policy.Timeout) * time.Millisecond
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff, maxBackoff := time.Duration(policy.Backoff)*time.Millisecond, time.Duration(policy.MaxBackoff)*time.Millisecond
+	callOpts := []client.CallOption{
+		client.WithRequestTimeout(timeout),
+		client.WithRetries(policy.Retries),
+		client.WithRetry(func(ctx context.Context, req client.Request, retryCount int, err error) (bool, error) {
+			return IsRetriable(err), nil
+		}),
+		client.WithBackoff(func(ctx context.Context, req client.Request, attempts int) (time.Duration, error) {
+			if attempts == 0 {
+				return 0, nil
+			}
+			d := backoff << uint(attempts-1)
+			if d > maxBackoff || d <= 0 {
+				d = maxBackoff
+			}
+			return d, nil
+		}),
+	}
+	err := c.Client.Call(ctx, req, rsp, append(callOpts, opts...)...)
+	if b != nil {
+		b.done(!isFailure(err))
+	}
+	return err
+}
+
+// IsRetriable returns true when the call may succeed by retrying, i.e. the pi error
+// of the handler is retriable, or the call timed out, the service was unavailable,
+// or the client failed to reach the service.
+func IsRetriable(err error) bool {
+	return piErrors.IsRetriable(err)
+}
+
+// isFailure returns true when the error means the endpoint is unhealthy, rather
+// than the request is bad.
+func isFailure(err error) bool {
+	return err != nil && piErrors.HTTPStatus(err) >= 500
+}
+
+// The states of the breaker.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is the circuit breaker of an endpoint. It's opened by the consecutive
+// failures, and half opened after the open timeout, when a call is let through to
+// probe the endpoint, which closes it if succeeded or opens it again.
+type breaker struct {
+	failures    int
+	openTimeout time.Duration
+
+	state       int
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+	mu          sync.Mutex
+}
+
+// newBreaker ...
+func newBreaker(failures int, openTimeout time.Duration) *breaker {
+	return &breaker{
+		failures:    failures,
+		openTimeout: openTimeout,
+	}
+}
+
+// allow returns true when the call is let through.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// done records the result of the call which was let through.
+func (b *breaker) done(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.state = breakerClosed
+		b.consecutive = 0
+		b.probing = false
+		return
+	}
+
+	b.consecutive++
+	if b.state == breakerHalfOpen || b.consecutive >= b.failures {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
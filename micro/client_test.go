@@ -0,0 +1,112 @@
+package micro
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+func TestClientPolicyLookup(t *testing.T) {
+	p := NewClientPolicy(config.Client{
+		Default: config.ClientPolicy{Timeout: 1000, Breaker: config.Breaker{Failures: 3}},
+		Endpoints: map[string]config.ClientPolicy{
+			"user":            {Retries: 2},
+			"order.Order.Get": {Timeout: 200, Retries: -1},
+		},
+	})
+
+	tests := []struct {
+		service, endpoint string
+		wantKey           string
+		wantTimeout       int
+		wantRetries       int
+	}{
+		{"order", "Order.Get", "order.Order.Get", 200, 0},
+		{"order", "Order.List", "order", 1000, _DefaultClientRetries},
+		{"user", "User.Get", "user", 1000, 2},
+		{"pay", "Pay.Create", "pay", 1000, _DefaultClientRetries},
+		{"stock", "Stock.Get", "stock", 1000, _DefaultClientRetries},
+	}
+	for _, tt := range tests {
+		key, policy := p.lookup(tt.service, tt.endpoint)
+		if key != tt.wantKey {
+			t.Errorf("lookup(%s, %s) key = %q, want %q", tt.service, tt.endpoint, key, tt.wantKey)
+		}
+		if policy.Timeout != tt.wantTimeout || policy.Retries != tt.wantRetries {
+			t.Errorf("lookup(%s, %s) = timeout %d retries %d, want %d %d", tt.service, tt.endpoint,
+				policy.Timeout, policy.Retries, tt.wantTimeout, tt.wantRetries)
+		}
+		if policy.Breaker.Failures != 3 || policy.Breaker.OpenTimeout != _DefaultBreakerOpenTimeout {
+			t.Errorf("lookup(%s, %s) breaker = %+v", tt.service, tt.endpoint, policy.Breaker)
+		}
+	}
+}
+
+func TestClientPolicyBreakerIsolation(t *testing.T) {
+	p := NewClientPolicy(config.Client{
+		Default: config.ClientPolicy{Breaker: config.Breaker{Failures: 1}},
+	})
+	breakerOf := func(service, endpoint string) *breaker {
+		return p.breaker(p.lookup(service, endpoint))
+	}
+
+	// a failing service using the default policy doesn't open the breaker of others.
+	pay := breakerOf("pay", "Pay.Create")
+	if !pay.allow() {
+		t.Fatal("new breaker rejects the call")
+	}
+	pay.done(false)
+	if breakerOf("pay", "Pay.Refund").allow() {
+		t.Error("breaker of the failing service allows the call")
+	}
+	if !breakerOf("stock", "Stock.Get").allow() {
+		t.Error("breaker of another service rejects the call")
+	}
+
+	p.Update(config.Client{})
+	if b := breakerOf("pay", "Pay.Create"); b != nil {
+		t.Errorf("breaker = %+v, want nil when disabled", b)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 50*time.Millisecond)
+
+	steps := []struct {
+		sleep     time.Duration
+		wantAllow bool
+		success   bool
+	}{
+		{wantAllow: true, success: false},
+		{wantAllow: true, success: false}, // opened by 2 consecutive failures
+		{wantAllow: false},
+		{sleep: 60 * time.Millisecond, wantAllow: true, success: false}, // the probe fails
+		{wantAllow: false},
+		{sleep: 60 * time.Millisecond, wantAllow: true, success: true}, // the probe closes it
+		{wantAllow: true, success: false},
+		{wantAllow: true, success: true},
+	}
+	for i, step := range steps {
+		time.Sleep(step.sleep)
+		allow := b.allow()
+		if allow != step.wantAllow {
+			t.Fatalf("step %d: allow = %v, want %v", i, allow, step.wantAllow)
+		}
+		if allow {
+			b.done(step.success)
+		}
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	b := newBreaker(1, 0)
+	b.allow()
+	b.done(false)
+	if !b.allow() {
+		t.Fatal("open breaker doesn't let the probe through after the timeout")
+	}
+	if b.allow() {
+		t.Error("half open breaker lets the second call through while probing")
+	}
+}
@@ -4,3 +4,14 @@ const (
 	// _DefaultDevRegistry is the default value of the dev etcd registry.
 	_DefaultDevRegistry = "127.0.0.1:2379"
 )
+
+const (
+	// FlagEnv is the flag name of the app runtime environment.
+	FlagEnv = "env"
+
+	// FlagLocalConfig is the flag name of the app config file path.
+	FlagLocalConfig = "localConfig"
+
+	// FlagEtcdAddrs is the flag name of the etcd address.
+	FlagEtcdAddrs = "etcdAddrs"
+)
@@ -0,0 +1,31 @@
+package micro
+
+import (
+	"os"
+	"strings"
+)
+
+// LookupFlag returns the value of the flag from the command line arguments. It can
+// be called before the micro service parses the flags, e.g. for loading the config.
+func LookupFlag(name string) string {
+	args := os.Args[1:]
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name {
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+			return ""
+		}
+		if strings.HasPrefix(arg, name+"=") {
+			return strings.TrimPrefix(arg, name+"=")
+		}
+	}
+	return ""
+}
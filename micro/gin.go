@@ -0,0 +1,293 @@
+package micro
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/shelton-hu/logger"
+	"github.com/shelton-hu/util/idutil"
+
+	"github.com/shelton-hu/pi/auth"
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+	"github.com/shelton-hu/pi/logging"
+	"github.com/shelton-hu/pi/tracing"
+)
+
+const (
+	// HeaderRequestId is the header of the request id, which is generated when the
+	// request doesn't carry one.
+	HeaderRequestId = "X-Request-Id"
+
+	// _MaxRequestIdLength is the max length of the request id of the request.
+	_MaxRequestIdLength = 128
+)
+
+var (
+	// _DefaultCorsMethods are the methods allowed by default.
+	_DefaultCorsMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+	// _DefaultCorsHeaders are the headers allowed by default.
+	_DefaultCorsHeaders = []string{"Origin", "Content-Type", auth.HeaderAuthorization, HeaderRequestId}
+)
+
+// NewGinEngine returns the gin engine with the standard middlewares, which are
+// followed by the middlewares of the arguments:
+//
+//	request id  the request id of the header, or a generated one, is set in the
+//	            response header and the log fields of the request context
+//	trace       the server span of the request is the child of the remote span of
+//	            the headers like traceHandlerWrapper
+//	log         the request is logged like traceHandlerWrapper
+//	recover     the panic is responded as the json internal error
+//	cors        the cors policy, see Cors
+//	auth        the requests are authenticated, see auth.GinMiddleware
+//	errors      the last error of the context, see GinError, is responded as json
+//
+// The requests are traced and authenticated by inst, which may be nil for the
+// globals. The unknown routes are responded as the json not found error.
+func NewGinEngine(inst *Instrumentation, cors *Cors, middlewares ...gin.HandlerFunc) *gin.Engine {
+	engine := gin.New()
+	engine.Use(ginRequestId(), ginTrace(inst), ginLog(), ginRecover(), cors.Middleware(), ginAuth(inst), ginErrors())
+	engine.Use(middlewares...)
+	engine.NoRoute(func(c *gin.Context) {
+		GinError(c, piErrors.NotFoundf("%s %s not found", c.Request.Method, c.Request.URL.Path))
+	})
+	return engine
+}
+
+// GinError responds the error as json with the http status of its code, and aborts
+// the handlers, e.g.
+//
+//	if err != nil {
+//		micro.GinError(c, err)
+//		return
+//	}
+func GinError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	piErrors.WriteHTTP(c.Writer, err)
+	c.Abort()
+}
+
+// ginRequestId ...
+func ginRequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(HeaderRequestId)
+		if !validRequestId(requestId) {
+			requestId = idutil.GenUuid()
+		}
+		c.Header(HeaderRequestId, requestId)
+		ctx := logging.WithFields(c.Request.Context(), logging.Field{Key: logging.KeyRequestId, Value: requestId})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// ginTrace starts the server span of the request by the tracer of inst, which is
+// named by the method and the route.
+func ginTrace(inst *Instrumentation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		headers := make(map[string]string, len(c.Request.Header))
+		for k, values := range c.Request.Header {
+			if len(values) > 0 {
+				headers[k] = values[0]
+			}
+		}
+		name := c.Request.Method
+		if route := c.FullPath(); route != "" {
+			name += " " + route
+		}
+		ctx := tracing.Extract(inst.withTracer(c.Request.Context()), headers)
+		ctx, span := tracing.StartSpan(ctx, name, tracing.SetSpanKind(tracing.KindServer))
+		defer span.Finish()
+		span.SetTag("http.method", c.Request.Method)
+		span.SetTag("http.path", c.Request.URL.Path)
+		span.SetTag("http.route", c.FullPath())
+		if requestId := c.Writer.Header().Get(HeaderRequestId); requestId != "" {
+			span.SetTag(logging.KeyRequestId, requestId)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetTag("http.status_code", status)
+		if err := c.Errors.Last(); err != nil {
+			span.SetError(err.Err)
+			span.SetTag("error.code", string(piErrors.CodeOf(err.Err)))
+		} else if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+	}
+}
+
+// ginAuth returns the auth middleware of the authenticator of inst, or the one of
+// the default authenticator.
+func ginAuth(inst *Instrumentation) gin.HandlerFunc {
+	if inst == nil || inst.Authenticator == nil {
+		return auth.GinMiddleware()
+	}
+	return inst.Authenticator.GinMiddleware()
+}
+
+// ginLog logs the request, whose query is omitted as it may carry the credentials.
+func ginLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		begin := time.Now()
+		c.Next()
+		end := time.Now()
+
+		var errStr string
+		if err := c.Errors.Last(); err != nil {
+			errStr = errString(err.Err)
+		}
+		logger.Info(c.Request.Context(), "%s %s, %d, %s, %f", c.Request.Method, c.Request.URL.Path, c.Writer.Status(), errStr, float64(end.Sub(begin))/1e6)
+	}
+}
+
+// ginRecover recovers the panic of the handlers like recoverHandlerWrapper, and
+// responds the json internal error without the panic.
+func ginRecover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if p := recover(); p != nil {
+				GinError(c, recovered(c.Request.Context(), "web server", p))
+			}
+		}()
+		c.Next()
+	}
+}
+
+// ginErrors responds the last error of the context as json, when the handlers
+// added it by c.Error without responding.
+func ginErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if err := c.Errors.Last(); err != nil && !c.Writer.Written() {
+			piErrors.WriteHTTP(c.Writer, err.Err)
+		}
+	}
+}
+
+// validRequestId returns true when the request id is printable and not too long,
+// so it can't break the log records.
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > _MaxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(requestId); i++ {
+		if requestId[i] <= ' ' || requestId[i] > '~' || requestId[i] == '"' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cors is the cors middleware of the config, which can be updated when the config
+// changed.
+type Cors struct {
+	policy atomic.Value
+}
+
+// corsPolicy is the cors config whose headers are joined.
+type corsPolicy struct {
+	allowAll         bool
+	allowOrigins     map[string]bool
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// NewCors returns the cors middleware of the config. The credentials are allowed
+// for the listed origins only, never for the origins allowed by "*", which the
+// validation of the config also rejects with allow_credentials.
+func NewCors(corsConfig config.Cors) *Cors {
+	c := new(Cors)
+	c.Update(corsConfig)
+	return c
+}
+
+// Update replaces the config of the cors.
+func (c *Cors) Update(corsConfig config.Cors) {
+	p := &corsPolicy{
+		allowOrigins:     make(map[string]bool, len(corsConfig.AllowOrigins)),
+		allowMethods:     strings.Join(orDefault(corsConfig.AllowMethods, _DefaultCorsMethods), ", "),
+		allowHeaders:     strings.Join(orDefault(corsConfig.AllowHeaders, _DefaultCorsHeaders), ", "),
+		exposeHeaders:    strings.Join(corsConfig.ExposeHeaders, ", "),
+		allowCredentials: corsConfig.AllowCredentials,
+	}
+	for _, origin := range corsConfig.AllowOrigins {
+		if origin == "*" {
+			p.allowAll = true
+		}
+		p.allowOrigins[origin] = true
+	}
+	if corsConfig.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(corsConfig.MaxAge)
+	}
+	c.policy.Store(p)
+}
+
+// Middleware returns the gin middleware, which sets the cors headers of the requests
+// of the allowed origins, and responds the preflight requests.
+func (c *Cors) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		p := c.policy.Load().(*corsPolicy)
+		origin := ctx.GetHeader("Origin")
+		if origin == "" || len(p.allowOrigins) == 0 {
+			ctx.Next()
+			return
+		}
+
+		preflight := ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+		ctx.Writer.Header().Add("Vary", "Origin")
+		if !p.allowAll && !p.allowOrigins[origin] {
+			if preflight {
+				GinError(ctx, piErrors.PermissionDeniedf("origin %s is not allowed", origin))
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		// the credentials are only allowed for the listed origins, so any website
+		// can't read the responses of the credentialed requests by the wildcard.
+		if origin != "*" && p.allowOrigins[origin] {
+			ctx.Header("Access-Control-Allow-Origin", origin)
+			if p.allowCredentials {
+				ctx.Header("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			ctx.Header("Access-Control-Allow-Origin", "*")
+		}
+		if preflight {
+			ctx.Header("Access-Control-Allow-Methods", p.allowMethods)
+			ctx.Header("Access-Control-Allow-Headers", p.allowHeaders)
+			if p.maxAge != "" {
+				ctx.Header("Access-Control-Max-Age", p.maxAge)
+			}
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if p.exposeHeaders != "" {
+			ctx.Header("Access-Control-Expose-Headers", p.exposeHeaders)
+		}
+		ctx.Next()
+	}
+}
+
+// orDefault ...
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
@@ -0,0 +1,113 @@
+package micro
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serveCors serves the request of the origin by the engine with the cors.
+func serveCors(cors *Cors, method, origin string, preflight bool) *httptest.ResponseRecorder {
+	engine := gin.New()
+	engine.Use(cors.Middleware())
+	engine.Handle(method, "/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(method, "/", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestCors(t *testing.T) {
+	listed := config.Cors{AllowOrigins: []string{"https://a.com"}, AllowCredentials: true, MaxAge: 60}
+	wildcard := config.Cors{AllowOrigins: []string{"*"}}
+	// rejected by the validation, but the credentials are never allowed for "*".
+	wildcardCredentials := config.Cors{AllowOrigins: []string{"*", "https://a.com"}, AllowCredentials: true}
+
+	tests := []struct {
+		name            string
+		cors            config.Cors
+		method          string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantMaxAge      string
+	}{
+		{name: "no origin", cors: listed, method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "no cors", cors: config.Cors{}, method: http.MethodGet, origin: "https://a.com", wantStatus: http.StatusOK},
+		{name: "listed", cors: listed, method: http.MethodGet, origin: "https://a.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://a.com", wantCredentials: "true"},
+		{name: "not listed", cors: listed, method: http.MethodGet, origin: "https://evil.com", wantStatus: http.StatusOK},
+		{name: "preflight listed", cors: listed, method: http.MethodOptions, origin: "https://a.com", preflight: true,
+			wantStatus: http.StatusNoContent, wantOrigin: "https://a.com", wantCredentials: "true", wantMaxAge: "60"},
+		{name: "preflight not listed", cors: listed, method: http.MethodOptions, origin: "https://evil.com", preflight: true,
+			wantStatus: http.StatusForbidden},
+		{name: "wildcard", cors: wildcard, method: http.MethodGet, origin: "https://evil.com",
+			wantStatus: http.StatusOK, wantOrigin: "*"},
+		{name: "wildcard with credentials", cors: wildcardCredentials, method: http.MethodGet, origin: "https://evil.com",
+			wantStatus: http.StatusOK, wantOrigin: "*"},
+		{name: "listed with wildcard", cors: wildcardCredentials, method: http.MethodGet, origin: "https://a.com",
+			wantStatus: http.StatusOK, wantOrigin: "https://a.com", wantCredentials: "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveCors(NewCors(tt.cors), tt.method, tt.origin, tt.preflight)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			h := w.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+			if got := h.Get("Access-Control-Max-Age"); got != tt.wantMaxAge {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", got, tt.wantMaxAge)
+			}
+		})
+	}
+}
+
+func TestCorsUpdate(t *testing.T) {
+	cors := NewCors(config.Cors{AllowOrigins: []string{"https://a.com"}})
+	cors.Update(config.Cors{AllowOrigins: []string{"https://b.com"}})
+	if got := serveCors(cors, http.MethodGet, "https://a.com", false).Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("removed origin is allowed, got %q", got)
+	}
+	if got := serveCors(cors, http.MethodGet, "https://b.com", false).Header().Get("Access-Control-Allow-Origin"); got != "https://b.com" {
+		t.Errorf("added origin isn't allowed, got %q", got)
+	}
+}
+
+func TestGinRecover(t *testing.T) {
+	engine := gin.New()
+	engine.Use(ginRecover())
+	engine.GET("/", func(c *gin.Context) { panic("password=secret") })
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "secret") || !strings.Contains(body, "internal error") {
+		t.Errorf("body = %s, want the internal error without the panic", body)
+	}
+}
@@ -0,0 +1,93 @@
+package micro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/micro/go-micro/v2"
+	proto "github.com/micro/go-micro/v2/debug/service/proto"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/web"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+	"github.com/shelton-hu/pi/health"
+)
+
+// Health is the rpc handler of the health of the service, its endpoints are
+// Health.Liveness and Health.Readiness, and the status of the response is the
+// json report of all the components. Like the http handlers, Liveness fails when
+// any component is down, and Readiness also fails when the service isn't ready,
+// by the unavailable error whose "report" detail is the json report.
+type Health struct {
+	h *health.Health
+}
+
+// NewHealthHandler ...
+func NewHealthHandler(h *health.Health) *Health {
+	return &Health{
+		h: h,
+	}
+}
+
+// Liveness ...
+func (h *Health) Liveness(ctx context.Context, req *proto.HealthRequest, rsp *proto.HealthResponse) error {
+	return h.report(ctx, rsp, false)
+}
+
+// Readiness ...
+func (h *Health) Readiness(ctx context.Context, req *proto.HealthRequest, rsp *proto.HealthResponse) error {
+	return h.report(ctx, rsp, true)
+}
+
+// report sets the json report as the status of rsp, and returns the unavailable
+// error when any component is down, or the service isn't ready when readiness is
+// checked.
+func (h *Health) report(ctx context.Context, rsp *proto.HealthResponse, readiness bool) error {
+	report := h.h.Check(ctx)
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	rsp.Status = string(data)
+
+	switch {
+	case !report.Healthy():
+		return piErrors.Unavailablef("service is unhealthy").WithDetail("report", rsp.Status)
+	case readiness && !report.Ready:
+		return piErrors.Unavailablef("service is not ready").WithDetail("report", rsp.Status)
+	}
+	return nil
+}
+
+// RpcRegistryChecker returns the checker which checks the rpc service is registered.
+func RpcRegistryChecker(service micro.Service) health.Checker {
+	return func(ctx context.Context) error {
+		opts := service.Server().Options()
+		return checkRegistered(service.Options().Registry, opts.Name, opts.Name+"-"+opts.Id)
+	}
+}
+
+// WebRegistryChecker returns the checker which checks the web service is registered.
+func WebRegistryChecker(service web.Service) health.Checker {
+	return func(ctx context.Context) error {
+		opts := service.Options()
+		return checkRegistered(opts.Registry, opts.Name, opts.Id)
+	}
+}
+
+// checkRegistered returns the error when the node isn't registered.
+func checkRegistered(reg registry.Registry, name, nodeId string) error {
+	services, err := reg.GetService(name)
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			if node.Id == nodeId {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("node %s of %s is not registered", nodeId, name)
+}
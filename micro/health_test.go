@@ -0,0 +1,90 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	proto "github.com/micro/go-micro/v2/debug/service/proto"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+	"github.com/shelton-hu/pi/health"
+)
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		ready         bool
+		down          bool
+		wantLiveness  bool
+		wantReadiness bool
+	}{
+		{name: "ready", ready: true, wantLiveness: true, wantReadiness: true},
+		{name: "not ready", ready: false, wantLiveness: true, wantReadiness: false},
+		{name: "down", ready: true, down: true, wantLiveness: false, wantReadiness: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := health.New()
+			h.SetReady(tt.ready)
+			h.Register("component", func(ctx context.Context) error {
+				if tt.down {
+					return errors.New("down")
+				}
+				return nil
+			})
+			handler := NewHealthHandler(h)
+
+			check := func(endpoint string, fn func(context.Context, *proto.HealthRequest, *proto.HealthResponse) error, want bool) {
+				rsp := new(proto.HealthResponse)
+				err := fn(context.Background(), new(proto.HealthRequest), rsp)
+				if rsp.Status == "" {
+					t.Errorf("%s status is empty", endpoint)
+				}
+				if want {
+					if err != nil {
+						t.Errorf("%s = %v, want nil", endpoint, err)
+					}
+					return
+				}
+				if code := piErrors.CodeOf(err); code != piErrors.Unavailable {
+					t.Errorf("%s = %v, want unavailable", endpoint, err)
+				}
+				if report := piErrors.FromError(err).Details["report"]; report != rsp.Status {
+					t.Errorf("%s report detail = %s, want %s", endpoint, report, rsp.Status)
+				}
+			}
+			check("Liveness", handler.Liveness, tt.wantLiveness)
+			check("Readiness", handler.Readiness, tt.wantReadiness)
+		})
+	}
+}
+
+func TestCheckRegistered(t *testing.T) {
+	reg := memory.NewRegistry()
+	if err := reg.Register(&registry.Service{
+		Name:  "svc",
+		Nodes: []*registry.Node{{Id: "svc-1", Address: "127.0.0.1:8080"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		service string
+		nodeId  string
+		wantErr bool
+	}{
+		{name: "registered", service: "svc", nodeId: "svc-1"},
+		{name: "node not registered", service: "svc", nodeId: "svc-2", wantErr: true},
+		{name: "service not registered", service: "other", nodeId: "other-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRegistered(reg, tt.service, tt.nodeId); (err != nil) != tt.wantErr {
+				t.Errorf("checkRegistered() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package micro
+
+import (
+	"context"
+
+	"github.com/shelton-hu/pi/auth"
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
+)
+
+// Instrumentation is the tracer, redaction policy and authenticator of the rpc
+// wrappers and the gin middlewares, e.g. the ones of a pi. The globals of the
+// tracing, redact and auth packages are used for the nil ones.
+type Instrumentation struct {
+	Tracer        tracing.Tracer
+	Redaction     *redact.Policy
+	Authenticator *auth.Authenticator
+}
+
+// withTracer returns the context carrying the tracer, so the spans of the request
+// and of the calls with its context are recorded by the tracer.
+func (i *Instrumentation) withTracer(ctx context.Context) context.Context {
+	if i == nil {
+		return ctx
+	}
+	return tracing.NewContext(ctx, i.Tracer)
+}
+
+// redaction ...
+func (i *Instrumentation) redaction() *redact.Policy {
+	if i == nil || i.Redaction == nil {
+		return redact.Default()
+	}
+	return i.Redaction
+}
+
+// authenticator ...
+func (i *Instrumentation) authenticator() *auth.Authenticator {
+	if i == nil || i.Authenticator == nil {
+		return auth.Default()
+	}
+	return i.Authenticator
+}
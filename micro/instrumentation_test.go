@@ -0,0 +1,112 @@
+package micro
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/micro/go-micro/v2/server"
+
+	"github.com/shelton-hu/pi/auth"
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
+)
+
+// bodyRequest is the request of the endpoint of the service with the body.
+type bodyRequest struct {
+	limitRequest
+	body interface{}
+}
+
+// Body ...
+func (r *bodyRequest) Body() interface{} { return r.body }
+
+// testInstrumentation returns the instrumentation which requires the credentials,
+// masks the name field and records the spans in memory.
+func testInstrumentation(t *testing.T) (*Instrumentation, func() []string) {
+	a, err := auth.New(config.Auth{Required: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer, exporter := tracing.NewMemoryTracer("test")
+	inst := &Instrumentation{
+		Tracer:        tracer,
+		Redaction:     redact.NewPolicy(config.Redaction{DenyFields: []string{"name"}}),
+		Authenticator: a,
+	}
+	spans := func() []string {
+		var names []string
+		for _, span := range exporter.GetSpans() {
+			names = append(names, span.Name)
+			for _, event := range span.Events {
+				for _, attr := range event.Attributes {
+					names = append(names, string(attr.Key)+"="+attr.Value.Emit())
+				}
+			}
+		}
+		return names
+	}
+	return inst, spans
+}
+
+func TestInstrumentationRpc(t *testing.T) {
+	inst, spans := testInstrumentation(t)
+	handler := func(ctx context.Context, req server.Request, resp interface{}) error { return nil }
+	req := &bodyRequest{limitRequest{service: "svc", endpoint: "User.Get"}, map[string]string{"name": "bob"}}
+
+	// the default authenticator doesn't require the credentials.
+	hf := traceHandlerWrapper(nil)(authHandlerWrapper(nil)(handler))
+	if err := hf(context.Background(), req, nil); err != nil {
+		t.Fatalf("call by the globals = %v, want permitted", err)
+	}
+	if got := spans(); len(got) != 0 {
+		t.Errorf("spans of the instrumentation = %v, want none by the globals", got)
+	}
+
+	hf = traceHandlerWrapper(inst)(authHandlerWrapper(inst)(handler))
+	err := hf(context.Background(), req, nil)
+	if code := piErrors.CodeOf(err); code != piErrors.Unauthenticated {
+		t.Errorf("call by the instrumentation = %v, want unauthenticated", err)
+	}
+	got := strings.Join(spans(), " ")
+	if !strings.Contains(got, "svc.User.Get") {
+		t.Errorf("spans = %s, want the server span", got)
+	}
+	if !strings.Contains(got, `request={"name":"`+redact.Mask+`"}`) {
+		t.Errorf("spans = %s, want the request masked by the policy", got)
+	}
+}
+
+func TestInstrumentationGin(t *testing.T) {
+	inst, spans := testInstrumentation(t)
+	tests := []struct {
+		name       string
+		inst       *Instrumentation
+		wantStatus int
+		wantSpan   bool
+	}{
+		{name: "globals", wantStatus: http.StatusOK},
+		{name: "instrumentation", inst: inst, wantStatus: http.StatusUnauthorized, wantSpan: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewGinEngine(tt.inst, NewCors(config.Cors{}))
+			engine.GET("/users", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			got := strings.Join(spans(), " ")
+			if strings.Contains(got, "GET /users") != tt.wantSpan {
+				t.Errorf("spans = %s, want span %v", got, tt.wantSpan)
+			}
+		})
+	}
+}
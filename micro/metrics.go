@@ -0,0 +1,40 @@
+package micro
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	_MetricsNamespace = "pi"
+	_MetricsSubsystem = "rpc"
+)
+
+var (
+	// serverHandled is the number of the handled requests by the error code.
+	serverHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "server_handled_total",
+		Help:      "The number of the handled requests by the error code.",
+	}, []string{"endpoint", "code"})
+
+	// clientHandled is the number of the completed calls by the error code.
+	clientHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "client_handled_total",
+		Help:      "The number of the completed calls by the error code.",
+	}, []string{"endpoint", "code"})
+
+	// requestsLimited is the number of the requests rejected by the rate limiter.
+	requestsLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "requests_limited_total",
+		Help:      "The number of the requests rejected by the rate limiter.",
+	}, []string{"endpoint", "limit"})
+)
+
+func init() {
+	prometheus.MustRegister(serverHandled, clientHandled, requestsLimited)
+}
@@ -0,0 +1,83 @@
+package micro
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+// errClient is the client whose calls fail by err.
+type errClient struct {
+	client.Client
+	err error
+}
+
+// Call ...
+func (c *errClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	return c.err
+}
+
+func TestNewRpcServiceRegistersMetricsTwice(t *testing.T) {
+	// the services of multiple pis register the metrics of the handlers again.
+	registryConfig := config.Registry{Name: "svc", Address: "127.0.0.1:2379"}
+	for i := 0; i < 2; i++ {
+		if service := NewRpcService(context.Background(), registryConfig, nil); service == nil {
+			t.Fatal("NewRpcService() = nil")
+		}
+	}
+}
+
+func TestHandledMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		err      error
+		wantCode piErrors.Code
+	}{
+		{name: "ok", endpoint: "Metrics.Ok", wantCode: piErrors.OK},
+		{name: "not found", endpoint: "Metrics.NotFound", err: piErrors.NotFoundf("user"), wantCode: piErrors.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "svc." + tt.endpoint
+			srv := serverHandled.WithLabelValues(name, string(tt.wantCode))
+			cli := clientHandled.WithLabelValues(name, string(tt.wantCode))
+			serverBefore, clientBefore := testutil.ToFloat64(srv), testutil.ToFloat64(cli)
+
+			hf := traceHandlerWrapper(nil)(func(ctx context.Context, req server.Request, resp interface{}) error {
+				return tt.err
+			})
+			_ = hf(context.Background(), &bodyRequest{limitRequest{service: "svc", endpoint: tt.endpoint}, nil}, nil)
+			if got := testutil.ToFloat64(srv) - serverBefore; got != 1 {
+				t.Errorf("server handled %s %s = %v, want 1", name, tt.wantCode, got)
+			}
+
+			c := traceClientWrapper(nil)(&errClient{err: tt.err})
+			_ = c.Call(context.Background(), client.DefaultClient.NewRequest("svc", tt.endpoint, nil), nil)
+			if got := testutil.ToFloat64(cli) - clientBefore; got != 1 {
+				t.Errorf("client handled %s %s = %v, want 1", name, tt.wantCode, got)
+			}
+		})
+	}
+}
+
+func TestRequestsLimitedMetrics(t *testing.T) {
+	l := NewRateLimiter(config.RateLimit{Endpoints: map[string]config.Limit{"svc.Metrics.Limited": {Rate: 1}}})
+	hf := l.Wrapper()(func(ctx context.Context, req server.Request, resp interface{}) error { return nil })
+	limited := requestsLimited.WithLabelValues("svc.Metrics.Limited", _LimitRate)
+	before := testutil.ToFloat64(limited)
+
+	req := &limitRequest{service: "svc", endpoint: "Metrics.Limited"}
+	for i := 0; i < 3; i++ {
+		_ = hf(context.Background(), req, nil)
+	}
+	if got := testutil.ToFloat64(limited) - before; got != 2 {
+		t.Errorf("requests limited = %v, want 2", got)
+	}
+}
@@ -0,0 +1,302 @@
+package micro
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+
+	"github.com/shelton-hu/logger"
+
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+	"github.com/shelton-hu/pi/redis"
+)
+
+const (
+	// The kinds of the limits, which are the details and the metric labels of the
+	// rejected requests.
+	_LimitRate        = "rate"
+	_LimitConcurrency = "concurrency"
+
+	// _RateLimitKeyPrefix is the prefix of the redis keys of the distributed limits.
+	_RateLimitKeyPrefix = "ratelimit:"
+
+	// _MaxLimitKeys is the number of the limit keys, e.g. of the callers, above which
+	// the idle ones are removed.
+	_MaxLimitKeys = 10000
+
+	// _LimitKeyIdle is the duration after which an idle limit key is removed.
+	_LimitKeyIdle = time.Minute
+)
+
+// gcraScript is the generic cell rate algorithm, which stores the theoretical arrival
+// time in milliseconds. ARGV are the emission interval in milliseconds and the burst,
+// and it returns whether the request is permitted and the milliseconds to retry after.
+var gcraScript = redis.NewScript(1, `
+redis.replicate_commands()
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = t[1] * 1000 + t[2] / 1000
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+local allow_at = tat + interval - interval * burst
+if allow_at > now then
+	return {0, math.ceil(allow_at - now)}
+end
+tat = tat + interval
+redis.call("SET", KEYS[1], string.format("%.3f", tat), "PX", math.ceil(tat - now))
+return {1, 0}
+`)
+
+// RateLimiterOptions ...
+type RateLimiterOptions func(*RateLimiterOption)
+
+// RateLimiterOption ...
+type RateLimiterOption struct {
+	redis *redis.Pool
+}
+
+// SetRateLimiterRedis sets the redis pool of the distributed limits, which are
+// local limits without it.
+func SetRateLimiterRedis(redis *redis.Pool) RateLimiterOptions {
+	return func(o *RateLimiterOption) {
+		o.redis = redis
+	}
+}
+
+// RateLimiter limits the rate and the concurrency of the requests of the handlers
+// by the config, and rejects the requests over the limits by the resource exhausted
+// error, which is retriable.
+type RateLimiter struct {
+	cfg   config.RateLimit
+	redis *redis.Pool
+
+	// buckets are the local token buckets, and inflight are the concurrent requests,
+	// which are keyed by the limit key.
+	buckets  map[string]*tokenBucket
+	inflight map[string]*counter
+
+	mu sync.Mutex
+}
+
+// NewRateLimiter returns the rate limiter of the config.
+func NewRateLimiter(rateLimitConfig config.RateLimit, opts ...RateLimiterOptions) *RateLimiter {
+	o := new(RateLimiterOption)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &RateLimiter{
+		cfg:      rateLimitConfig,
+		redis:    o.redis,
+		buckets:  make(map[string]*tokenBucket),
+		inflight: make(map[string]*counter),
+	}
+}
+
+// Update replaces the config of the limiter, the local token buckets are reset.
+func (l *RateLimiter) Update(rateLimitConfig config.RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cfg = rateLimitConfig
+	l.buckets = make(map[string]*tokenBucket)
+}
+
+// Wrapper returns the handler wrapper which applies the limits.
+func (l *RateLimiter) Wrapper() server.HandlerWrapper {
+	return func(hf server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, resp interface{}) error {
+			name := req.Service() + "." + req.Endpoint()
+			key, limit := l.lookup(req.Service(), req.Endpoint())
+			if key == "" {
+				key = req.Service()
+			}
+			if limit.CallerKey != "" {
+				caller, _ := metadata.Get(ctx, limit.CallerKey)
+				key += ":" + caller
+			}
+
+			if limit.Concurrency > 0 {
+				release, ok := l.acquire(key, limit.Concurrency)
+				if !ok {
+					requestsLimited.WithLabelValues(name, _LimitConcurrency).Inc()
+					return piErrors.ResourceExhaustedf("concurrency limit of %s exceeded", name).
+						WithDetail("limit", _LimitConcurrency)
+				}
+				defer release()
+			}
+			if limit.Rate > 0 {
+				if ok, retryAfter := l.allow(ctx, key, limit); !ok {
+					requestsLimited.WithLabelValues(name, _LimitRate).Inc()
+					return piErrors.ResourceExhaustedf("rate limit of %s exceeded", name).
+						WithDetail("limit", _LimitRate).
+						WithDetail("retry_after", retryAfter.String())
+				}
+			}
+			return hf(ctx, req, resp)
+		}
+	}
+}
+
+// lookup returns the limit of the endpoint and its key like ClientPolicy.
+func (l *RateLimiter) lookup(service, endpoint string) (string, config.Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := service + "." + endpoint
+	limit, ok := l.cfg.Endpoints[key]
+	if !ok {
+		key = service
+		if limit, ok = l.cfg.Endpoints[key]; !ok {
+			key = ""
+		}
+	}
+	return key, mergeLimit(limit, l.cfg.Default)
+}
+
+// allow returns true when the rate limit permits the request, or else the duration
+// to retry after. The distributed limit permits the request when redis fails.
+func (l *RateLimiter) allow(ctx context.Context, key string, limit config.Limit) (bool, time.Duration) {
+	if limit.Distributed && l.redis != nil {
+		interval := 1000 / limit.Rate
+		reply, err := l.redis.Get(ctx).Eval(gcraScript, []string{_RateLimitKeyPrefix + key}, interval, limit.Burst)
+		values, ok := reply.([]interface{})
+		if err == nil && ok && len(values) == 2 {
+			allowed, _ := values[0].(int64)
+			retryAfter, _ := values[1].(int64)
+			return allowed == 1, time.Duration(retryAfter) * time.Millisecond
+		}
+		logger.Error(ctx, "rate limit of %s by redis failed, %v, %v", key, reply, err)
+		return true, 0
+	}
+
+	l.mu.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= _MaxLimitKeys {
+			for k, b := range l.buckets {
+				if b.idle(_LimitKeyIdle) {
+					delete(l.buckets, k)
+				}
+			}
+		}
+		b = newTokenBucket(limit.Rate, limit.Burst)
+		l.buckets[key] = b
+	}
+	l.mu.Unlock()
+	return b.take()
+}
+
+// acquire returns the function releasing the request when the concurrency limit
+// permits it.
+func (l *RateLimiter) acquire(key string, concurrency int) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.inflight[key]
+	if !ok {
+		if len(l.inflight) >= _MaxLimitKeys {
+			for k, c := range l.inflight {
+				if c.n == 0 {
+					delete(l.inflight, k)
+				}
+			}
+		}
+		c = new(counter)
+		l.inflight[key] = c
+	}
+	if c.n >= concurrency {
+		return nil, false
+	}
+	c.n++
+	return func() {
+		l.mu.Lock()
+		c.n--
+		l.mu.Unlock()
+	}, true
+}
+
+// mergeLimit returns the limit whose unset fields are set by the default limit.
+// The rate and the concurrency which are -1 are disabled as 0.
+func mergeLimit(limit, def config.Limit) config.Limit {
+	if limit.Rate == 0 {
+		limit.Rate = def.Rate
+	}
+	if limit.Burst == 0 {
+		limit.Burst = def.Burst
+	}
+	if limit.Concurrency == 0 {
+		limit.Concurrency = def.Concurrency
+	}
+	if !limit.Distributed {
+		limit.Distributed = def.Distributed
+	}
+	if limit.CallerKey == "" {
+		limit.CallerKey = def.CallerKey
+	}
+	if limit.Rate < 0 {
+		limit.Rate = 0
+	}
+	if limit.Concurrency < 0 {
+		limit.Concurrency = 0
+	}
+	if limit.Burst == 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+	return limit
+}
+
+// counter is the number of the concurrent requests, which is protected by the
+// mutex of the limiter.
+type counter struct {
+	n int
+}
+
+// tokenBucket is the local rate limit, which is refilled by the rate up to the burst.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+// newTokenBucket returns the full bucket.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// take takes a token, or returns the duration until a token is refilled.
+func (b *tokenBucket) take() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// idle returns true when the bucket wasn't taken for the duration.
+func (b *tokenBucket) idle(d time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return time.Since(b.last) > d
+}
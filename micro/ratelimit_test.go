@@ -0,0 +1,160 @@
+package micro
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+
+	"github.com/shelton-hu/pi/config"
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+// limitRequest is the request of the endpoint of the service.
+type limitRequest struct {
+	server.Request
+	service, endpoint string
+}
+
+// Service ...
+func (r *limitRequest) Service() string { return r.service }
+
+// Endpoint ...
+func (r *limitRequest) Endpoint() string { return r.endpoint }
+
+func TestMergeLimit(t *testing.T) {
+	def := config.Limit{Rate: 10, Concurrency: 5, CallerKey: "X-Caller"}
+	tests := []struct {
+		name  string
+		limit config.Limit
+		want  config.Limit
+	}{
+		{name: "default", want: config.Limit{Rate: 10, Burst: 10, Concurrency: 5, CallerKey: "X-Caller"}},
+		{
+			name:  "own limit",
+			limit: config.Limit{Rate: 2.5, Concurrency: 1, Distributed: true, CallerKey: "X-User"},
+			want:  config.Limit{Rate: 2.5, Burst: 3, Concurrency: 1, Distributed: true, CallerKey: "X-User"},
+		},
+		{name: "burst", limit: config.Limit{Burst: 20}, want: config.Limit{Rate: 10, Burst: 20, Concurrency: 5, CallerKey: "X-Caller"}},
+		{name: "disabled", limit: config.Limit{Rate: -1, Concurrency: -1}, want: config.Limit{CallerKey: "X-Caller"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeLimit(tt.limit, def); got != tt.want {
+				t.Errorf("mergeLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterLookup(t *testing.T) {
+	l := NewRateLimiter(config.RateLimit{
+		Default: config.Limit{Rate: 10},
+		Endpoints: map[string]config.Limit{
+			"user":            {Rate: 5},
+			"order.Order.Get": {Rate: 1},
+		},
+	})
+	tests := []struct {
+		service, endpoint string
+		wantKey           string
+		wantRate          float64
+	}{
+		{"order", "Order.Get", "order.Order.Get", 1},
+		{"order", "Order.List", "", 10},
+		{"user", "User.Get", "user", 5},
+	}
+	for _, tt := range tests {
+		key, limit := l.lookup(tt.service, tt.endpoint)
+		if key != tt.wantKey || limit.Rate != tt.wantRate {
+			t.Errorf("lookup(%s, %s) = %q rate %v, want %q rate %v", tt.service, tt.endpoint, key, limit.Rate, tt.wantKey, tt.wantRate)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(); !ok {
+			t.Fatalf("take %d = false, want the burst permitted", i)
+		}
+	}
+	ok, retryAfter := b.take()
+	if ok {
+		t.Fatal("take = true, want the empty bucket rejected")
+	}
+	if retryAfter <= 0 || retryAfter > 100*time.Millisecond {
+		t.Errorf("retry after = %s, want within 100ms", retryAfter)
+	}
+
+	// refilled by the rate.
+	b.last = b.last.Add(-100 * time.Millisecond)
+	if ok, _ := b.take(); !ok {
+		t.Error("take = false, want the refilled token")
+	}
+	// never above the burst.
+	b.last = b.last.Add(-time.Hour)
+	b.take()
+	if b.tokens > 1 {
+		t.Errorf("tokens = %v, want at most the burst", b.tokens)
+	}
+}
+
+func TestRateLimiterWrapper(t *testing.T) {
+	l := NewRateLimiter(config.RateLimit{
+		Endpoints: map[string]config.Limit{
+			"svc.Rate.Call":        {Rate: 1, CallerKey: "X-Caller"},
+			"svc.Concurrency.Call": {Concurrency: 1},
+		},
+	})
+
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	hf := l.Wrapper()(func(ctx context.Context, req server.Request, resp interface{}) error {
+		if req.Endpoint() == "Concurrency.Call" && resp != nil {
+			close(entered)
+			<-release
+		}
+		return nil
+	})
+	call := func(endpoint, caller string, resp interface{}) error {
+		ctx := metadata.NewContext(context.Background(), metadata.Metadata{"X-Caller": caller})
+		return hf(ctx, &limitRequest{service: "svc", endpoint: endpoint}, resp)
+	}
+
+	// the rate is limited per caller.
+	if err := call("Rate.Call", "a", nil); err != nil {
+		t.Fatalf("first call of a = %v", err)
+	}
+	err := call("Rate.Call", "a", nil)
+	if e := piErrors.FromError(err); e.Code != piErrors.ResourceExhausted || e.Details["limit"] != _LimitRate {
+		t.Errorf("second call of a = %+v, want the rate limit", e)
+	}
+	if err := call("Rate.Call", "b", nil); err != nil {
+		t.Errorf("first call of b = %v, want permitted", err)
+	}
+
+	// the concurrency is released after the call.
+	done := make(chan error, 1)
+	go func() { done <- call("Concurrency.Call", "", true) }()
+	<-entered
+	err = call("Concurrency.Call", "", nil)
+	if e := piErrors.FromError(err); e.Code != piErrors.ResourceExhausted || e.Details["limit"] != _LimitConcurrency {
+		t.Errorf("concurrent call = %+v, want the concurrency limit", e)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := call("Concurrency.Call", "", nil); err != nil {
+		t.Errorf("call after release = %v, want permitted", err)
+	}
+
+	// the buckets are reset by the update.
+	l.Update(config.RateLimit{Endpoints: map[string]config.Limit{"svc.Rate.Call": {Rate: 1, CallerKey: "X-Caller"}}})
+	if err := call("Rate.Call", "a", nil); err != nil {
+		t.Errorf("call after update = %v, want permitted", err)
+	}
+}
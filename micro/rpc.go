@@ -10,14 +10,16 @@ import (
 	"github.com/micro/go-micro/v2/registry"
 	"github.com/micro/go-micro/v2/registry/etcd"
 	"github.com/micro/go-plugins/wrapper/monitoring/prometheus/v2"
-	wrapperTracing "github.com/micro/go-plugins/wrapper/trace/opentracing/v2"
-	opentracing "github.com/opentracing/opentracing-go"
 
 	"github.com/shelton-hu/pi/config"
 )
 
-// NewRpcService ...
-func NewRpcService(ctx context.Context, registryConfig config.Registry, opts ...micro.Option) micro.Service {
+// NewRpcService returns the rpc service of the registry config. The calls of its
+// client are traced and logged by the outermost client wrappers, so the calls
+// rejected by the client wrappers of opts, e.g. ClientPolicy, are also recorded.
+// The requests and the calls are traced, redacted and authenticated by inst, which
+// may be nil for the globals.
+func NewRpcService(ctx context.Context, registryConfig config.Registry, inst *Instrumentation, opts ...micro.Option) micro.Service {
 	opt := registry.Option(func(opts *registry.Options) {
 		opts.Addrs = strings.Split(registryConfig.Address, ",")
 	})
@@ -31,28 +33,30 @@ func NewRpcService(ctx context.Context, registryConfig config.Registry, opts ...
 		micro.RegisterInterval(time.Second * time.Duration(registryConfig.Interval)),
 		micro.Metadata(registryConfig.MetaData),
 		micro.Flags(&cli.StringFlag{
-			Name:  "env",
+			Name:  FlagEnv,
 			Value: "dev",
-			Usage: "app runtime environment. the default value is dev",
+			Usage: "app runtime environment, which is the config namespace when it's not set by the app",
 		}, &cli.StringFlag{
-			Name:  "localConfig",
+			Name:  FlagLocalConfig,
 			Value: "",
-			Usage: "app config file path. the default value is get by env",
+			Usage: "app config file path, which is loaded instead of etcd",
 		}, &cli.StringFlag{
-			Name:  "etcdAddrs",
+			Name:  FlagEtcdAddrs,
 			Value: _DefaultDevRegistry,
-			Usage: "etcd address. the default valu is for env",
+			Usage: "etcd addresses of the config separated by comma, which override the ones set by the app",
 		}),
 		micro.WrapHandler(
+			errorHandlerWrapper(),
+			traceHandlerWrapper(inst),
+			authHandlerWrapper(inst),
 			recoverHandlerWrapper(),
-			wrapperTracing.NewHandlerWrapper(opentracing.GlobalTracer()),
-			traceHandlerWrapper(),
 			prometheus.NewHandlerWrapper(),
 		),
-		micro.WrapSubscriber(wrapperTracing.NewSubscriberWrapper(opentracing.GlobalTracer())),
+		micro.WrapSubscriber(traceSubscriberWrapper(inst)),
 	}
 
 	opts = append(defaultOpts, opts...)
+	opts = append(opts, micro.WrapClient(recoverClientWrapper(), traceClientWrapper(inst), authClientWrapper(inst)))
 	service := micro.NewService(opts...)
 
 	return service
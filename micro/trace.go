@@ -2,30 +2,43 @@ package micro
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"runtime"
-	"strings"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/metadata"
 	"github.com/micro/go-micro/v2/server"
-	opentracing "github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
 
 	"github.com/shelton-hu/logger"
 	"github.com/shelton-hu/util/protoutil"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
 )
 
-// recoverHandlerWrapper ...
-func recoverHandlerWrapper() server.HandlerWrapper {
+// errorHandlerWrapper converts the error of the handler into the go-micro error
+// which carries the pi error, so the clients get its code, message, details and
+// retriable flag.
+func errorHandlerWrapper() server.HandlerWrapper {
 	return func(hf server.HandlerFunc) server.HandlerFunc {
 		return func(ctx context.Context, req server.Request, resp interface{}) error {
+			return piErrors.ToMicro(req.Service(), hf(ctx, req, resp))
+		}
+	}
+}
+
+// recoverHandlerWrapper recovers the panic of the inner wrappers, and returns it
+// as an internal error, like the go-micro server does for the panic of the handler.
+// The panic is logged and recorded by the span only, see recovered.
+func recoverHandlerWrapper() server.HandlerWrapper {
+	return func(hf server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, resp interface{}) (err error) {
 			defer func() {
 				if p := recover(); p != nil {
-					s := make([]byte, 2048)
-					n := runtime.Stack(s, false)
-					logger.Error(ctx, "rpc server exception, %s, %s", p, s[:n])
+					err = recovered(ctx, "rpc server", p)
 				}
 			}()
 			return hf(ctx, req, resp)
@@ -33,46 +46,178 @@ func recoverHandlerWrapper() server.HandlerWrapper {
 	}
 }
 
-// traceHandlerWrapper ...
-func traceHandlerWrapper() server.HandlerWrapper {
+// recovered logs the recovered panic with its stack and records it by the span of
+// ctx, and returns the internal error without the panic, which may carry the data
+// of the request, sql or secrets, so it isn't leaked to the caller.
+func recovered(ctx context.Context, kind string, p interface{}) error {
+	s := make([]byte, 2048)
+	n := runtime.Stack(s, false)
+	logger.Error(ctx, "%s exception, %v, %s", kind, p, s[:n])
+	if span := tracing.SpanFromContext(ctx); span != nil {
+		span.LogKV("panic", fmt.Sprintf("%v", p))
+	}
+	return piErrors.Internalf("internal error")
+}
+
+// traceHandlerWrapper starts the server span of the request by the tracer of inst
+// as the child of the remote span in the metadata, and injects it back into the
+// metadata of ctx, so the rpc calls of the handler are traced as its children. The
+// payloads are redacted by the redaction policy of inst.
+func traceHandlerWrapper(inst *Instrumentation) server.HandlerWrapper {
 	return func(hf server.HandlerFunc) server.HandlerFunc {
 		return func(ctx context.Context, req server.Request, resp interface{}) error {
-			span := opentracing.SpanFromContext(ctx)
-			request, err := json.Marshal(req.Body())
-			if err != nil {
-				logger.Error(ctx, err.Error())
-			}
-			if span != nil {
-				ext.SpanKindRPCServer.Set(span)
-				span.LogKV("request", string(request))
-			}
+			name := fmt.Sprintf("%s.%s", req.Service(), req.Endpoint())
+			ctx, span := startServerSpan(inst.withTracer(ctx), name, tracing.KindServer)
+			defer span.Finish()
+
+			policy := inst.redaction()
+			request := policy.Payload(name, req.Body())
+			span.LogKV("request", request)
 			begin := time.Now()
-			err = hf(ctx, req, resp)
+			err := hf(ctx, req, resp)
 			end := time.Now()
-			name := fmt.Sprintf("%s.%s", req.Service(), req.Endpoint())
-			afterWrapper(span, ctx, name, request, resp, float64(end.Sub(begin))/1e6, err)
+			afterWrapper(span, ctx, policy, name, request, resp, float64(end.Sub(begin))/1e6, err)
+			serverHandled.WithLabelValues(name, string(piErrors.CodeOf(err))).Inc()
+			return err
+		}
+	}
+}
+
+// traceSubscriberWrapper starts the consumer span of the message like traceHandlerWrapper.
+func traceSubscriberWrapper(inst *Instrumentation) server.SubscriberWrapper {
+	return func(sf server.SubscriberFunc) server.SubscriberFunc {
+		return func(ctx context.Context, msg server.Message) error {
+			ctx, span := startServerSpan(inst.withTracer(ctx), "Sub from "+msg.Topic(), tracing.KindConsumer)
+			defer span.Finish()
+
+			err := sf(ctx, msg)
+			span.SetError(err)
 			return err
 		}
 	}
 }
 
-// afterWrapper ...
-func afterWrapper(span opentracing.Span, ctx context.Context, name string, request []byte, resp interface{}, spend float64, err error) {
-	response, _ := protoutil.ParseProtoToString(resp.(proto.Message))
-	errStr := ""
-	if span != nil {
-		if err != nil {
-			ext.SamplingPriority.Set(span, 1)
-			errStr = err.Error()
-			ext.Error.Set(span, true)
-			span.LogKV("error_msg", errStr)
+// recoverClient recovers the panic of the client call like recoverHandlerWrapper,
+// and returns it as an internal error.
+type recoverClient struct {
+	client.Client
+}
+
+// recoverClientWrapper ...
+func recoverClientWrapper() client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &recoverClient{c}
+	}
+}
+
+// Call ...
+func (c *recoverClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ctx, "rpc client", p)
 		}
-		span.LogKV("response", response)
+	}()
+	return c.Client.Call(ctx, req, rsp, opts...)
+}
+
+// traceClient starts the client span of the call like traceHandlerWrapper, and
+// injects it into the metadata of ctx, so the server span is its child.
+type traceClient struct {
+	client.Client
+	inst *Instrumentation
+}
+
+// traceClientWrapper ...
+func traceClientWrapper(inst *Instrumentation) client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &traceClient{c, inst}
 	}
-	params := string(request)
-	if strings.Contains(strings.ToLower(name), "collection") {
-		params = "*"
+}
+
+// Call ...
+func (c *traceClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	name := fmt.Sprintf("%s.%s", req.Service(), req.Endpoint())
+	ctx, span := tracing.StartSpan(c.inst.withTracer(ctx), name, tracing.SetSpanKind(tracing.KindClient))
+	defer span.Finish()
+	ctx = injectMetadata(ctx)
+
+	policy := c.inst.redaction()
+	request := policy.Payload(name, req.Body())
+	span.LogKV("request", request)
+	begin := time.Now()
+	err := c.Client.Call(ctx, req, rsp, opts...)
+	end := time.Now()
+	response := recordResponse(span, policy, name, rsp, err)
+	clientHandled.WithLabelValues(name, string(piErrors.CodeOf(err))).Inc()
+
+	logger.Info(ctx, "call %s, %s, %v, %s, %f", name, request, response, errString(err), float64(end.Sub(begin))/1e6)
+	return err
+}
+
+// Publish ...
+func (c *traceClient) Publish(ctx context.Context, msg client.Message, opts ...client.PublishOption) error {
+	ctx, span := tracing.StartSpan(c.inst.withTracer(ctx), "Pub to "+msg.Topic(), tracing.SetSpanKind(tracing.KindProducer))
+	defer span.Finish()
+	ctx = injectMetadata(ctx)
+
+	err := c.Client.Publish(ctx, msg, opts...)
+	span.SetError(err)
+	return err
+}
+
+// startServerSpan ...
+func startServerSpan(ctx context.Context, name string, kind tracing.Kind) (context.Context, tracing.Span) {
+	md, ok := metadata.FromContext(ctx)
+	if !ok {
+		md = make(metadata.Metadata)
 	}
+	ctx = tracing.Extract(ctx, md)
+	ctx, span := tracing.StartSpan(ctx, name, tracing.SetSpanKind(kind))
+	return injectMetadata(ctx), span
+}
+
+// injectMetadata injects the span of ctx into the copy of the metadata of ctx,
+// which may be shared with the caller.
+func injectMetadata(ctx context.Context) context.Context {
+	md, _ := metadata.FromContext(ctx)
+	newMd := make(metadata.Metadata, len(md))
+	for k, v := range md {
+		newMd[k] = v
+	}
+	tracing.Inject(ctx, newMd)
+	return metadata.NewContext(ctx, newMd)
+}
+
+// afterWrapper records the response in the span and logs the request, whose payloads
+// are redacted by the policy.
+func afterWrapper(span tracing.Span, ctx context.Context, policy *redact.Policy, name string, request string, resp interface{}, spend float64, err error) {
+	response := recordResponse(span, policy, name, resp, err)
+
+	logger.Info(ctx, "%s, %s, %v, %s, %f", name, request, response, errString(err), spend)
+}
+
+// recordResponse records the response redacted by the policy, the error and its
+// code in the span, and returns the response.
+func recordResponse(span tracing.Span, policy *redact.Policy, name string, resp interface{}, err error) string {
+	var response string
+	if msg, ok := resp.(proto.Message); ok {
+		response, _ = protoutil.ParseProtoToString(msg)
+		response = policy.Payload(name, response)
+	} else {
+		response = policy.Payload(name, resp)
+	}
+	span.SetError(err)
+	if err != nil {
+		span.SetTag("error.code", string(piErrors.CodeOf(err)))
+	}
+	span.LogKV("response", response)
+	return response
+}
 
-	logger.Info(ctx, "%s, %s, %v, %s, %f", name, params, response, errStr, spend)
+// errString returns the error as the pi error, e.g. NOT_FOUND: user not found.
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return piErrors.FromError(err).Error()
 }
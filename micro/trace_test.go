@@ -0,0 +1,35 @@
+package micro
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/micro/go-micro/v2/server"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+func TestRecoverHandlerWrapper(t *testing.T) {
+	hf := recoverHandlerWrapper()(func(ctx context.Context, req server.Request, resp interface{}) error {
+		panic("password=secret")
+	})
+
+	err := piErrors.ToMicro("svc", hf(context.Background(), nil, nil))
+	e := piErrors.FromError(err)
+	if e.Code != piErrors.Internal || e.Message != "internal error" {
+		t.Errorf("error = %+v, want the internal error", e)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q leaks the panic", err.Error())
+	}
+}
+
+func TestRecoverClient(t *testing.T) {
+	c := &recoverClient{}
+	// the nil client panics.
+	err := c.Call(context.Background(), nil, nil)
+	if e := piErrors.FromError(err); e.Code != piErrors.Internal || e.Message != "internal error" {
+		t.Errorf("error = %+v, want the internal error", e)
+	}
+}
@@ -0,0 +1,31 @@
+package micro
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/server"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+	"github.com/shelton-hu/pi/tracing"
+	"github.com/shelton-hu/pi/validate"
+)
+
+// ValidateHandlerWrapper returns the optional handler wrapper which validates the
+// requests by validate.Request before the handlers run, and returns the invalid
+// argument error with the field violations, which are recorded in the span, e.g.
+//
+//	pi.SetMicroRpcOptions(goMicro.WrapHandler(micro.ValidateHandlerWrapper()))
+func ValidateHandlerWrapper() server.HandlerWrapper {
+	return func(hf server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, resp interface{}) error {
+			if err := validate.Request(req.Body()); err != nil {
+				if span := tracing.SpanFromContext(ctx); span != nil {
+					span.SetTag("validation.failed", true)
+					span.LogKV("event", "validation failed", "violations", piErrors.FromError(err).Details)
+				}
+				return err
+			}
+			return hf(ctx, req, resp)
+		}
+	}
+}
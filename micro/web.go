@@ -28,17 +28,17 @@ func NewWebService(ctx context.Context, registryConfig config.Registry, opts ...
 		web.RegisterInterval(time.Second * time.Duration(registryConfig.Interval)),
 		web.Metadata(registryConfig.MetaData),
 		web.Flags(&cli.StringFlag{
-			Name:  "env",
+			Name:  FlagEnv,
 			Value: "dev",
-			Usage: "app runtime environment. the default value is dev",
+			Usage: "app runtime environment, which is the config namespace when it's not set by the app",
 		}, &cli.StringFlag{
-			Name:  "localConfig",
+			Name:  FlagLocalConfig,
 			Value: "",
-			Usage: "app config file path. the default value is get by env",
+			Usage: "app config file path, which is loaded instead of etcd",
 		}, &cli.StringFlag{
-			Name:  "etcdAddrs",
+			Name:  FlagEtcdAddrs,
 			Value: _DefaultDevRegistry,
-			Usage: "etcd address. the default value is for env",
+			Usage: "etcd addresses of the config separated by comma, which override the ones set by the app",
 		}),
 	}
 	//合并选项
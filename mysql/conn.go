@@ -2,7 +2,11 @@ package mysql
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
@@ -10,64 +14,268 @@ import (
 	"github.com/shelton-hu/logger"
 
 	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
 )
 
-// dbPool is the pool is all registry database of mysql.
-var dbPool = make(map[string]*Mysql)
+// _DrainDuration is the duration between the old database replaced and closed when
+// reconnecting, which lets the running queries and transactions finish.
+const _DrainDuration = 30 * time.Second
+
+// std holds the default pool used by the package level functions.
+var std atomic.Value
+
+func init() {
+	std.Store(&Pool{
+		dbs:     make(map[string]*Mysql),
+		configs: make(map[string]config.Mysql),
+	})
+}
 
 // Mysql ...
 type Mysql struct {
 	*gorm.DB
 }
 
-// ConnectMysql ...
-func ConnectMysql(ctx context.Context, mysqlConfigs map[string]config.Mysql) {
+// Pool is the pool of all registry databases of mysql.
+type Pool struct {
+	// dbs is the databases by name.
+	dbs map[string]*Mysql
+
+	// configs is the configs of the databases in dbs.
+	configs map[string]config.Mysql
+
+	// mu protects dbs and configs.
+	mu sync.RWMutex
+
+	// tracer and redaction are the tracer and the redaction policy of the queries,
+	// the globals are used when they're nil.
+	tracer    tracing.Tracer
+	redaction *redact.Policy
+}
+
+// PoolOptions ...
+type PoolOptions func(*PoolOption)
+
+// PoolOption ...
+type PoolOption struct {
+	tracer    tracing.Tracer
+	redaction *redact.Policy
+}
+
+// SetPoolTracer sets the tracer of the queries, default is the global tracer.
+func SetPoolTracer(tracer tracing.Tracer) PoolOptions {
+	return func(o *PoolOption) {
+		o.tracer = tracer
+	}
+}
+
+// SetPoolRedaction sets the redaction policy of the queries, default is the
+// default policy of the redact package.
+func SetPoolRedaction(policy *redact.Policy) PoolOptions {
+	return func(o *PoolOption) {
+		o.redaction = policy
+	}
+}
+
+// NewPool connects all the databases, the "default" one must be set. The databases
+// already connected are closed when any of them fails to connect.
+func NewPool(ctx context.Context, mysqlConfigs map[string]config.Mysql, opts ...PoolOptions) (*Pool, error) {
+	if _, ok := mysqlConfigs["default"]; !ok {
+		return nil, errors.New("default db is not set")
+	}
+
+	o := new(PoolOption)
+	for _, opt := range opts {
+		opt(o)
+	}
+	p := &Pool{
+		dbs:       make(map[string]*Mysql, len(mysqlConfigs)),
+		configs:   copyConfigs(mysqlConfigs),
+		tracer:    o.tracer,
+		redaction: o.redaction,
+	}
 	for name, mysqlConfig := range mysqlConfigs {
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&loc=Local", mysqlConfig.User, mysqlConfig.Password, mysqlConfig.Host, mysqlConfig.Port, mysqlConfig.Database, mysqlConfig.Charset)
-		db, err := gorm.Open(mysqlConfig.Dialect, dsn)
+		db, err := openMysql(name, mysqlConfig, p.redaction)
 		if err != nil {
-			panic(fmt.Errorf("fatal error: connect database: %s\n", err))
+			p.Close(ctx)
+			return nil, fmt.Errorf("connect database %s: %s", name, err)
 		}
+		p.dbs[name] = db
+	}
+	return p, nil
+}
 
-		db.DB().SetMaxIdleConns(mysqlConfig.MaxIdleConnNum)
-		db.DB().SetMaxOpenConns(mysqlConfig.MaxOpenConnNum)
-		db.BlockGlobalUpdate(true)
-		db.InstantSet("gorm:save_associations", false)
-		db.InstantSet("gorm:association_save_reference", false)
+// SetDefault replaces the default pool used by the package level functions.
+func SetDefault(p *Pool) {
+	std.Store(p)
+}
 
-		addGormCallbacks(db)
+// Default returns the default pool used by the package level functions.
+func Default() *Pool {
+	return std.Load().(*Pool)
+}
 
-		dbPool[name] = &Mysql{db}
+// ConnectMysql connects the databases of the default pool, see NewPool.
+func ConnectMysql(ctx context.Context, mysqlConfigs map[string]config.Mysql) error {
+	p, err := NewPool(ctx, mysqlConfigs)
+	if err != nil {
+		return err
 	}
+	SetDefault(p)
+	return nil
+}
 
-	if _, ok := dbPool["default"]; !ok {
-		panic("default db is not set")
-	}
+// ReconnectMysql reconnects the databases of the default pool, see (*Pool).Reconnect.
+func ReconnectMysql(ctx context.Context, mysqlConfigs map[string]config.Mysql) error {
+	return Default().Reconnect(ctx, mysqlConfigs)
 }
 
 // CloseMysql ...
 func CloseMysql(ctx context.Context) {
-	for _, db := range dbPool {
+	Default().Close(ctx)
+}
+
+// GetContect returns the mysql instance of the default pool.
+func GetConnect(ctx context.Context, name ...string) *Mysql {
+	return Default().Get(ctx, name...)
+}
+
+// Reconnect replaces the databases whose config changed by the new connected
+// ones, and closes the old ones after draining. The databases keep unchanged when
+// any of them fails to connect.
+func (p *Pool) Reconnect(ctx context.Context, mysqlConfigs map[string]config.Mysql) error {
+	if _, ok := mysqlConfigs["default"]; !ok {
+		return errors.New("default db is not set")
+	}
+
+	p.mu.RLock()
+	oldPool, oldConfigs := p.dbs, p.configs
+	p.mu.RUnlock()
+
+	pool := make(map[string]*Mysql, len(mysqlConfigs))
+	for name, mysqlConfig := range mysqlConfigs {
+		db, ok := oldPool[name]
+		if ok && equalConn(oldConfigs[name], mysqlConfig) {
+			// only the pool limits changed, which can be applied in place.
+			db.DB.DB().SetMaxIdleConns(mysqlConfig.MaxIdleConnNum)
+			db.DB.DB().SetMaxOpenConns(mysqlConfig.MaxOpenConnNum)
+			pool[name] = db
+			continue
+		}
+		db, err := openMysql(name, mysqlConfig, p.redaction)
+		if err != nil {
+			for newName, newDb := range pool {
+				if newDb != oldPool[newName] {
+					_ = newDb.Close()
+				}
+			}
+			return fmt.Errorf("connect database %s: %s", name, err)
+		}
+		pool[name] = db
+	}
+
+	p.mu.Lock()
+	p.dbs = pool
+	p.configs = copyConfigs(mysqlConfigs)
+	p.mu.Unlock()
+
+	for name, db := range oldPool {
+		if pool[name] == db {
+			continue
+		}
+		logger.Info(ctx, "database %s was replaced, close it after %s", name, _DrainDuration)
+		closeMysqlLater(ctx, db)
+	}
+	return nil
+}
+
+// Close closes all the databases.
+func (p *Pool) Close(ctx context.Context) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, db := range p.dbs {
 		if err := db.Close(); err != nil {
 			logger.Error(ctx, err.Error())
 		}
 	}
 }
 
-// GetContect returns the mysql instance.
-func GetConnect(ctx context.Context, name ...string) *Mysql {
+// Check pings all the databases.
+func (p *Pool) Check(ctx context.Context) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for name, db := range p.dbs {
+		if err := db.DB.DB().PingContext(ctx); err != nil {
+			return fmt.Errorf("ping database %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// Get returns the mysql instance by name, which is "default" if not given.
+func (p *Pool) Get(ctx context.Context, name ...string) *Mysql {
 	key := "default"
 	if len(name) > 0 {
 		key = name[0]
 	}
 
-	db, ok := dbPool[key]
+	p.mu.RLock()
+	db, ok := p.dbs[key]
 	if !ok {
 		logger.Error(ctx, "db name is wrong")
-		db = dbPool["default"]
+		db = p.dbs["default"]
+	}
+	p.mu.RUnlock()
+
+	return db.withContext(tracing.NewContext(ctx, p.tracer))
+}
+
+// openMysql opens the database of the name, whose queries are redacted by the
+// policy, or by the default one when it's nil.
+func openMysql(name string, mysqlConfig config.Mysql, policy *redact.Policy) (*Mysql, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&loc=Local", mysqlConfig.User, mysqlConfig.Password, mysqlConfig.Host, mysqlConfig.Port, mysqlConfig.Database, mysqlConfig.Charset)
+	db, err := gorm.Open(mysqlConfig.Dialect, dsn)
+	if err != nil {
+		return nil, err
 	}
 
-	db.setSpanToGorm(ctx)
+	db.DB().SetMaxIdleConns(mysqlConfig.MaxIdleConnNum)
+	db.DB().SetMaxOpenConns(mysqlConfig.MaxOpenConnNum)
+	db.BlockGlobalUpdate(true)
+	db.InstantSet("gorm:save_associations", false)
+	db.InstantSet("gorm:association_save_reference", false)
 
-	return db
+	addGormCallbacks(db, policy)
+	addMetricsCallbacks(db, name)
+
+	return &Mysql{db}, nil
+}
+
+// closeMysqlLater closes the database after draining.
+func closeMysqlLater(ctx context.Context, db *Mysql) {
+	time.AfterFunc(_DrainDuration, func() {
+		if err := db.Close(); err != nil {
+			logger.Error(ctx, err.Error())
+		}
+	})
+}
+
+// equalConn returns true when the two configs connect to the same database, and
+// they differ in the pool limits at most.
+func equalConn(a, b config.Mysql) bool {
+	a.MaxIdleConnNum, a.MaxOpenConnNum = 0, 0
+	b.MaxIdleConnNum, b.MaxOpenConnNum = 0, 0
+	return a == b
+}
+
+// copyConfigs ...
+func copyConfigs(mysqlConfigs map[string]config.Mysql) map[string]config.Mysql {
+	configs := make(map[string]config.Mysql, len(mysqlConfigs))
+	for name, mysqlConfig := range mysqlConfigs {
+		configs[name] = mysqlConfig
+	}
+	return configs
 }
@@ -0,0 +1,139 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// _TestDialect is the dialect of the fake driver, which connects to any host but
+// the "down" one.
+const _TestDialect = "pitest"
+
+func init() {
+	sql.Register(_TestDialect, testDriver{})
+	dialect, _ := gorm.GetDialect("mysql")
+	gorm.RegisterDialect(_TestDialect, dialect)
+}
+
+// testDriver is the fake database driver.
+type testDriver struct{}
+
+// Open ...
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+	if strings.Contains(dsn, "tcp(down:") {
+		return nil, errors.New("connection refused")
+	}
+	return testConn{}, nil
+}
+
+// testConn is the connection of the fake driver, which runs no statements.
+type testConn struct{}
+
+// Prepare ...
+func (testConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+// Close ...
+func (testConn) Close() error { return nil }
+
+// Begin ...
+func (testConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+// testConfig returns the config of the fake database on the host.
+func testConfig(host string, maxOpen int) config.Mysql {
+	return config.Mysql{Dialect: _TestDialect, Host: host, Port: 3306, Database: "test", MaxOpenConnNum: maxOpen}
+}
+
+func TestPoolReconnect(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewPool(ctx, map[string]config.Mysql{
+		"default": testConfig("db1", 1),
+		"read":    testConfig("db1", 1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(ctx)
+	oldDefault, oldRead := p.Get(ctx).DB.DB(), p.Get(ctx, "read").DB.DB()
+
+	tests := []struct {
+		name        string
+		configs     map[string]config.Mysql
+		wantErr     bool
+		wantDefault *sql.DB
+		wantRead    *sql.DB
+		wantMaxOpen int
+	}{
+		{name: "no default", configs: map[string]config.Mysql{"read": testConfig("db2", 1)}, wantErr: true,
+			wantDefault: oldDefault, wantRead: oldRead, wantMaxOpen: 1},
+		{name: "one fails", configs: map[string]config.Mysql{"default": testConfig("db2", 1), "read": testConfig("down", 1)}, wantErr: true,
+			wantDefault: oldDefault, wantRead: oldRead, wantMaxOpen: 1},
+		{name: "pool limits in place", configs: map[string]config.Mysql{"default": testConfig("db1", 2), "read": testConfig("db1", 1)},
+			wantDefault: oldDefault, wantRead: oldRead, wantMaxOpen: 2},
+		{name: "replaced", configs: map[string]config.Mysql{"default": testConfig("db1", 2), "read": testConfig("db2", 1)},
+			wantDefault: oldDefault, wantMaxOpen: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Reconnect(ctx, tt.configs); (err != nil) != tt.wantErr {
+				t.Fatalf("Reconnect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			def, read := p.Get(ctx).DB.DB(), p.Get(ctx, "read").DB.DB()
+			if def != tt.wantDefault {
+				t.Error("default database is replaced, want kept")
+			}
+			if tt.wantRead != nil && read != tt.wantRead {
+				t.Error("read database is replaced, want kept")
+			}
+			if tt.wantRead == nil && read == oldRead {
+				t.Error("read database is kept, want replaced")
+			}
+			if got := def.Stats().MaxOpenConnections; got != tt.wantMaxOpen {
+				t.Errorf("max open connections = %d, want %d", got, tt.wantMaxOpen)
+			}
+			if err := p.Check(ctx); err != nil {
+				t.Errorf("Check() = %v", err)
+			}
+		})
+	}
+}
+
+func TestSetDefaultConcurrently(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewPool(ctx, map[string]config.Mysql{"default": testConfig("db1", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(ctx)
+	old := Default()
+	defer SetDefault(old)
+
+	// run with -race, the default pool is read while it's replaced.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = Default()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		SetDefault(p)
+	}
+	wg.Wait()
+	if Default() != p {
+		t.Error("Default() isn't the pool set by SetDefault")
+	}
+}
@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	_MetricsNamespace = "pi"
+	_MetricsSubsystem = "mysql"
+
+	_StartTimeGormKey = "metricsStartTime"
+)
+
+var (
+	// queryDuration is the duration of the gorm queries.
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "query_duration_seconds",
+		Help:      "The duration of the gorm queries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"db", "table", "operation"})
+
+	// queryErrors is the number of the failed gorm queries, the record not found
+	// errors are not counted.
+	queryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "query_errors_total",
+		Help:      "The number of the failed gorm queries.",
+	}, []string{"db", "table", "operation"})
+)
+
+func init() {
+	prometheus.MustRegister(queryDuration, queryErrors)
+}
+
+// addMetricsCallbacks adds callbacks for the metrics of the database.
+func addMetricsCallbacks(db *gorm.DB, name string) {
+	before := func(scope *gorm.Scope) {
+		scope.Set(_StartTimeGormKey, time.Now())
+	}
+	after := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			val, ok := scope.Get(_StartTimeGormKey)
+			if !ok {
+				return
+			}
+			op := operation
+			if op == "" {
+				op = strings.ToUpper(strings.Split(scope.SQL, " ")[0])
+			}
+			table := scope.TableName()
+			queryDuration.WithLabelValues(name, table, op).Observe(time.Since(val.(time.Time)).Seconds())
+			if err := queryError(scope); err != nil && !gorm.IsRecordNotFoundError(err) {
+				queryErrors.WithLabelValues(name, table, op).Inc()
+			}
+		}
+	}
+
+	beforeName, afterName := "metrics:%v_before", "metrics:%v_after"
+	db.Callback().Create().Before("gorm:create").Register(fmt.Sprintf(beforeName, "create"), before)
+	db.Callback().Create().After("gorm:create").Register(fmt.Sprintf(afterName, "create"), after("INSERT"))
+	db.Callback().Query().Before("gorm:query").Register(fmt.Sprintf(beforeName, "query"), before)
+	db.Callback().Query().After("gorm:query").Register(fmt.Sprintf(afterName, "query"), after("SELECT"))
+	db.Callback().Update().Before("gorm:update").Register(fmt.Sprintf(beforeName, "update"), before)
+	db.Callback().Update().After("gorm:update").Register(fmt.Sprintf(afterName, "update"), after("UPDATE"))
+	db.Callback().Delete().Before("gorm:delete").Register(fmt.Sprintf(beforeName, "delete"), before)
+	db.Callback().Delete().After("gorm:delete").Register(fmt.Sprintf(afterName, "delete"), after("DELETE"))
+	db.Callback().RowQuery().Before("gorm:row_query").Register(fmt.Sprintf(beforeName, "row_query"), before)
+	db.Callback().RowQuery().After("gorm:row_query").Register(fmt.Sprintf(afterName, "row_query"), after(""))
+}
+
+// queryError returns the error of the query, the one of the row query is kept in
+// its result instead of the db.
+func queryError(scope *gorm.Scope) error {
+	if result, ok := scope.InstanceGet("row_query_result"); ok {
+		if rowsResult, ok := result.(*gorm.RowsQueryResult); ok && rowsResult.Error != nil {
+			return rowsResult.Error
+		}
+	}
+	return scope.DB().Error
+}
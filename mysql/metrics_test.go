@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// metricsUser is the model of the table of the metrics tests.
+type metricsUser struct {
+	ID   int
+	Name string
+}
+
+func TestQueryMetrics(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewPool(ctx, map[string]config.Mysql{"default": testConfig("db1", 1), "read": testConfig("db1", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(ctx)
+
+	tests := []struct {
+		name      string
+		db        string
+		query     func(db *Mysql) error
+		operation string
+	}{
+		{name: "query", db: "read", operation: "SELECT",
+			query: func(db *Mysql) error { return db.Find(&[]metricsUser{}).Error }},
+		{name: "create", db: "default", operation: "INSERT",
+			query: func(db *Mysql) error { return db.Create(&metricsUser{Name: "bob"}).Error }},
+		{name: "delete", db: "default", operation: "DELETE",
+			query: func(db *Mysql) error { return db.Where("id = ?", 1).Delete(&metricsUser{}).Error }},
+		{name: "row query by the sql", db: "read", operation: "SELECT",
+			query: func(db *Mysql) error {
+				_, err := db.Model(&metricsUser{}).Select("name").Rows()
+				return err
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := queryErrors.WithLabelValues(tt.db, "metrics_users", tt.operation)
+			before := testutil.ToFloat64(errs)
+
+			// the statements of the fake driver always fail.
+			if err := tt.query(p.Get(ctx, tt.db)); err == nil {
+				t.Fatal("query by the fake driver: want error")
+			}
+			if got := testutil.ToFloat64(errs) - before; got != 1 {
+				t.Errorf("query errors = %v, want 1", got)
+			}
+			duration := queryDuration.WithLabelValues(tt.db, "metrics_users", tt.operation).(prometheus.Histogram)
+			if got := testutil.CollectAndCount(duration); got != 1 {
+				t.Errorf("query duration series = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/shelton-hu/pi/redact"
+)
+
+// _SqlKeywords are the keywords which may be between the column and its var.
+var _SqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "LIKE": true,
+	"BETWEEN": true, "SET": true, "WHERE": true, "VALUES": true, "LIMIT": true,
+	"OFFSET": true, "HAVING": true,
+}
+
+// redactVars returns the vars of the sql redacted by the policy of the columns which
+// they are bound to.
+func redactVars(policy *redact.Policy, sql string, vars []interface{}) []string {
+	names := sqlVarNames(sql, len(vars))
+	redacted := make([]string, 0, len(vars))
+	for i, v := range vars {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		redacted = append(redacted, policy.Field(names[i], fmt.Sprintf("%v", v)))
+	}
+	return redacted
+}
+
+// interpolate replaces the ? of the sql by the quoted vars, the ? of the string
+// literals are kept.
+func interpolate(sql string, vars []string) string {
+	var b strings.Builder
+	i := 0
+	literal := false
+	for _, r := range sql {
+		if r == '\'' {
+			literal = !literal
+		}
+		if r == '?' && !literal && i < len(vars) {
+			b.WriteString("'" + vars[i] + "'")
+			i++
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlVarNames guesses the column of each ? of the sql, which is the column at the
+// same position of the column list of INSERT, or else the last identifier before
+// the ?, e.g. `name` of `name` = ? and id of id IN (?). The name is empty when it
+// can't be guessed.
+func sqlVarNames(sql string, n int) []string {
+	names := make([]string, 0, n)
+	var columns []string
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sql)), "INSERT") {
+		if start, end := strings.Index(sql, "("), strings.Index(sql, ")"); start >= 0 && end > start {
+			for _, col := range strings.Split(sql[start+1:end], ",") {
+				columns = append(columns, unquote(strings.TrimSpace(col)))
+			}
+			sql = sql[end+1:]
+		}
+	}
+
+	var last, word strings.Builder
+	var quote rune
+	flush := func() {
+		if w := word.String(); w != "" && !_SqlKeywords[strings.ToUpper(w)] {
+			last.Reset()
+			last.WriteString(unquote(w))
+		}
+		word.Reset()
+	}
+	for _, r := range sql {
+		switch {
+		case quote != 0:
+			// the string literal is skipped, and the quoted identifier is a word.
+			if r == quote {
+				if quote != '\'' {
+					flush()
+				}
+				quote = 0
+			} else if quote != '\'' {
+				word.WriteRune(r)
+			}
+		case r == '`' || r == '"' || r == '\'':
+			flush()
+			quote = r
+		case r == '?':
+			flush()
+			name := last.String()
+			if len(columns) > 0 {
+				name = columns[len(names)%len(columns)]
+			}
+			names = append(names, name)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.':
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	for len(names) < n {
+		names = append(names, "")
+	}
+	return names
+}
+
+// unquote returns the column of the identifier, e.g. name of `users`.`name`.
+func unquote(ident string) string {
+	ident = strings.Trim(ident, "`\"")
+	if i := strings.LastIndex(ident, "."); i >= 0 {
+		ident = strings.Trim(ident[i+1:], "`\"")
+	}
+	return ident
+}
@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/redact"
+)
+
+func TestSqlVarNames(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		n    int
+		want []string
+	}{
+		{name: "where", sql: "SELECT * FROM users WHERE name = ? AND password = ?", n: 2, want: []string{"name", "password"}},
+		{name: "quoted identifiers", sql: "SELECT * FROM `users` WHERE `users`.`password` = ? OR \"token\" = ?", n: 2,
+			want: []string{"password", "token"}},
+		{name: "keywords between column and var", sql: "SELECT * FROM users WHERE id IN (?, ?) AND password NOT LIKE ?", n: 3,
+			want: []string{"id", "id", "password"}},
+		{name: "update", sql: "UPDATE users SET password = ?, name = ? WHERE id = ?", n: 3, want: []string{"password", "name", "id"}},
+		{name: "insert", sql: "INSERT INTO `users` (`name`,`password`) VALUES (?,?)", n: 2, want: []string{"name", "password"}},
+		{name: "insert rows", sql: "insert into users (name, password) values (?,?),(?,?)", n: 4,
+			want: []string{"name", "password", "name", "password"}},
+		{name: "? in string literal", sql: "SELECT * FROM users WHERE note = 'a?b' AND token = ?", n: 1, want: []string{"token"}},
+		{name: "? in identifier", sql: "SELECT * FROM users WHERE `a?b` = ?", n: 1, want: []string{"a?b"}},
+		{name: "fewer placeholders than vars", sql: "SELECT * FROM users WHERE name = ?", n: 3, want: []string{"name", "", ""}},
+		{name: "more placeholders than vars", sql: "SELECT * FROM users WHERE name = ? AND id = ?", n: 1, want: []string{"name", "id"}},
+		{name: "no column", sql: "SELECT ?", n: 1, want: []string{"SELECT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlVarNames(tt.sql, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sqlVarNames() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		vars []string
+		want string
+	}{
+		{name: "vars", sql: "SELECT * FROM users WHERE name = ? AND id = ?", vars: []string{"bob", "1"},
+			want: "SELECT * FROM users WHERE name = 'bob' AND id = '1'"},
+		{name: "? in string literal", sql: "SELECT * FROM users WHERE note = 'a?b' AND name = ?", vars: []string{"bob"},
+			want: "SELECT * FROM users WHERE note = 'a?b' AND name = 'bob'"},
+		{name: "escaped quote in string literal", sql: "SELECT * FROM users WHERE note = 'it''s?' AND name = ?", vars: []string{"bob"},
+			want: "SELECT * FROM users WHERE note = 'it''s?' AND name = 'bob'"},
+		{name: "fewer vars than placeholders", sql: "SELECT * FROM users WHERE name = ? AND id = ?", vars: []string{"bob"},
+			want: "SELECT * FROM users WHERE name = 'bob' AND id = ?"},
+		{name: "more vars than placeholders", sql: "SELECT * FROM users WHERE name = ?", vars: []string{"bob", "1"},
+			want: "SELECT * FROM users WHERE name = 'bob'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interpolate(tt.sql, tt.vars); got != tt.want {
+				t.Errorf("interpolate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactVars(t *testing.T) {
+	policy := redact.NewPolicy(config.Redaction{HashFields: []string{"email"}})
+	hashed := policy.Field("email", "a@b.com")
+
+	tests := []struct {
+		name string
+		sql  string
+		vars []interface{}
+		want []string
+	}{
+		{name: "denied and hashed columns", sql: "INSERT INTO users (name, password, email) VALUES (?, ?, ?)",
+			vars: []interface{}{"bob", []byte("p"), "a@b.com"}, want: []string{"bob", redact.Mask, hashed}},
+		{name: "bytes and numbers", sql: "SELECT * FROM users WHERE name = ? AND id = ?",
+			vars: []interface{}{[]byte("bob"), 1}, want: []string{"bob", "1"}},
+		{name: "more vars than placeholders", sql: "SELECT * FROM users WHERE token = ?",
+			vars: []interface{}{"t", "x"}, want: []string{redact.Mask, "x"}},
+		{name: "more placeholders than vars", sql: "SELECT * FROM users WHERE name = ? AND password = ?",
+			vars: []interface{}{"bob"}, want: []string{"bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactVars(policy, tt.sql, tt.vars); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactVars() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
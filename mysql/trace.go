@@ -6,33 +6,37 @@ import (
 	"strings"
 
 	"github.com/jinzhu/gorm"
-	opentracing "github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
 )
 
 const (
-	_ParentSpanGormKey = "opentracingParentSpan"
-	_SpanGormKey       = "opentracingSpan"
+	_ContextGormKey = "tracingContext"
+	_SpanGormKey    = "tracingSpan"
+
+	// _MysqlEndpointPrefix is the prefix of the table as the endpoint of the redaction.
+	_MysqlEndpointPrefix = "mysql:"
 )
 
 // callbacks ...
-type callbacks struct{}
+type callbacks struct {
+	// redaction is the redaction policy of the queries, or nil for the default.
+	redaction *redact.Policy
+}
 
-// SetSpanToGorm sets span to gorm settings, returns cloned DB.
-func (m *Mysql) setSpanToGorm(ctx context.Context) {
-	if ctx == nil {
-		return
+// withContext returns the cloned instance which carries ctx in the gorm settings,
+// so the queries are traced as the children of the span in ctx.
+func (m *Mysql) withContext(ctx context.Context) *Mysql {
+	if ctx == nil || tracing.SpanFromContext(ctx) == nil {
+		return m
 	}
-	parentSpan := opentracing.SpanFromContext(ctx)
-	if parentSpan == nil {
-		return
-	}
-	m.Set(_ParentSpanGormKey, parentSpan)
+	return &Mysql{m.DB.Set(_ContextGormKey, ctx)}
 }
 
-// addGormCallbacks adds callbacks for tracing, you should call SetSpanToGorm to make them work.
-func addGormCallbacks(db *gorm.DB) {
-	callbacks := newCallbacks()
+// addGormCallbacks adds callbacks for tracing, you should call withContext to make them work.
+func addGormCallbacks(db *gorm.DB, policy *redact.Policy) {
+	callbacks := newCallbacks(policy)
 	registerCallbacks(db, "create", callbacks)
 	registerCallbacks(db, "query", callbacks)
 	registerCallbacks(db, "update", callbacks)
@@ -40,8 +44,8 @@ func addGormCallbacks(db *gorm.DB) {
 	registerCallbacks(db, "row_query", callbacks)
 }
 
-func newCallbacks() *callbacks {
-	return &callbacks{}
+func newCallbacks(policy *redact.Policy) *callbacks {
+	return &callbacks{redaction: policy}
 }
 
 func (c *callbacks) beforeCreate(scope *gorm.Scope)   { c.before(scope) }
@@ -56,14 +60,12 @@ func (c *callbacks) beforeRowQuery(scope *gorm.Scope) { c.before(scope) }
 func (c *callbacks) afterRowQuery(scope *gorm.Scope)  { c.after(scope, "") }
 
 func (c *callbacks) before(scope *gorm.Scope) {
-	val, ok := scope.Get(_ParentSpanGormKey)
+	val, ok := scope.Get(_ContextGormKey)
 	if !ok {
 		return
 	}
-	parentSpan := val.(opentracing.Span)
-	tr := parentSpan.Tracer()
-	sp := tr.StartSpan("MySQL", opentracing.ChildOf(parentSpan.Context()))
-	ext.DBType.Set(sp, "sql")
+	_, sp := tracing.StartSpan(val.(context.Context), "MySQL", tracing.SetSpanKind(tracing.KindClient))
+	sp.SetTag("db.type", "sql")
 	scope.Set(_SpanGormKey, sp)
 }
 
@@ -72,27 +74,37 @@ func (c *callbacks) after(scope *gorm.Scope, operation string) {
 	if !ok {
 		return
 	}
-	sp := val.(opentracing.Span)
+	sp := val.(tracing.Span)
 	if operation == "" {
 		operation = strings.ToUpper(strings.Split(scope.SQL, " ")[0])
 	}
-	if operation != "SELECT" && scope.HasError() {
-		ext.Error.Set(sp, scope.HasError())
+	if err := scope.DB().Error; operation != "SELECT" && err != nil {
+		sp.SetError(err)
 	}
-	sql := scope.SQL
-	if strings.Contains(scope.SQL, "?") {
-		// replace ? to var
-		sqlLayout := strings.Replace(scope.SQL, "?", "'%v'", -1)
-		sql = fmt.Sprintf(sqlLayout, scope.SQLVars...)
+	table := scope.TableName()
+	policy := c.policy()
+	if endpoint := _MysqlEndpointPrefix + table; policy.IsOptedOut(endpoint) {
+		sp.SetTag("db.statement", scope.SQL)
+		sp.SetTag("db.vars", redact.OptedOut)
+	} else {
+		vars := redactVars(policy, scope.SQL, scope.SQLVars)
+		sp.SetTag("db.statement", interpolate(scope.SQL, vars))
+		sp.SetTag("db.vars", fmt.Sprint(vars))
 	}
-	ext.DBStatement.Set(sp, sql)
-	sp.SetTag("db.vars", scope.SQLVars)
-	sp.SetTag("db.table", scope.TableName())
+	sp.SetTag("db.table", table)
 	sp.SetTag("db.method", operation)
 	sp.SetTag("db.count", scope.DB().RowsAffected)
 	sp.Finish()
 }
 
+// policy returns the redaction policy of the queries.
+func (c *callbacks) policy() *redact.Policy {
+	if c.redaction == nil {
+		return redact.Default()
+	}
+	return c.redaction
+}
+
 func registerCallbacks(db *gorm.DB, name string, c *callbacks) {
 	beforeName := fmt.Sprintf("tracing:%v_before", name)
 	afterName := fmt.Sprintf("tracing:%v_after", name)
@@ -2,40 +2,110 @@ package pi
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/gin-gonic/gin"
 	goMicro "github.com/micro/go-micro/v2"
 	"github.com/micro/go-micro/v2/web"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/shelton-hu/logger"
+
+	"github.com/shelton-hu/pi/admin"
+	"github.com/shelton-hu/pi/auth"
 	"github.com/shelton-hu/pi/config"
 	"github.com/shelton-hu/pi/cron"
 	"github.com/shelton-hu/pi/daemon"
+	"github.com/shelton-hu/pi/health"
 	"github.com/shelton-hu/pi/jaeger"
 	"github.com/shelton-hu/pi/kafka"
+	"github.com/shelton-hu/pi/logging"
 	"github.com/shelton-hu/pi/micro"
 	"github.com/shelton-hu/pi/mysql"
+	"github.com/shelton-hu/pi/redact"
 	"github.com/shelton-hu/pi/redis"
+	"github.com/shelton-hu/pi/tracing"
 	"github.com/shelton-hu/pi/websocket"
 )
 
+const (
+	// _LivenessPath and _ReadinessPath are the paths of the health of the web service.
+	_LivenessPath  = "/healthz"
+	_ReadinessPath = "/readyz"
+
+	// _MetricsPath is the path of the prometheus metrics of the web service.
+	_MetricsPath = "/metrics"
+)
+
 var global *Pi
-var once sync.Once
 var mu sync.Mutex
 
+// Pi owns the config, connections and services of an app, multiple of which can be
+// used in a process.
 type Pi struct {
 	namespace string
 	appName   string
 
+	// ctx is the context of the pi, Run shuts the pi down when it's done.
+	ctx context.Context
+
+	conf   *config.Config
+	tracer tracing.Tracer
+	jaeger *jaeger.Jaeger
+	mysql  *mysql.Pool
+	redis  *redis.Pool
+	kafka  *kafka.Kafka
+
+	// identity is the identity of the log records of the pi.
+	identity logging.Identity
+
+	// redaction and authenticator are the redaction policy and the authenticator
+	// of the pi, which are updated when the config changes.
+	redaction     *redact.Policy
+	authenticator *auth.Authenticator
+
+	// components are the components initialized by the pi.
+	components map[Component]bool
+
+	// health aggregates the checkers of the components.
+	health *health.Health
+
 	microRpcService goMicro.Service
 	microWebService web.Service
+	gin             *gin.Engine
 	cron            *cron.Cron
 	daemon          *daemon.Daemon
 	wsupgrader      *websocket.Upgrader
+
+	// subscribers are the kafka subscriptions started by Run.
+	subscribers []*subscriber
+
+	// drainTimeout is the duration which the components are given to stop when
+	// shutting down.
+	drainTimeout time.Duration
+
+	// closes closes the config and connections opened by the pi.
+	closes *closeFunc
 }
 
 type options func(*Option)
 
 type Option struct {
+	etcdAddresses []string
+	namespace     string
+	appName       string
+	components    []Component
+	drainTimeout  time.Duration
+	admin         bool
+	gin           bool
+	tracer        tracing.Tracer
+	authOpts      []auth.AuthenticatorOptions
+
+	configOpts   []config.InitOptions
 	microRpcOpts []goMicro.Option
 	microWebOpts []web.Option
 }
@@ -46,6 +116,63 @@ func (o *Option) applyOpts(opts ...options) {
 	}
 }
 
+func SetEtcdAddresses(addrs ...string) options {
+	return func(o *Option) {
+		o.etcdAddresses = addrs
+	}
+}
+
+func SetNamespace(namespace string) options {
+	return func(o *Option) {
+		o.namespace = namespace
+	}
+}
+
+func SetAppName(appName string) options {
+	return func(o *Option) {
+		o.appName = appName
+	}
+}
+
+// SetAdmin mounts the admin handler on the web service at /debug/ when enabled,
+// which exposes the runtime state and pprof, see admin.NewHandler.
+func SetAdmin(enabled bool) options {
+	return func(o *Option) {
+		o.admin = enabled
+	}
+}
+
+// SetGin mounts the gin engine with the standard middlewares at / of the web service
+// when enabled, see micro.NewGinEngine, and its cors policy is the one of the web
+// config. The routes of the engine are added by Gin.
+func SetGin(enabled bool) options {
+	return func(o *Option) {
+		o.gin = enabled
+	}
+}
+
+// SetTracer sets the tracer of the pi instead of the one of the tracing config,
+// e.g. the memory tracer of tests. The tracer is closed with the pi.
+func SetTracer(tracer tracing.Tracer) options {
+	return func(o *Option) {
+		o.tracer = tracer
+	}
+}
+
+// SetAuthOptions sets the options of the authenticator of the auth config, e.g.
+// the verifier of the bearer tokens issued by another identity provider.
+func SetAuthOptions(opts ...auth.AuthenticatorOptions) options {
+	return func(o *Option) {
+		o.authOpts = append(o.authOpts, opts...)
+	}
+}
+
+func SetConfigOptions(opts ...config.InitOptions) options {
+	return func(o *Option) {
+		o.configOpts = append(o.configOpts, opts...)
+	}
+}
+
 func SetMicroRpcOptions(opts ...goMicro.Option) options {
 	return func(o *Option) {
 		o.microRpcOpts = append(o.microRpcOpts, opts...)
@@ -58,53 +185,373 @@ func SetMicroWebOptions(opts ...web.Option) options {
 	}
 }
 
+// Closer closes what the pi opened.
+type Closer interface {
+	Close()
+}
+
+// closeFunc closes the opened components in the reverse order of opening them.
 type closeFunc struct {
 	fns []func()
 }
 
 func (c *closeFunc) Close() {
-	for _, fn := range c.fns {
-		fn()
+	for i := len(c.fns) - 1; i >= 0; i-- {
+		c.fns[i]()
 	}
+	c.fns = nil
 }
 
-func SetGlobal(ctx context.Context, etcdAddresses []string, namespace, appname string, opts ...options) (closes *closeFunc) {
-	o := new(Option)
+// New returns the pi of the app, which loads its own config and opens its own
+// connections. When any component fails, the ones already opened are closed and
+// the error is returned. The tracer, redaction policy and authenticator of the pi
+// are used by its services, pools, kafka and cron, and the process wide globals of
+// the packages are only set by SetGlobal, so multiple pis don't overwrite each
+// other's.
+func New(ctx context.Context, opts ...options) (*Pi, error) {
+	o := &Option{
+		components:   AllComponents,
+		drainTimeout: _DrainTimeout,
+	}
 	o.applyOpts(opts...)
+	// --localConfig of the micro services takes precedence over etcd, --etcdAddrs
+	// over SetEtcdAddresses, and --env is the namespace without SetNamespace.
+	o.configOpts = append(o.configOpts, config.SetLocalConfig(micro.LookupFlag(micro.FlagLocalConfig)))
+	if addrs := micro.LookupFlag(micro.FlagEtcdAddrs); addrs != "" {
+		o.etcdAddresses = strings.Split(addrs, ",")
+	}
+	if o.namespace == "" {
+		o.namespace = micro.LookupFlag(micro.FlagEnv)
+	}
+
+	p := &Pi{
+		namespace: o.namespace,
+		appName:   o.appName,
+		ctx:       ctx,
+
+		components: make(map[Component]bool, len(o.components)),
+		health:     health.New(),
+		wsupgrader: websocket.NewUpgrader(),
+		closes:     new(closeFunc),
+
+		drainTimeout: o.drainTimeout,
+	}
+	for _, c := range o.components {
+		p.components[c] = true
+	}
+	// validate the config sections of the components only.
+	o.configOpts = append(o.configOpts, config.SetSections(sections(p.components)...))
+
+	var err error
+	if p.conf, err = config.New(ctx, o.etcdAddresses, p.namespace, p.appName, o.configOpts...); err != nil {
+		return nil, err
+	}
+	p.closes.fns = append(p.closes.fns, p.conf.Close)
+	p.health.Register("config", p.conf.Check)
+
+	p.identity = logging.Identity{
+		Service:   p.SysConf().Registry.Name,
+		Namespace: p.namespace,
+		App:       p.appName,
+	}
+
+	p.redaction = redact.NewPolicy(p.SysConf().Redaction)
+	p.conf.OnChange(config.SectionRedaction, func(old, new interface{}) {
+		p.redaction.Update(new.(config.Redaction))
+	})
+
+	if p.authenticator, err = auth.New(p.SysConf().Auth, o.authOpts...); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("auth: %s", err)
+	}
+	p.conf.OnChange(config.SectionAuth, func(old, new interface{}) {
+		if err := p.authenticator.Update(new.(config.Auth)); err != nil {
+			logger.Error(ctx, "update auth: %s", err.Error())
+		}
+	})
+
+	if p.Enabled(Tracing) {
+		switch {
+		case o.tracer != nil:
+			p.tracer = o.tracer
+		case p.SysConf().Tracing.Backend == config.TracingBackendOtel:
+			if p.tracer, err = tracing.NewOtlpTracer(ctx, p.SysConf().Tracing); err != nil {
+				p.Close()
+				return nil, fmt.Errorf("otlp tracer: %s", err)
+			}
+		default:
+			if p.jaeger, err = jaeger.New(ctx, p.SysConf().Jaeger); err != nil {
+				p.Close()
+				return nil, fmt.Errorf("connect jaeger: %s", err)
+			}
+			p.tracer = tracing.NewOpenTracer(p.jaeger.Tracer(), nil)
+			p.closes.fns = append(p.closes.fns, func() { p.jaeger.Close(ctx) })
+		}
+		p.closes.fns = append(p.closes.fns, func() {
+			if err := p.tracer.Close(ctx); err != nil {
+				logger.Error(ctx, "close tracer error: %s", err.Error())
+			}
+		})
+	}
+	inst := p.instrumentation()
+
+	if p.Enabled(MySQL) {
+		if p.mysql, err = mysql.NewPool(ctx, p.SysConf().Mysql, mysql.SetPoolTracer(inst.Tracer), mysql.SetPoolRedaction(p.redaction)); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("connect mysql: %s", err)
+		}
+		p.closes.fns = append(p.closes.fns, func() { p.mysql.Close(ctx) })
+		p.health.Register(string(MySQL), p.mysql.Check)
+	}
+
+	if p.Enabled(Redis) {
+		if p.redis, err = redis.NewPool(ctx, p.SysConf().Redis, redis.SetPoolTracer(inst.Tracer), redis.SetPoolRedaction(p.redaction)); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("connect redis: %s", err)
+		}
+		p.closes.fns = append(p.closes.fns, func() { p.redis.Close(ctx) })
+		p.health.Register(string(Redis), p.redis.Check)
+	}
+
+	if p.Enabled(Kafka) {
+		if p.kafka, err = kafka.NewKafka(ctx, p.SysConf().Kafka, kafka.SetKafkaTracer(inst.Tracer), kafka.SetKafkaRedaction(p.redaction), kafka.SetKafkaAuthenticator(p.authenticator)); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("connect kafka: %s", err)
+		}
+		p.closes.fns = append(p.closes.fns, func() { p.kafka.Close(ctx) })
+		p.health.Register(string(Kafka), p.kafka.Check)
+	}
+
+	p.watchConnections(ctx)
 
+	if p.Enabled(RpcService) {
+		clientPolicy := micro.NewClientPolicy(p.SysConf().Client)
+		p.conf.OnChange(config.SectionClient, func(old, new interface{}) {
+			clientPolicy.Update(new.(config.Client))
+		})
+		var limiterOpts []micro.RateLimiterOptions
+		if p.Enabled(Redis) {
+			limiterOpts = append(limiterOpts, micro.SetRateLimiterRedis(p.redis))
+		}
+		rateLimiter := micro.NewRateLimiter(p.SysConf().RateLimit, limiterOpts...)
+		p.conf.OnChange(config.SectionRateLimit, func(old, new interface{}) {
+			rateLimiter.Update(new.(config.RateLimit))
+		})
+		rpcOpts := append([]goMicro.Option{
+			goMicro.WrapClient(clientPolicy.Wrapper()),
+			goMicro.WrapHandler(rateLimiter.Wrapper()),
+		}, o.microRpcOpts...)
+		p.microRpcService = micro.NewRpcService(ctx, p.SysConf().Registry, inst, rpcOpts...)
+		server := p.microRpcService.Server()
+		if err := server.Handle(server.NewHandler(micro.NewHealthHandler(p.health))); err != nil {
+			p.Close()
+			return nil, fmt.Errorf("handle health: %s", err)
+		}
+		p.health.Register(string(RpcService), micro.RpcRegistryChecker(p.microRpcService))
+	}
+	if p.Enabled(WebService) {
+		p.microWebService = micro.NewWebService(ctx, p.SysConf().Registry, o.microWebOpts...)
+		p.microWebService.Handle(_LivenessPath, p.health.LivenessHandler())
+		p.microWebService.Handle(_ReadinessPath, p.health.ReadinessHandler())
+		p.microWebService.Handle(_MetricsPath, promhttp.Handler())
+		p.health.Register(string(WebService), micro.WebRegistryChecker(p.microWebService))
+		if o.gin {
+			cors := micro.NewCors(p.SysConf().Web.Cors)
+			p.conf.OnChange(config.SectionWeb, func(old, new interface{}) {
+				cors.Update(new.(config.Web).Cors)
+			})
+			p.gin = micro.NewGinEngine(inst, cors)
+			p.microWebService.Handle("/", p.gin)
+		}
+	}
+
+	p.cron = cron.NewCron(ctx, p.SysConf(), cron.SetCronTracer(inst.Tracer))
+	p.conf.OnChange(config.SectionCron, func(old, new interface{}) {
+		p.cron.SetConfig(new.(config.Cron))
+	})
+	p.daemon = daemon.NewDaemon(ctx)
+
+	if o.admin && p.Enabled(WebService) {
+		p.microWebService.Handle(admin.Prefix, p.AdminHandler())
+	}
+
+	// the pi is ready once initialized, whether it's run by Run or by the app, and
+	// the services are reported down by their checkers until they're registered.
+	p.health.SetReady(true)
+
+	return p, nil
+}
+
+// SetGlobal initializes the global pi returned by G, whose config and connections
+// are also used by the package level functions of the packages. Its tracer is set
+// as the global tracer of the tracing package and opentracing, which is used by the
+// instrumentation of all the packages. So are its redaction policy and authenticator,
+// and the identity of the log records, see logging.Setup. The global pi is initialized
+// once, and SetGlobal can be called again after it failed.
+func SetGlobal(ctx context.Context, etcdAddresses []string, namespace, appname string, opts ...options) (Closer, error) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	once.Do(func() {
-		global = &Pi{
-			namespace: namespace,
-			appName:   appname,
+	if global == nil {
+		opts = append([]options{SetEtcdAddresses(etcdAddresses...), SetNamespace(namespace), SetAppName(appname)}, opts...)
+		p, err := New(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
 
-			wsupgrader: websocket.NewUpgrader(),
+		config.SetDefault(p.conf)
+		p.setGlobal()
+		if p.Enabled(MySQL) {
+			mysql.SetDefault(p.mysql)
+		}
+		if p.Enabled(Redis) {
+			redis.SetDefault(p.redis)
+		}
+		if p.Enabled(Kafka) {
+			kafka.SetDefault(p.kafka)
 		}
+		global = p
+	}
 
-		config.InitConfig(ctx, etcdAddresses, global.namespace, global.appName)
+	return global.closes, nil
+}
 
-		jaeger.ConnectJaeger(ctx, global.SysConf().Jaeger)
-		closes.fns = append(closes.fns, func() { jaeger.CloseJaeger(ctx) })
+// setGlobal installs the tracer, redaction policy, authenticator and log identity
+// of the pi as the globals of the packages, the policy and the authenticator are
+// updated in place, so the globals are kept updated with the pi.
+func (p *Pi) setGlobal() {
+	logging.Setup(p.identity)
+	redact.SetDefault(p.redaction)
+	auth.SetDefault(p.authenticator)
+	if p.jaeger != nil {
+		jaeger.SetDefault(p.jaeger)
+	}
+	if p.tracer != nil {
+		tracing.SetGlobal(p.tracer)
+	}
+}
 
-		mysql.ConnectMysql(ctx, global.SysConf().Mysql)
-		closes.fns = append(closes.fns, func() { mysql.CloseMysql(ctx) })
+// instrumentation returns the tracer, redaction policy and authenticator of the
+// pi, whose tracer is a noop one when tracing is disabled, so the spans of the pi
+// never go to the global tracer of another pi.
+func (p *Pi) instrumentation() *micro.Instrumentation {
+	tracer := p.tracer
+	if tracer == nil {
+		tracer = tracing.NewNoopTracer()
+	}
+	return &micro.Instrumentation{
+		Tracer:        tracer,
+		Redaction:     p.redaction,
+		Authenticator: p.authenticator,
+	}
+}
 
-		redis.ConnectRedis(ctx, global.SysConf().Redis)
-		closes.fns = append(closes.fns, func() { redis.CloseRedis(ctx) })
+// watchConnections reconnects mysql, redis and kafka when their config changed,
+// and updates the sampler of jaeger. The reconnections run off the config watcher,
+// so an unreachable server never delays the other changes.
+func (p *Pi) watchConnections(ctx context.Context) {
+	if p.jaeger != nil {
+		p.conf.OnChange(config.SectionJaeger, func(old, new interface{}) {
+			if err := p.jaeger.Update(ctx, new.(config.Jaeger)); err != nil {
+				logger.Error(ctx, "update jaeger error: %s", err.Error())
+			}
+		})
+	}
+	if p.Enabled(MySQL) {
+		p.onReconnect(config.SectionMysql, func(cfg interface{}) {
+			if err := p.mysql.Reconnect(ctx, cfg.(map[string]config.Mysql)); err != nil {
+				logger.Error(ctx, "reconnect mysql error: %s", err.Error())
+			}
+		})
+	}
+	if p.Enabled(Redis) {
+		p.onReconnect(config.SectionRedis, func(cfg interface{}) {
+			if err := p.redis.Reconnect(ctx, cfg.(config.Redis)); err != nil {
+				logger.Error(ctx, "reconnect redis error: %s", err.Error())
+			}
+		})
+	}
+	if p.Enabled(Kafka) {
+		p.onReconnect(config.SectionKafka, func(cfg interface{}) {
+			if err := p.kafka.Reconnect(ctx, cfg.(config.Kafka)); err != nil {
+				logger.Error(ctx, "reconnect kafka error: %s", err.Error())
+			}
+		})
+	}
+}
 
-		kafka.ConnectKafka(ctx, global.SysConf().Kafka)
-		closes.fns = append(closes.fns, func() { kafka.CloseKafka(ctx) })
+// onReconnect runs fn by a reconnector with the new config when the config section
+// changed, the reconnector is stopped before the connections are closed.
+func (p *Pi) onReconnect(section string, fn func(cfg interface{})) {
+	r := &reconnector{fn: fn}
+	p.conf.OnChange(section, func(old, new interface{}) {
+		r.reconnect(new)
+	})
+	p.closes.fns = append(p.closes.fns, r.stop)
+}
 
-		global.microRpcService = micro.NewRpcService(ctx, global.SysConf().Registry, o.microRpcOpts...)
-		global.microWebService = micro.NewWebService(ctx, global.SysConf().Registry, o.microWebOpts...)
+// reconnector runs the reconnections in its own goroutine one at a time. The
+// changes arriving during a reconnection are coalesced into the latest one.
+type reconnector struct {
+	fn func(cfg interface{})
 
-		global.cron = cron.NewCron(ctx, global.SysConf())
-		global.daemon = daemon.NewDaemon(ctx)
-	})
+	// mu protects the fields below.
+	mu      sync.Mutex
+	cfg     interface{}
+	pending bool
+	running bool
+	stopped bool
+
+	// wg waits for the running reconnection.
+	wg sync.WaitGroup
+}
+
+// reconnect reconnects with the config, after the running reconnection if any.
+func (r *reconnector) reconnect(cfg interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return
+	}
+	r.cfg, r.pending = cfg, true
+	if !r.running {
+		r.running = true
+		r.wg.Add(1)
+		go r.run()
+	}
+}
+
+// run reconnects with the pending configs until none is left.
+func (r *reconnector) run() {
+	defer r.wg.Done()
+	for {
+		r.mu.Lock()
+		if !r.pending || r.stopped {
+			r.running = false
+			r.mu.Unlock()
+			return
+		}
+		cfg := r.cfg
+		r.cfg, r.pending = nil, false
+		r.mu.Unlock()
+
+		r.fn(cfg)
+	}
+}
+
+// stop drops the pending reconnection and waits for the running one.
+func (r *reconnector) stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
 
-	return closes
+	r.wg.Wait()
+}
+
+// Close closes the config and connections of the pi.
+func (p *Pi) Close() {
+	p.closes.Close()
 }
 
 func G() *Pi {
@@ -122,34 +569,95 @@ func (p *Pi) AppName() string {
 	return p.appName
 }
 
+func (p *Pi) Config() *config.Config {
+	return p.conf
+}
+
 func (p *Pi) SysConf() *config.SystemConfig {
-	return config.SysConf()
+	return p.conf.SysConf()
 }
 
 func (p *Pi) CusConf() *config.CustomConfig {
-	return config.CusConf()
+	return p.conf.CusConf()
+}
+
+// Tracer returns the tracer of the pi.
+func (p *Pi) Tracer() tracing.Tracer {
+	p.mustEnabled(Tracing)
+	return p.tracer
+}
+
+// Redaction returns the redaction policy of the pi.
+func (p *Pi) Redaction() *redact.Policy {
+	return p.redaction
+}
+
+// Authenticator returns the authenticator of the pi.
+func (p *Pi) Authenticator() *auth.Authenticator {
+	return p.authenticator
+}
+
+// LogIdentity returns the identity of the log records of the pi.
+func (p *Pi) LogIdentity() logging.Identity {
+	return p.identity
 }
 
 func (p *Pi) Mysql(ctx context.Context, name ...string) *mysql.Mysql {
-	return mysql.GetConnect(ctx, name...)
+	p.mustEnabled(MySQL)
+	return p.mysql.Get(ctx, name...)
 }
 
 func (p *Pi) Redis(ctx context.Context) *redis.Redis {
-	return redis.GetConnect(ctx)
+	p.mustEnabled(Redis)
+	return p.redis.Get(ctx)
 }
 
 func (p *Pi) Kafka(ctx context.Context) *kafka.Kafka {
-	return kafka.GetConnect(ctx)
+	p.mustEnabled(Kafka)
+	return p.kafka
 }
 
 func (p *Pi) MicroRpcService(ctx context.Context) goMicro.Service {
+	p.mustEnabled(RpcService)
 	return p.microRpcService
 }
 
 func (p *Pi) MicroWebService(ctx context.Context) web.Service {
+	p.mustEnabled(WebService)
 	return p.microWebService
 }
 
+func (p *Pi) Health() *health.Health {
+	return p.health
+}
+
+// AdminHandler returns the admin handler of the pi, which must be mounted at
+// admin.Prefix.
+func (p *Pi) AdminHandler() http.Handler {
+	opts := []admin.HandlerOptions{
+		admin.SetConfig(p.conf),
+		admin.SetCron(p.cron),
+		admin.SetDaemon(p.daemon),
+	}
+	if p.Enabled(Redis) {
+		opts = append(opts, admin.SetRedis(p.redis))
+	}
+	if p.Enabled(Kafka) {
+		opts = append(opts, admin.SetKafka(p.kafka))
+	}
+	return admin.NewHandler(opts...)
+}
+
+// Gin returns the gin engine mounted on the web service, which panics when it's
+// not enabled by SetGin.
+func (p *Pi) Gin() *gin.Engine {
+	p.mustEnabled(WebService)
+	if p.gin == nil {
+		panic("github.com/shelton-hu/pi: gin is not enabled by SetGin")
+	}
+	return p.gin
+}
+
 func (p *Pi) Cron() *cron.Cron {
 	return p.cron
 }
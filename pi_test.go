@@ -0,0 +1,142 @@
+package pi
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shelton-hu/pi/auth"
+	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
+)
+
+// closeTracer records whether the tracer was closed.
+type closeTracer struct {
+	tracing.Tracer
+	closed bool
+}
+
+// Close ...
+func (t *closeTracer) Close(ctx context.Context) error {
+	t.closed = true
+	return t.Tracer.Close(ctx)
+}
+
+// testOptions returns the options of the pi loading the local system config with
+// the sections, and tracing by the memory tracer.
+func testOptions(t *testing.T, name, sections string, opts ...options) []options {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"sysconf": {"registry": {"name": "` + name + `"}, "tracing": {"backend": "otel", "name": "` + name + `", "otlp": {"endpoint": "http://127.0.0.1:4318"}}` + sections + `}, "cusconf": {}}`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tracer, _ := tracing.NewMemoryTracer(name)
+	return append([]options{
+		SetAppName(name),
+		SetComponents(Tracing),
+		SetTracer(tracer),
+		SetConfigOptions(config.SetLocalConfig(path), config.SetEnvPrefix("")),
+	}, opts...)
+}
+
+// newTestPi returns the pi of testOptions.
+func newTestPi(ctx context.Context, t *testing.T, name, sections string, opts ...options) *Pi {
+	p, err := New(ctx, testOptions(t, name, sections, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestNewKeepsGlobals(t *testing.T) {
+	tracer, policy, authenticator := tracing.Global(), redact.Default(), auth.Default()
+
+	a := newTestPi(context.Background(), t, "a", `, "redaction": {"deny_fields": ["a"]}`)
+	b := newTestPi(context.Background(), t, "b", `, "redaction": {"deny_fields": ["b"]}`)
+
+	if tracing.Global() != tracer || redact.Default() != policy || auth.Default() != authenticator {
+		t.Error("New replaces the globals")
+	}
+	if a.Tracer() == b.Tracer() || a.Redaction() == b.Redaction() || a.Authenticator() == b.Authenticator() {
+		t.Error("pis share the tracer, redaction policy or authenticator")
+	}
+	if got := a.Redaction().Field("a", "x"); got == "x" {
+		t.Errorf("redaction of a doesn't mask field a")
+	}
+	if got := a.Redaction().Field("b", "x"); got != "x" {
+		t.Errorf("redaction of a masks field b of b, got %s", got)
+	}
+	if a.LogIdentity().Service != "a" || b.LogIdentity().Service != "b" {
+		t.Errorf("log identities = %+v, %+v", a.LogIdentity(), b.LogIdentity())
+	}
+}
+
+func TestNewIsReady(t *testing.T) {
+	p := newTestPi(context.Background(), t, "a", "")
+	if !p.Health().Ready() {
+		t.Error("pi is not ready after New")
+	}
+}
+
+func TestNewClosesOpenedComponentsWhenFailed(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens on the redis port.
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	memory, _ := tracing.NewMemoryTracer("a")
+	tracer := &closeTracer{Tracer: memory}
+	opts := testOptions(t, "a", `, "redis": {"host": "127.0.0.1", "port": `+strconv.Itoa(port)+`}`,
+		SetComponents(Tracing, Redis), SetTracer(tracer))
+
+	p, err := New(context.Background(), opts...)
+	if err == nil {
+		p.Close()
+		t.Fatal("New() error = nil, want the redis error")
+	}
+	if !strings.Contains(err.Error(), "connect redis") {
+		t.Errorf("New() error = %v, want the redis error", err)
+	}
+	if !tracer.closed {
+		t.Error("the opened tracer isn't closed")
+	}
+}
+
+func TestReconnectorRunsOffTheWatcher(t *testing.T) {
+	started, release := make(chan interface{}, 3), make(chan struct{})
+	var got []interface{}
+	r := &reconnector{fn: func(cfg interface{}) {
+		started <- cfg
+		<-release
+		got = append(got, cfg)
+	}}
+
+	// the changes return while the first reconnection is blocked, and the ones
+	// arriving meanwhile are coalesced into the latest.
+	r.reconnect(1)
+	<-started
+	r.reconnect(2)
+	r.reconnect(3)
+	close(release)
+	<-started
+	r.stop()
+	if want := []interface{}{1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reconnected with %v, want %v", got, want)
+	}
+
+	r.reconnect(4)
+	r.stop()
+	if len(got) != 2 {
+		t.Errorf("reconnected with %v after stopped, want none", got[2:])
+	}
+}
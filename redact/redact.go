@@ -0,0 +1,329 @@
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+const (
+	// Mask replaces the values of the denied fields.
+	Mask = "******"
+
+	// OptedOut replaces the payloads of the opted out endpoints.
+	OptedOut = "*"
+
+	// _HashPrefix is the prefix of the hashed values.
+	_HashPrefix = "sha256:"
+
+	// _DefaultMaxPayloadBytes is the default max bytes of a payload.
+	_DefaultMaxPayloadBytes = 4096
+)
+
+var (
+	// _DefaultDenyFields are the fields masked by default.
+	_DefaultDenyFields = []string{"password", "secret", "token", "authorization"}
+
+	// _DefaultOptOut are the endpoints opted out by default.
+	_DefaultOptOut = []string{"*collection*"}
+
+	// fieldReplacer removes the underscores and hyphens of the field names.
+	fieldReplacer = strings.NewReplacer("_", "", "-", "")
+)
+
+// Policy redacts the payloads recorded in the spans and logs, which can be updated
+// when the config changed.
+type Policy struct {
+	// rules holds the *rules of the config.
+	rules atomic.Value
+}
+
+// rules are the redaction rules of the config.
+type rules struct {
+	denyFields      map[string]bool
+	hashFields      map[string]bool
+	hashKey         []byte
+	maxPayloadBytes int
+	optOut          []string
+}
+
+// NewPolicy returns the policy of the config, the defaults are used for the fields
+// which the config doesn't set.
+func NewPolicy(redactionConfig config.Redaction) *Policy {
+	p := new(Policy)
+	p.Update(redactionConfig)
+	return p
+}
+
+// Update replaces the config of the policy.
+func (p *Policy) Update(redactionConfig config.Redaction) {
+	r := &rules{
+		denyFields:      fieldSet(redactionConfig.DenyFields, _DefaultDenyFields),
+		hashFields:      fieldSet(redactionConfig.HashFields, nil),
+		hashKey:         []byte(redactionConfig.HashKey),
+		maxPayloadBytes: redactionConfig.MaxPayloadBytes,
+	}
+	if r.maxPayloadBytes == 0 {
+		r.maxPayloadBytes = _DefaultMaxPayloadBytes
+	}
+	optOut := redactionConfig.OptOut
+	if optOut == nil {
+		optOut = _DefaultOptOut
+	}
+	for _, pattern := range optOut {
+		r.optOut = append(r.optOut, strings.ToLower(pattern))
+	}
+	p.rules.Store(r)
+}
+
+// holder holds the default policy in the atomic value.
+type holder struct {
+	policy *Policy
+}
+
+// std holds the default policy used by the package level functions.
+var std atomic.Value
+
+func init() {
+	std.Store(&holder{policy: NewPolicy(config.Redaction{})})
+}
+
+// SetDefault replaces the default policy used by the instrumentation of all the
+// packages.
+func SetDefault(p *Policy) {
+	std.Store(&holder{policy: p})
+}
+
+// Default returns the default policy.
+func Default() *Policy {
+	return std.Load().(*holder).policy
+}
+
+// IsOptedOut returns true when the payloads of the endpoint are not recorded by
+// the default policy.
+func IsOptedOut(endpoint string) bool {
+	return Default().IsOptedOut(endpoint)
+}
+
+// Payload redacts the payload of the endpoint by the default policy.
+func Payload(endpoint string, v interface{}) string {
+	return Default().Payload(endpoint, v)
+}
+
+// Field redacts the value of the field by the default policy.
+func Field(name string, value string) string {
+	return Default().Field(name, value)
+}
+
+// Args redacts the arguments of the endpoint by the default policy.
+func Args(endpoint string, args []string) []string {
+	return Default().Args(endpoint, args)
+}
+
+// IsOptedOut returns true when the payloads of the endpoint are not recorded.
+func (p *Policy) IsOptedOut(endpoint string) bool {
+	return p.load().isOptedOut(endpoint)
+}
+
+// Payload returns the redacted json of the payload of the endpoint, which is OptedOut
+// when the endpoint is opted out. The json payload, e.g. a request or a []byte
+// message, has its denied fields masked and its PII fields hashed at any depth,
+// and the other payloads are recorded as they are. The result is truncated to
+// the max payload bytes.
+func (p *Policy) Payload(endpoint string, v interface{}) string {
+	return p.load().payload(endpoint, v)
+}
+
+// Field returns the masked or hashed value of the denied or PII field, and the
+// truncated value of the other fields.
+func (p *Policy) Field(name string, value string) string {
+	return p.load().field(name, value)
+}
+
+// Args returns the redacted arguments of the endpoint, e.g. a redis command, which
+// are positional. The argument following a denied or PII field name is redacted
+// as the value of the field, e.g. the value of HSET key password value. The total
+// bytes of the arguments are limited to the max payload bytes.
+func (p *Policy) Args(endpoint string, args []string) []string {
+	return p.load().args(endpoint, args)
+}
+
+// load ...
+func (p *Policy) load() *rules {
+	return p.rules.Load().(*rules)
+}
+
+// isOptedOut ...
+func (r *rules) isOptedOut(endpoint string) bool {
+	endpoint = strings.ToLower(endpoint)
+	for _, pattern := range r.optOut {
+		if ok, _ := path.Match(pattern, endpoint); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// payload ...
+func (r *rules) payload(endpoint string, v interface{}) string {
+	if r.isOptedOut(endpoint) {
+		return OptedOut
+	}
+
+	var data []byte
+	switch b := v.(type) {
+	case []byte:
+		data = b
+	case string:
+		data = []byte(b)
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return r.truncate(fmt.Sprintf("%v", v))
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil || decoder.More() {
+		return r.truncate(string(data))
+	}
+	if redacted, err := json.Marshal(r.redact(raw)); err == nil {
+		data = redacted
+	}
+	return r.truncate(string(data))
+}
+
+// field ...
+func (r *rules) field(name string, value string) string {
+	key := normalize(name)
+	switch {
+	case r.isDenied(key):
+		return Mask
+	case r.hashFields[key]:
+		return r.hash(value)
+	}
+	return r.truncate(value)
+}
+
+// args ...
+func (r *rules) args(endpoint string, args []string) []string {
+	if r.isOptedOut(endpoint) {
+		return []string{OptedOut}
+	}
+
+	redacted := make([]string, 0, len(args))
+	size := 0
+	for i, arg := range args {
+		if i > 0 {
+			arg = r.field(args[i-1], arg)
+		}
+		if size += len(arg); size > r.maxPayloadBytes {
+			redacted = append(redacted, fmt.Sprintf("...(%d args truncated)", len(args)-i))
+			break
+		}
+		redacted = append(redacted, arg)
+	}
+	return redacted
+}
+
+// redact masks and hashes the fields of the decoded json value in place.
+func (r *rules) redact(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range val {
+			key := normalize(k)
+			switch {
+			case r.isDenied(key):
+				val[k] = Mask
+			case r.hashFields[key]:
+				val[k] = r.hash(jsonString(fv))
+			default:
+				val[k] = r.redact(fv)
+			}
+		}
+	case []interface{}:
+		for i, ev := range val {
+			val[i] = r.redact(ev)
+		}
+	}
+	return v
+}
+
+// isDenied returns true when the normalized field name contains a denied name,
+// e.g. accesstoken contains token.
+func (r *rules) isDenied(key string) bool {
+	if key == "" {
+		return false
+	}
+	for denied := range r.denyFields {
+		if strings.Contains(key, denied) {
+			return true
+		}
+	}
+	return false
+}
+
+// hash ...
+func (r *rules) hash(value string) string {
+	if len(r.hashKey) > 0 {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(value))
+		return _HashPrefix + hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256([]byte(value))
+	return _HashPrefix + hex.EncodeToString(sum[:])
+}
+
+// truncate ...
+func (r *rules) truncate(s string) string {
+	if len(s) <= r.maxPayloadBytes {
+		return s
+	}
+	// don't split the multi-byte character.
+	n := r.maxPayloadBytes
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", s[:n], len(s)-n)
+}
+
+// jsonString returns the string of the json value, the non-string values are
+// encoded as json.
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// fieldSet returns the set of the normalized field names, which are the defaults
+// when names is nil.
+func fieldSet(names []string, defaults []string) map[string]bool {
+	if names == nil {
+		names = defaults
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if key := normalize(name); key != "" {
+			set[key] = true
+		}
+	}
+	return set
+}
+
+// normalize lowers the field name and removes its underscores and hyphens.
+func normalize(name string) string {
+	return fieldReplacer.Replace(strings.ToLower(name))
+}
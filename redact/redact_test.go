@@ -0,0 +1,138 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// sha returns the hashed value of the policy without the hash key.
+func sha(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return _HashPrefix + hex.EncodeToString(sum[:])
+}
+
+// hmacSha returns the hashed value of the policy with the hash key.
+func hmacSha(key, value string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(value))
+	return _HashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestPayload(t *testing.T) {
+	def := NewPolicy(config.Redaction{})
+	hashed := NewPolicy(config.Redaction{HashFields: []string{"email"}})
+	keyed := NewPolicy(config.Redaction{HashFields: []string{"email"}, HashKey: "key"})
+	custom := NewPolicy(config.Redaction{DenyFields: []string{"card_no"}, OptOut: []string{}})
+	short := NewPolicy(config.Redaction{MaxPayloadBytes: 16})
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		endpoint string
+		payload  interface{}
+		want     string
+	}{
+		{name: "default deny fields", policy: def, payload: `{"name":"bob","password":"p","secret":"s","token":"t","authorization":"a"}`,
+			want: `{"authorization":"******","name":"bob","password":"******","secret":"******","token":"******"}`},
+		{name: "contained and normalized names", policy: def, payload: `{"accessToken":"t","client-secret":"s","Pass_Word":"p"}`,
+			want: `{"Pass_Word":"******","accessToken":"******","client-secret":"******"}`},
+		{name: "nested", policy: def, payload: `{"user":{"password":"p"},"items":[{"token":"t"},1]}`,
+			want: `{"items":[{"token":"******"},1],"user":{"password":"******"}}`},
+		{name: "denied object", policy: def, payload: `{"secret":{"a":1}}`, want: `{"secret":"******"}`},
+		{name: "bytes", policy: def, payload: []byte(`{"password":"p"}`), want: `{"password":"******"}`},
+		{name: "struct", policy: def, payload: struct {
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		}{"bob", "p"}, want: `{"name":"bob","password":"******"}`},
+		{name: "numbers are kept", policy: def, payload: `{"id":12345678901234567890}`, want: `{"id":12345678901234567890}`},
+		{name: "not json", policy: def, payload: "password=p", want: "password=p"},
+		{name: "multiple json values", policy: def, payload: `{"password":"p"} {}`, want: `{"password":"p"} {}`},
+		{name: "not marshalable", policy: def, payload: math.Inf(1), want: "+Inf"},
+		{name: "hashed", policy: hashed, payload: `{"email":"a@b.com","password":"p"}`,
+			want: `{"email":"` + sha("a@b.com") + `","password":"******"}`},
+		{name: "hashed non-string", policy: hashed, payload: `{"email":["a"]}`, want: `{"email":"` + sha(`["a"]`) + `"}`},
+		{name: "hashed by key", policy: keyed, payload: `{"email":"a@b.com"}`, want: `{"email":"` + hmacSha("key", "a@b.com") + `"}`},
+		{name: "default opt out", policy: def, endpoint: "svc.UserCollection.List", payload: `{"a":1}`, want: OptedOut},
+		{name: "opt out is case insensitive", policy: def, endpoint: "kafka:COLLECTION", payload: `{"a":1}`, want: OptedOut},
+		{name: "custom deny fields", policy: custom, endpoint: "svc.UserCollection.List", payload: `{"cardNo":"1","password":"p"}`,
+			want: `{"cardNo":"******","password":"p"}`},
+		{name: "truncated", policy: short, payload: "0123456789abcdefghij", want: "0123456789abcdef...(4 bytes truncated)"},
+		{name: "truncated after redacted", policy: short, payload: `{"password":"p","name":"bob"}`,
+			want: `{"name":"bob","p...(18 bytes truncated)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Payload(tt.endpoint, tt.payload); got != tt.want {
+				t.Errorf("Payload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestField(t *testing.T) {
+	p := NewPolicy(config.Redaction{HashFields: []string{"phone"}, MaxPayloadBytes: 4})
+	tests := []struct {
+		name, field, value, want string
+	}{
+		{"denied", "user_password", "p", Mask},
+		{"hashed", "Phone", "123", sha("123")},
+		{"kept", "name", "bob", "bob"},
+		{"truncated", "name", "bobby", "bobb...(1 bytes truncated)"},
+		{"multi-byte", "name", "abcé", "abc...(2 bytes truncated)"},
+		{"empty name", "", "bob", "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Field(tt.field, tt.value); got != tt.want {
+				t.Errorf("Field(%q, %q) = %s, want %s", tt.field, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgs(t *testing.T) {
+	def := NewPolicy(config.Redaction{})
+	small := NewPolicy(config.Redaction{MaxPayloadBytes: 8})
+	tests := []struct {
+		name     string
+		policy   *Policy
+		endpoint string
+		args     []string
+		want     []string
+	}{
+		{name: "value of denied field", policy: def, args: []string{"key", "name", "bob", "password", "p"},
+			want: []string{"key", "name", "bob", "password", Mask}},
+		{name: "opted out", policy: def, endpoint: "redis:collection:1", args: []string{"key", "password", "p"},
+			want: []string{OptedOut}},
+		{name: "truncated", policy: small, args: []string{"key", "1234", "5678"},
+			want: []string{"key", "1234", "...(1 args truncated)"}},
+		{name: "empty", policy: def, args: nil, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Args(tt.endpoint, tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyUpdate(t *testing.T) {
+	p := NewPolicy(config.Redaction{})
+	if got := p.Field("password", "p"); got != Mask {
+		t.Fatalf("Field(password) = %s, want masked by default", got)
+	}
+	p.Update(config.Redaction{DenyFields: []string{"name"}})
+	if got := p.Field("password", "p"); got != "p" {
+		t.Errorf("Field(password) after update = %s, want kept", got)
+	}
+	if got := p.Field("name", "bob"); got != Mask {
+		t.Errorf("Field(name) after update = %s, want masked", got)
+	}
+}
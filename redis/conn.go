@@ -3,6 +3,8 @@ package redis
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -11,13 +13,29 @@ import (
 	"github.com/shelton-hu/util/idutil"
 
 	"github.com/shelton-hu/pi/config"
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
 )
 
-// rdsPool is the redis pool for client connecting.
-var rdsPool *redis.Pool
+// _DrainDuration is the duration between the old pool replaced and closed when
+// reconnecting, which lets the connections in use be returned.
+const _DrainDuration = 30 * time.Second
 
-// rdsKeyPrefix is the prefix key of redis key-value.
-var rdsKeyPrefix string
+const (
+	// _DialTimeout is the timeout of connecting and writing to redis.
+	_DialTimeout = 5 * time.Second
+
+	// _PingTimeout is the timeout of checking the connection by PING, which
+	// doesn't hang on the unreachable redis.
+	_PingTimeout = 5 * time.Second
+)
+
+// std holds the default pool used by the package level functions.
+var std atomic.Value
+
+func init() {
+	std.Store(new(Pool))
+}
 
 // Redis is a instance for calling most of the package's methods.
 type Redis struct {
@@ -29,48 +47,257 @@ type Redis struct {
 
 	// ctx is used for logger and jeager record.
 	ctx context.Context
+
+	// redaction is the redaction policy of the commands, or nil for the default.
+	redaction *redact.Policy
 }
 
-// ConnectRedis connects to redis.
-func ConnectRedis(ctx context.Context, redisConfig config.Redis) {
-	address := fmt.Sprintf("%s:%d", redisConfig.Host, redisConfig.Port)
-	rdsPool = &redis.Pool{
-		Wait:        true,
-		MaxIdle:     redisConfig.MaxIdle,
-		MaxActive:   redisConfig.MaxActive,
-		IdleTimeout: time.Duration(redisConfig.IdleTimeout) * time.Second,
-		Dial: func() (redis.Conn, error) {
-			conn, err := redis.Dial("tcp", address, redis.DialPassword(redisConfig.Password))
-			if err != nil {
-				logger.Error(ctx, err.Error())
-				return nil, err
-			}
-			return conn, nil
-		},
+// Pool is the redis pool for client connecting.
+type Pool struct {
+	// pool is the redigo pool.
+	pool *redis.Pool
+
+	// keyPrefix is the prefix key of redis key-value.
+	keyPrefix string
+
+	// address is the address of redis.
+	address string
+
+	// mu protects pool, keyPrefix and address.
+	mu sync.RWMutex
+
+	// tracer and redaction are the tracer and the redaction policy of the commands,
+	// the globals are used when they're nil.
+	tracer    tracing.Tracer
+	redaction *redact.Policy
+}
+
+// PoolOptions ...
+type PoolOptions func(*PoolOption)
+
+// PoolOption ...
+type PoolOption struct {
+	tracer    tracing.Tracer
+	redaction *redact.Policy
+}
+
+// SetPoolTracer sets the tracer of the commands, default is the global tracer.
+func SetPoolTracer(tracer tracing.Tracer) PoolOptions {
+	return func(o *PoolOption) {
+		o.tracer = tracer
+	}
+}
+
+// SetPoolRedaction sets the redaction policy of the commands, default is the
+// default policy of the redact package.
+func SetPoolRedaction(policy *redact.Policy) PoolOptions {
+	return func(o *PoolOption) {
+		o.redaction = policy
+	}
+}
+
+// NewPool returns the redis pool with the config after checking the connection
+// by PING. The key prefix is generated when the config doesn't set one.
+func NewPool(ctx context.Context, redisConfig config.Redis, opts ...PoolOptions) (*Pool, error) {
+	o := new(PoolOption)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	keyPrefix := redisConfig.KeyPrefix
+	if keyPrefix == "" {
+		keyPrefix = idutil.Gen8LetterUuid()
+	}
+
+	pool, err := openRedisPool(ctx, redisConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pool{
+		pool:      pool,
+		keyPrefix: keyPrefix,
+		address:   address(redisConfig),
+		tracer:    o.tracer,
+		redaction: o.redaction,
 	}
-	rdsKeyPrefix = redisConfig.KeyPrefix
-	if rdsKeyPrefix == "" {
-		rdsKeyPrefix = idutil.Gen8LetterUuid()
+	pools.add(p)
+	return p, nil
+}
+
+// SetDefault replaces the default pool used by the package level functions.
+func SetDefault(p *Pool) {
+	std.Store(p)
+}
+
+// Default returns the default pool used by the package level functions.
+func Default() *Pool {
+	return std.Load().(*Pool)
+}
+
+// ConnectRedis connects the default pool to redis.
+func ConnectRedis(ctx context.Context, redisConfig config.Redis) error {
+	p, err := NewPool(ctx, redisConfig)
+	if err != nil {
+		return err
 	}
+	SetDefault(p)
+	return nil
+}
+
+// ReconnectRedis reconnects the default pool, see (*Pool).Reconnect.
+func ReconnectRedis(ctx context.Context, redisConfig config.Redis) error {
+	return Default().Reconnect(ctx, redisConfig)
 }
 
 // CloseRedis closes connect to redis.
 func CloseRedis(ctx context.Context) {
-	if rdsPool != nil {
-		if err := rdsPool.Close(); err != nil {
+	Default().Close(ctx)
+}
+
+// GetConnect get a instance from the default redis pool.
+func GetConnect(ctx context.Context) *Redis {
+	return Default().Get(ctx)
+}
+
+// Reconnect replaces the redis pool by a new one with the config after checking
+// the connection by PING, and closes the old one after draining, so the connections
+// in use are returned before it's closed. The pool keeps unchanged when the new one
+// fails. The generated key prefix is kept when the config doesn't set one.
+func (p *Pool) Reconnect(ctx context.Context, redisConfig config.Redis) error {
+	pool, err := openRedisPool(ctx, redisConfig)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	oldPool := p.pool
+	p.pool = pool
+	p.address = address(redisConfig)
+	if redisConfig.KeyPrefix != "" {
+		p.keyPrefix = redisConfig.KeyPrefix
+	}
+	p.mu.Unlock()
+
+	if oldPool != nil {
+		logger.Info(ctx, "redis pool was replaced, close it after %s", _DrainDuration)
+		closeRedisPoolLater(ctx, oldPool)
+	}
+	return nil
+}
+
+// Close closes connect to redis.
+func (p *Pool) Close(ctx context.Context) {
+	pools.remove(p)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.pool != nil {
+		if err := p.pool.Close(); err != nil {
 			logger.Error(ctx, err.Error())
 		}
 	}
 }
 
-// GetConnect get a instance from this redis pool.
-func GetConnect(ctx context.Context) *Redis {
+// Check pings redis.
+func (p *Pool) Check(ctx context.Context) error {
+	p.mu.RLock()
+	pool := p.pool
+	p.mu.RUnlock()
+
+	return ping(ctx, pool)
+}
+
+// Stats returns the address and the stats of the pool.
+func (p *Pool) Stats() (string, redis.PoolStats) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.pool == nil {
+		return p.address, redis.PoolStats{}
+	}
+	return p.address, p.pool.Stats()
+}
+
+// Get get a instance from this redis pool.
+func (p *Pool) Get(ctx context.Context) *Redis {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	r := &Redis{
 		conn: &redis.PubSubConn{
-			Conn: rdsPool.Get(),
+			Conn: p.pool.Get(),
 		},
-		rdsKeyPrefix: rdsKeyPrefix,
-		ctx:          ctx,
+		rdsKeyPrefix: p.keyPrefix,
+		ctx:          tracing.NewContext(ctx, p.tracer),
+		redaction:    p.redaction,
 	}
 	return r
 }
+
+// openRedisPool returns the redis pool with the config after checking the
+// connection by PING.
+func openRedisPool(ctx context.Context, redisConfig config.Redis) (*redis.Pool, error) {
+	pool := newRedisPool(ctx, redisConfig)
+	if err := ping(ctx, pool); err != nil {
+		_ = pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// ping checks the connection of the redis pool by PING within _PingTimeout, or
+// the deadline of ctx when it's earlier.
+func ping(ctx context.Context, pool *redis.Pool) error {
+	ctx, cancel := context.WithTimeout(ctx, _PingTimeout)
+	defer cancel()
+
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_, err = redis.DoWithTimeout(conn, time.Until(deadline), "PING")
+	return err
+}
+
+// closeRedisPoolLater closes the redis pool after draining.
+func closeRedisPoolLater(ctx context.Context, pool *redis.Pool) {
+	time.AfterFunc(_DrainDuration, func() {
+		if err := pool.Close(); err != nil {
+			logger.Error(ctx, err.Error())
+		}
+	})
+}
+
+// newRedisPool ...
+func newRedisPool(ctx context.Context, redisConfig config.Redis) *redis.Pool {
+	address := address(redisConfig)
+	return &redis.Pool{
+		Wait:        true,
+		MaxIdle:     redisConfig.MaxIdle,
+		MaxActive:   redisConfig.MaxActive,
+		IdleTimeout: time.Duration(redisConfig.IdleTimeout) * time.Second,
+		Dial: func() (redis.Conn, error) {
+			// no read timeout, which breaks the blocking commands and the subscriptions.
+			conn, err := redis.Dial("tcp", address,
+				redis.DialPassword(redisConfig.Password),
+				redis.DialConnectTimeout(_DialTimeout),
+				redis.DialWriteTimeout(_DialTimeout),
+			)
+			if err != nil {
+				logger.Error(ctx, err.Error())
+				return nil, err
+			}
+			return conn, nil
+		},
+	}
+}
+
+// address ...
+func address(redisConfig config.Redis) string {
+	return fmt.Sprintf("%s:%d", redisConfig.Host, redisConfig.Port)
+}
@@ -0,0 +1,174 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// listenPong starts the server which replies every command by PONG, and returns
+// its config.
+func listenPong(t *testing.T) config.Redis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					// every command is an array of bulk strings.
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					for i := 0; i < 2*n; i++ {
+						if _, err := r.ReadString('\n'); err != nil {
+							return
+						}
+					}
+					if _, err := conn.Write([]byte("+PONG\r\n")); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	return config.Redis{Host: host, Port: portNum, KeyPrefix: "test"}
+}
+
+// closedAddress returns the config of the address which refuses the connections.
+func closedAddress(t *testing.T) config.Redis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	_ = ln.Close()
+	return config.Redis{Host: addr.IP.String(), Port: addr.Port}
+}
+
+// listenSilent starts the server which accepts the connections but never replies,
+// and returns its config.
+func listenSilent(t *testing.T) config.Redis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+	t.Cleanup(func() {
+		_ = ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return config.Redis{Host: addr.IP.String(), Port: addr.Port}
+}
+
+func TestPingTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := NewPool(ctx, listenSilent(t)); err == nil {
+		t.Fatal("NewPool to the silent server: want error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("NewPool to the silent server took %s, want timed out by the context", elapsed)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+	redisConfig := listenPong(t)
+	p, err := NewPool(ctx, redisConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(ctx)
+	wantAddress, _ := p.Stats()
+
+	if err := p.Reconnect(ctx, closedAddress(t)); err == nil {
+		t.Fatal("Reconnect to the closed address: want error")
+	}
+	if got, _ := p.Stats(); got != wantAddress {
+		t.Errorf("address after failed Reconnect = %s, want %s", got, wantAddress)
+	}
+	if err := p.Check(ctx); err != nil {
+		t.Errorf("Check after failed Reconnect: %s", err)
+	}
+
+	newConfig := listenPong(t)
+	if err := p.Reconnect(ctx, newConfig); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := p.Stats(); got != address(newConfig) {
+		t.Errorf("address after Reconnect = %s, want %s", got, address(newConfig))
+	}
+	if err := p.Check(ctx); err != nil {
+		t.Errorf("Check after Reconnect: %s", err)
+	}
+}
+
+func TestSetDefaultConcurrently(t *testing.T) {
+	ctx := context.Background()
+	p, err := NewPool(ctx, listenPong(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close(ctx)
+	old := Default()
+	defer SetDefault(old)
+
+	// run with -race, the default pool is read while it's replaced.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = Default()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		SetDefault(p)
+	}
+	<-done
+	if Default() != p {
+		t.Error("Default() isn't the pool set by SetDefault")
+	}
+}
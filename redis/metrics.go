@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	_MetricsNamespace = "pi"
+	_MetricsSubsystem = "redis"
+)
+
+var (
+	// commandDuration is the duration of the redis commands.
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "command_duration_seconds",
+		Help:      "The duration of the redis commands.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command"})
+
+	// commandErrors is the number of the failed redis commands, the nil replies
+	// are not counted.
+	commandErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _MetricsNamespace,
+		Subsystem: _MetricsSubsystem,
+		Name:      "command_errors_total",
+		Help:      "The number of the failed redis commands.",
+	}, []string{"command"})
+
+	// pools collects the stats of the open redis pools.
+	pools = newPoolCollector()
+)
+
+func init() {
+	prometheus.MustRegister(commandDuration, commandErrors, pools)
+}
+
+// poolCollector collects the stats of the open redis pools.
+type poolCollector struct {
+	pools map[*Pool]struct{}
+	mu    sync.RWMutex
+
+	active       *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+// newPoolCollector ...
+func newPoolCollector() *poolCollector {
+	labels := []string{"address"}
+	return &poolCollector{
+		pools: make(map[*Pool]struct{}),
+
+		active: prometheus.NewDesc(prometheus.BuildFQName(_MetricsNamespace, _MetricsSubsystem, "pool_active_connections"),
+			"The number of the connections in the pool, including the idle ones.", labels, nil),
+		idle: prometheus.NewDesc(prometheus.BuildFQName(_MetricsNamespace, _MetricsSubsystem, "pool_idle_connections"),
+			"The number of the idle connections in the pool.", labels, nil),
+		waitCount: prometheus.NewDesc(prometheus.BuildFQName(_MetricsNamespace, _MetricsSubsystem, "pool_wait_total"),
+			"The number of the connections waited for.", labels, nil),
+		waitDuration: prometheus.NewDesc(prometheus.BuildFQName(_MetricsNamespace, _MetricsSubsystem, "pool_wait_duration_seconds_total"),
+			"The total time blocked waiting for a new connection.", labels, nil),
+	}
+}
+
+// add ...
+func (c *poolCollector) add(p *Pool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pools[p] = struct{}{}
+}
+
+// remove ...
+func (c *poolCollector) remove(p *Pool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pools, p)
+}
+
+// Describe ...
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+// Collect collects the stats of the pools, which are summed by address, since
+// the pools of multiple pis may connect to the same one.
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	byAddress := make(map[string]redis.PoolStats, len(c.pools))
+	for p := range c.pools {
+		address, stats := p.Stats()
+		sum := byAddress[address]
+		sum.ActiveCount += stats.ActiveCount
+		sum.IdleCount += stats.IdleCount
+		sum.WaitCount += stats.WaitCount
+		sum.WaitDuration += stats.WaitDuration
+		byAddress[address] = sum
+	}
+	c.mu.RUnlock()
+
+	for address, stats := range byAddress {
+		ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(stats.ActiveCount), address)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.IdleCount), address)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), address)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), address)
+	}
+}
+
+// observeCommand records the duration and the error of the redis command.
+func observeCommand(commandName string, seconds float64, err error) {
+	commandDuration.WithLabelValues(commandName).Observe(seconds)
+	if err != nil && err != redis.ErrNil {
+		commandErrors.WithLabelValues(commandName).Inc()
+	}
+}
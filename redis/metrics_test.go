@@ -0,0 +1,65 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPoolCollector(t *testing.T) {
+	ctx := context.Background()
+	redisConfig := listenPong(t)
+
+	// the pools of the same address, e.g. of two pis, are collected as one.
+	for i := 0; i < 2; i++ {
+		p, err := NewPool(ctx, redisConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close(ctx)
+		conn := p.Get(ctx)
+		defer conn.conn.Close()
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(pools); err != nil {
+		t.Fatal(err)
+	}
+	want := `
+# HELP pi_redis_pool_active_connections The number of the connections in the pool, including the idle ones.
+# TYPE pi_redis_pool_active_connections gauge
+pi_redis_pool_active_connections{address="` + address(redisConfig) + `"} 2
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "pi_redis_pool_active_connections"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestObserveCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantError float64
+	}{
+		{name: "ok"},
+		{name: "nil reply", err: redis.ErrNil},
+		{name: "error", err: errors.New("connection refused"), wantError: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command := "TEST_" + strings.ToUpper(strings.Replace(tt.name, " ", "_", -1))
+			observeCommand(command, 0.1, tt.err)
+			if got := testutil.CollectAndCount(commandDuration.WithLabelValues(command).(prometheus.Histogram)); got != 1 {
+				t.Errorf("duration series = %d, want 1", got)
+			}
+			if got := testutil.ToFloat64(commandErrors.WithLabelValues(command)); got != tt.wantError {
+				t.Errorf("errors = %v, want %v", got, tt.wantError)
+			}
+		})
+	}
+}
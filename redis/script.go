@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/shelton-hu/logger"
+
+	"github.com/shelton-hu/pi/tracing"
+)
+
+// Script is the lua script, which is run by EVALSHA and loaded by EVAL when the
+// redis doesn't have it.
+type Script struct {
+	script   *redis.Script
+	keyCount int
+}
+
+// NewScript returns the script of the source with the number of its keys.
+func NewScript(keyCount int, src string) *Script {
+	return &Script{
+		script:   redis.NewScript(keyCount, src),
+		keyCount: keyCount,
+	}
+}
+
+// Eval runs the script with the keys, which are built like the keys of the other
+// commands, and the args.
+func (r *Redis) Eval(s *Script, keys []string, args ...interface{}) (reply interface{}, err error) {
+	// recover panic
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error(r.ctx, "%v", err)
+		}
+	}()
+
+	// close conn
+	defer r.conn.Close()
+
+	if len(keys) != s.keyCount {
+		return nil, errors.New("the numbers of redis script keys mismatch")
+	}
+
+	// start span
+	_, span := tracing.StartSpan(r.ctx, "Redis", tracing.SetSpanKind(tracing.KindClient))
+	defer span.Finish()
+
+	keysAndArgs := make([]interface{}, 0, len(keys)+len(args))
+	for _, key := range keys {
+		keysAndArgs = append(keysAndArgs, r.buildKey(key))
+	}
+	keysAndArgs = append(keysAndArgs, args...)
+
+	// redis do
+	begin := time.Now()
+	reply, err = s.script.Do(r.conn.Conn, keysAndArgs...)
+	observeCommand("EVALSHA", time.Since(begin).Seconds(), err)
+
+	// set span
+	span.SetTag("component", _RedisComponent)
+	span.SetTag("peer.service", _RedisPeerService)
+	var endpoint string
+	if len(keys) > 0 {
+		span.SetTag("key", keys[0])
+		endpoint = _RedisEndpointPrefix + keys[0]
+	}
+	span.LogKV("cmd", append([]string{"EVALSHA", s.script.Hash()}, r.policy().Args(endpoint, r.parseArgs(args...))...))
+	span.LogKV("res", r.policy().Args(endpoint, r.parseArgs(reply)))
+	span.SetError(err)
+
+	return reply, err
+}
@@ -6,13 +6,13 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
-
-	microTracing "github.com/micro/go-plugins/wrapper/trace/opentracing/v2"
-	opentracing "github.com/opentracing/opentracing-go"
-	"github.com/opentracing/opentracing-go/ext"
+	"time"
 
 	"github.com/shelton-hu/logger"
 	"github.com/shelton-hu/util/scrutil"
+
+	"github.com/shelton-hu/pi/redact"
+	"github.com/shelton-hu/pi/tracing"
 )
 
 const (
@@ -23,6 +23,9 @@ const (
 	// _RedisPeerService is used for jeager record's tag, what
 	// is `peer_service=redis`.
 	_RedisPeerService = "redis"
+
+	// _RedisEndpointPrefix is the prefix of the key as the endpoint of the redaction.
+	_RedisEndpointPrefix = "redis:"
 )
 
 // buildKey returns the key with prefix used for redis cmd.
@@ -51,10 +54,7 @@ func (r *Redis) do(commandName string, args ...interface{}) (reply interface{},
 	}
 
 	// start span
-	_, span, err := microTracing.StartSpanFromContext(r.ctx, opentracing.GlobalTracer(), "Redis")
-	if err != nil {
-		return nil, err
-	}
+	_, span := tracing.StartSpan(r.ctx, "Redis", tracing.SetSpanKind(tracing.KindClient))
 	defer span.Finish()
 
 	// get key from args
@@ -74,18 +74,30 @@ func (r *Redis) do(commandName string, args ...interface{}) (reply interface{},
 	}
 
 	// redis do
+	begin := time.Now()
 	reply, err = r.conn.Conn.Do(commandName, args...)
+	observeCommand(commandName, time.Since(begin).Seconds(), err)
 
 	// set span
-	ext.Component.Set(span, _RedisComponent)
-	ext.PeerService.Set(span, _RedisPeerService)
+	span.SetTag("component", _RedisComponent)
+	span.SetTag("peer.service", _RedisPeerService)
 	span.SetTag(logKey, logVal)
-	span.LogKV("cmd", append([]string{commandName}, r.parseArgs(args)...))
-	span.LogKV("res", r.parseArgs(reply))
+	endpoint := _RedisEndpointPrefix + logVal
+	span.LogKV("cmd", append([]string{commandName}, r.policy().Args(endpoint, r.parseArgs(args))...))
+	span.LogKV("res", r.policy().Args(endpoint, r.parseArgs(reply)))
+	span.SetError(err)
 
 	return reply, err
 }
 
+// policy returns the redaction policy of the commands.
+func (r *Redis) policy() *redact.Policy {
+	if r.redaction == nil {
+		return redact.Default()
+	}
+	return r.redaction
+}
+
 // parseArgs ...
 func (r *Redis) parseArgs(args ...interface{}) []string {
 	argStrs := make([]string, 0, len(args))
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+)
+
+// remoteSpanKey is the context key of the extracted opentracing span context.
+type remoteSpanKey struct{}
+
+// openTracer is the tracer backed by opentracing, e.g. jaeger.
+type openTracer struct {
+	tracer opentracing.Tracer
+	closer io.Closer
+}
+
+// NewOpenTracer returns the tracer backed by the opentracing tracer, which is
+// closed by the closer if it's not nil. The spans are also stored in the context
+// as the opentracing spans, so they are shared with the opentracing instrumentation.
+func NewOpenTracer(tracer opentracing.Tracer, closer io.Closer) Tracer {
+	return &openTracer{
+		tracer: tracer,
+		closer: closer,
+	}
+}
+
+// StartSpan ...
+func (t *openTracer) StartSpan(ctx context.Context, name string, opts ...SpanOptions) (context.Context, Span) {
+	o := newSpanOption(opts...)
+
+	var startOpts []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		startOpts = append(startOpts, opentracing.ChildOf(parent.Context()))
+	} else if remote, ok := ctx.Value(remoteSpanKey{}).(opentracing.SpanContext); ok {
+		startOpts = append(startOpts, opentracing.ChildOf(remote))
+	}
+	switch o.kind {
+	case KindServer:
+		startOpts = append(startOpts, ext.SpanKindRPCServer)
+	case KindClient:
+		startOpts = append(startOpts, ext.SpanKindRPCClient)
+	case KindProducer:
+		startOpts = append(startOpts, ext.SpanKindProducer)
+	case KindConsumer:
+		startOpts = append(startOpts, ext.SpanKindConsumer)
+	}
+	for k, v := range o.tags {
+		startOpts = append(startOpts, opentracing.Tag{Key: k, Value: v})
+	}
+
+	sp := t.tracer.StartSpan(name, startOpts...)
+	return opentracing.ContextWithSpan(ctx, sp), &openSpan{sp}
+}
+
+// SpanFromContext ...
+func (t *openTracer) SpanFromContext(ctx context.Context) Span {
+	sp := opentracing.SpanFromContext(ctx)
+	if sp == nil {
+		return nil
+	}
+	return &openSpan{sp}
+}
+
+// Inject ...
+func (t *openTracer) Inject(ctx context.Context, carrier map[string]string) {
+	sp := opentracing.SpanFromContext(ctx)
+	if sp == nil {
+		return
+	}
+	_ = t.tracer.Inject(sp.Context(), opentracing.TextMap, opentracing.TextMapCarrier(carrier))
+}
+
+// Extract ...
+func (t *openTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	remote, err := t.tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier(carrier))
+	if err != nil {
+		return ctx
+	}
+	// the remote span replaces the span in ctx as the parent.
+	ctx = opentracing.ContextWithSpan(ctx, nil)
+	return context.WithValue(ctx, remoteSpanKey{}, remote)
+}
+
+// Close ...
+func (t *openTracer) Close(ctx context.Context) error {
+	if t.closer == nil {
+		return nil
+	}
+	return t.closer.Close()
+}
+
+// openSpan ...
+type openSpan struct {
+	span opentracing.Span
+}
+
+// SetTag ...
+func (s *openSpan) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
+// LogKV ...
+func (s *openSpan) LogKV(keyValues ...interface{}) {
+	s.span.LogKV(keyValues...)
+}
+
+// SetError ...
+func (s *openSpan) SetError(err error) {
+	if err == nil {
+		return
+	}
+	ext.Error.Set(s.span, true)
+	s.span.LogKV("error_msg", err.Error())
+}
+
+// TraceID ...
+func (s *openSpan) TraceID() string {
+	if sc, ok := s.span.Context().(jaeger.SpanContext); ok {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// SpanID ...
+func (s *openSpan) SpanID() string {
+	if sc, ok := s.span.Context().(jaeger.SpanContext); ok {
+		return fmt.Sprintf("%016x", uint64(sc.SpanID()))
+	}
+	return ""
+}
+
+// Finish ...
+func (s *openSpan) Finish() {
+	s.span.Finish()
+}
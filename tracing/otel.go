@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// _OtelScope is the instrumentation scope of the spans.
+const _OtelScope = "github.com/shelton-hu/pi"
+
+// otelTracer is the tracer backed by opentelemetry.
+type otelTracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewOtelTracer returns the tracer backed by the opentelemetry tracer provider,
+// which is shut down when the tracer is closed. The spans are propagated by the
+// w3c trace context and baggage.
+func NewOtelTracer(provider *sdktrace.TracerProvider) Tracer {
+	return &otelTracer{
+		provider: provider,
+		tracer:   provider.Tracer(_OtelScope),
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	}
+}
+
+// NewOtlpTracer returns the opentelemetry tracer which exports the spans to the
+// OTLP collector of the config in batches. The root spans are sampled by the rate
+// of the config, and the child spans follow their parents.
+func NewOtlpTracer(ctx context.Context, tracingConfig config.Tracing) (Tracer, error) {
+	exporter, err := NewOtlpExporter(ctx, tracingConfig.Otlp)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tracingConfig.Rate))),
+		sdktrace.WithResource(serviceResource(tracingConfig.Name)),
+	)
+	return NewOtelTracer(provider), nil
+}
+
+// NewMemoryTracer returns the opentelemetry tracer which samples all the spans and
+// records them in the returned exporter once they are finished, e.g. for tests.
+func NewMemoryTracer(name string) (Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithResource(serviceResource(name)),
+	)
+	return NewOtelTracer(provider), exporter
+}
+
+// serviceResource ...
+func serviceResource(name string) *resource.Resource {
+	return resource.NewSchemaless(attribute.String("service.name", name))
+}
+
+// StartSpan ...
+func (t *otelTracer) StartSpan(ctx context.Context, name string, opts ...SpanOptions) (context.Context, Span) {
+	o := newSpanOption(opts...)
+
+	startOpts := []trace.SpanStartOption{
+		trace.WithSpanKind(otelKind(o.kind)),
+	}
+	if len(o.tags) > 0 {
+		attrs := make([]attribute.KeyValue, 0, len(o.tags))
+		for k, v := range o.tags {
+			attrs = append(attrs, otelAttribute(k, v))
+		}
+		startOpts = append(startOpts, trace.WithAttributes(attrs...))
+	}
+
+	ctx, sp := t.tracer.Start(ctx, name, startOpts...)
+	return ctx, &otelSpan{sp}
+}
+
+// SpanFromContext ...
+func (t *otelTracer) SpanFromContext(ctx context.Context) Span {
+	sp := trace.SpanFromContext(ctx)
+	// the extracted remote span isn't a span of this process.
+	if sc := sp.SpanContext(); !sc.IsValid() || sc.IsRemote() {
+		return nil
+	}
+	return &otelSpan{sp}
+}
+
+// Inject ...
+func (t *otelTracer) Inject(ctx context.Context, carrier map[string]string) {
+	t.propagator.Inject(ctx, propagation.MapCarrier(carrier))
+}
+
+// Extract ...
+func (t *otelTracer) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return t.propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// Close ...
+func (t *otelTracer) Close(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// otelSpan ...
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetTag ...
+func (s *otelSpan) SetTag(key string, value interface{}) {
+	s.span.SetAttributes(otelAttribute(key, value))
+}
+
+// LogKV ...
+func (s *otelSpan) LogKV(keyValues ...interface{}) {
+	attrs := make([]attribute.KeyValue, 0, len(keyValues)/2)
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		attrs = append(attrs, otelAttribute(fmt.Sprint(keyValues[i]), keyValues[i+1]))
+	}
+	s.span.AddEvent("log", trace.WithAttributes(attrs...))
+}
+
+// SetError ...
+func (s *otelSpan) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// TraceID ...
+func (s *otelSpan) TraceID() string {
+	return s.span.SpanContext().TraceID().String()
+}
+
+// SpanID ...
+func (s *otelSpan) SpanID() string {
+	return s.span.SpanContext().SpanID().String()
+}
+
+// Finish ...
+func (s *otelSpan) Finish() {
+	s.span.End()
+}
+
+// otelKind ...
+func otelKind(kind Kind) trace.SpanKind {
+	switch kind {
+	case KindServer:
+		return trace.SpanKindServer
+	case KindClient:
+		return trace.SpanKindClient
+	case KindProducer:
+		return trace.SpanKindProducer
+	case KindConsumer:
+		return trace.SpanKindConsumer
+	}
+	return trace.SpanKindInternal
+}
+
+// otelAttribute converts the tag to the attribute, the values of other types are
+// formatted as strings.
+func otelAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int8:
+		return attribute.Int64(key, int64(v))
+	case int16:
+		return attribute.Int64(key, int64(v))
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case uint8:
+		return attribute.Int64(key, int64(v))
+	case uint16:
+		return attribute.Int64(key, int64(v))
+	case uint32:
+		return attribute.Int64(key, int64(v))
+	case float32:
+		return attribute.Float64(key, float64(v))
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	case fmt.Stringer:
+		return attribute.String(key, v.String())
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
@@ -0,0 +1,402 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+const (
+	// _OtlpTracesPath is the path of the OTLP/HTTP traces api.
+	_OtlpTracesPath = "/v1/traces"
+
+	// _OtlpDefaultTimeout is the default timeout of exporting the spans.
+	_OtlpDefaultTimeout = 10 * time.Second
+
+	// _OtlpInitialBackoff and _OtlpMaxBackoff are the backoff between retrying
+	// the failed exports, which is doubled for each retry.
+	_OtlpInitialBackoff = 1 * time.Second
+	_OtlpMaxBackoff     = 30 * time.Second
+)
+
+// The field numbers of the OTLP trace protobuf messages, see
+// opentelemetry/proto/collector/trace/v1/trace_service.proto and its imports.
+const (
+	_OtlpResourceSpansField = 1 // ExportTraceServiceRequest.resource_spans
+
+	_OtlpResourceField          = 1 // ResourceSpans.resource
+	_OtlpScopeSpansField        = 2 // ResourceSpans.scope_spans
+	_OtlpResourceSchemaURLField = 3 // ResourceSpans.schema_url
+
+	_OtlpResourceAttributesField = 1 // Resource.attributes
+
+	_OtlpScopeField          = 1 // ScopeSpans.scope
+	_OtlpSpansField          = 2 // ScopeSpans.spans
+	_OtlpScopeSchemaURLField = 3 // ScopeSpans.schema_url
+
+	_OtlpScopeNameField    = 1 // InstrumentationScope.name
+	_OtlpScopeVersionField = 2 // InstrumentationScope.version
+
+	_OtlpSpanTraceIDField           = 1  // Span.trace_id
+	_OtlpSpanSpanIDField            = 2  // Span.span_id
+	_OtlpSpanTraceStateField        = 3  // Span.trace_state
+	_OtlpSpanParentSpanIDField      = 4  // Span.parent_span_id
+	_OtlpSpanNameField              = 5  // Span.name
+	_OtlpSpanKindField              = 6  // Span.kind
+	_OtlpSpanStartTimeField         = 7  // Span.start_time_unix_nano
+	_OtlpSpanEndTimeField           = 8  // Span.end_time_unix_nano
+	_OtlpSpanAttributesField        = 9  // Span.attributes
+	_OtlpSpanDroppedAttributesField = 10 // Span.dropped_attributes_count
+	_OtlpSpanEventsField            = 11 // Span.events
+	_OtlpSpanDroppedEventsField     = 12 // Span.dropped_events_count
+	_OtlpSpanLinksField             = 13 // Span.links
+	_OtlpSpanDroppedLinksField      = 14 // Span.dropped_links_count
+	_OtlpSpanStatusField            = 15 // Span.status
+
+	_OtlpEventTimeField              = 1 // Span.Event.time_unix_nano
+	_OtlpEventNameField              = 2 // Span.Event.name
+	_OtlpEventAttributesField        = 3 // Span.Event.attributes
+	_OtlpEventDroppedAttributesField = 4 // Span.Event.dropped_attributes_count
+
+	_OtlpLinkTraceIDField           = 1 // Span.Link.trace_id
+	_OtlpLinkSpanIDField            = 2 // Span.Link.span_id
+	_OtlpLinkTraceStateField        = 3 // Span.Link.trace_state
+	_OtlpLinkAttributesField        = 4 // Span.Link.attributes
+	_OtlpLinkDroppedAttributesField = 5 // Span.Link.dropped_attributes_count
+
+	_OtlpStatusMessageField = 2 // Status.message
+	_OtlpStatusCodeField    = 3 // Status.code
+
+	_OtlpKeyValueKeyField   = 1 // KeyValue.key
+	_OtlpKeyValueValueField = 2 // KeyValue.value
+
+	_OtlpStringValueField = 1 // AnyValue.string_value
+	_OtlpBoolValueField   = 2 // AnyValue.bool_value
+	_OtlpIntValueField    = 3 // AnyValue.int_value
+	_OtlpDoubleValueField = 4 // AnyValue.double_value
+	_OtlpArrayValueField  = 5 // AnyValue.array_value
+
+	_OtlpArrayValuesField = 1 // ArrayValue.values
+)
+
+// The OTLP status codes.
+const (
+	_OtlpStatusUnset = 0
+	_OtlpStatusOk    = 1
+	_OtlpStatusError = 2
+)
+
+// otlpExporter posts the spans to the OTLP/HTTP traces api in the protobuf encoding.
+// The request is encoded by protowire rather than exported by the otlptrace exporter
+// of opentelemetry, whose generated OTLP messages require the newer grpc than the
+// etcd client of go-micro supports.
+type otlpExporter struct {
+	url     string
+	headers map[string]string
+	timeout time.Duration
+	client  *http.Client
+}
+
+// NewOtlpExporter returns the span exporter which posts the spans to the OTLP/HTTP
+// traces api of the collector. The exports failed by the throttling or unavailable
+// collector are retried with the exponential backoff until the context is done.
+func NewOtlpExporter(ctx context.Context, otlpConfig config.Otlp) (sdktrace.SpanExporter, error) {
+	timeout := _OtlpDefaultTimeout
+	if otlpConfig.Timeout > 0 {
+		timeout = time.Duration(otlpConfig.Timeout) * time.Second
+	}
+	return &otlpExporter{
+		url:     strings.TrimSuffix(otlpConfig.Endpoint, "/") + _OtlpTracesPath,
+		headers: otlpConfig.Headers,
+		timeout: timeout,
+		client:  new(http.Client),
+	}, nil
+}
+
+// ExportSpans posts the export request of the spans, and retries it when the
+// collector is throttling or unavailable.
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body := encodeSpans(spans)
+
+	backoff := _OtlpInitialBackoff
+	for {
+		retryAfter, err := e.upload(ctx, body)
+		if err == nil || retryAfter < 0 {
+			return err
+		}
+		if retryAfter == 0 {
+			retryAfter = backoff
+			if backoff *= 2; backoff > _OtlpMaxBackoff {
+				backoff = _OtlpMaxBackoff
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s, and gave up retrying: %s", err, ctx.Err())
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// Shutdown ...
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// upload posts the body once, and returns the duration to wait before retrying
+// the failed export, which is 0 for the backoff and negative when it must not be
+// retried.
+func (e *otlpExporter) upload(ctx context.Context, body []byte) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		// the network errors are retriable.
+		return 0, err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 == 2 {
+		return 0, nil
+	}
+
+	err = fmt.Errorf("export spans to %s: %s, %s", e.url, resp.Status, msg)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After")); seconds > 0 {
+			return time.Duration(seconds) * time.Second, err
+		}
+		return 0, err
+	}
+	return -1, err
+}
+
+// encodeSpans returns the ExportTraceServiceRequest of the spans, which are grouped
+// by their resources and instrumentation scopes in the order of the spans.
+func encodeSpans(spans []sdktrace.ReadOnlySpan) []byte {
+	type scopeSpans struct {
+		scope instrumentation.Scope
+		spans []byte
+	}
+	type resourceSpans struct {
+		resource *resource.Resource
+		scopes   []*scopeSpans
+		index    map[instrumentation.Scope]*scopeSpans
+	}
+
+	var resources []*resourceSpans
+	index := make(map[attribute.Distinct]*resourceSpans)
+	for _, s := range spans {
+		rs, ok := index[s.Resource().Equivalent()]
+		if !ok {
+			rs = &resourceSpans{
+				resource: s.Resource(),
+				index:    make(map[instrumentation.Scope]*scopeSpans),
+			}
+			index[s.Resource().Equivalent()] = rs
+			resources = append(resources, rs)
+		}
+		ss, ok := rs.index[s.InstrumentationScope()]
+		if !ok {
+			ss = &scopeSpans{scope: s.InstrumentationScope()}
+			rs.index[ss.scope] = ss
+			rs.scopes = append(rs.scopes, ss)
+		}
+		ss.spans = appendMessage(ss.spans, _OtlpSpansField, encodeSpan(s))
+	}
+
+	var body []byte
+	for _, rs := range resources {
+		var b []byte
+		b = appendMessage(b, _OtlpResourceField, appendAttributes(nil, _OtlpResourceAttributesField, rs.resource.Attributes()))
+		for _, ss := range rs.scopes {
+			var scope []byte
+			scope = appendString(scope, _OtlpScopeNameField, ss.scope.Name)
+			scope = appendString(scope, _OtlpScopeVersionField, ss.scope.Version)
+
+			sb := appendMessage(nil, _OtlpScopeField, scope)
+			sb = append(sb, ss.spans...)
+			sb = appendString(sb, _OtlpScopeSchemaURLField, ss.scope.SchemaURL)
+			b = appendMessage(b, _OtlpScopeSpansField, sb)
+		}
+		b = appendString(b, _OtlpResourceSchemaURLField, rs.resource.SchemaURL())
+		body = appendMessage(body, _OtlpResourceSpansField, b)
+	}
+	return body
+}
+
+// encodeSpan returns the Span of the span.
+func encodeSpan(s sdktrace.ReadOnlySpan) []byte {
+	sc := s.SpanContext()
+	traceID, spanID := sc.TraceID(), sc.SpanID()
+
+	var b []byte
+	b = appendMessage(b, _OtlpSpanTraceIDField, traceID[:])
+	b = appendMessage(b, _OtlpSpanSpanIDField, spanID[:])
+	b = appendString(b, _OtlpSpanTraceStateField, sc.TraceState().String())
+	if parent := s.Parent(); parent.HasSpanID() {
+		parentID := parent.SpanID()
+		b = appendMessage(b, _OtlpSpanParentSpanIDField, parentID[:])
+	}
+	b = appendString(b, _OtlpSpanNameField, s.Name())
+	// the span kinds of opentelemetry are the same as the OTLP ones.
+	b = appendVarint(b, _OtlpSpanKindField, uint64(s.SpanKind()))
+	b = appendTime(b, _OtlpSpanStartTimeField, s.StartTime())
+	b = appendTime(b, _OtlpSpanEndTimeField, s.EndTime())
+	b = appendAttributes(b, _OtlpSpanAttributesField, s.Attributes())
+	b = appendVarint(b, _OtlpSpanDroppedAttributesField, uint64(s.DroppedAttributes()))
+
+	for _, event := range s.Events() {
+		var eb []byte
+		eb = appendTime(eb, _OtlpEventTimeField, event.Time)
+		eb = appendString(eb, _OtlpEventNameField, event.Name)
+		eb = appendAttributes(eb, _OtlpEventAttributesField, event.Attributes)
+		eb = appendVarint(eb, _OtlpEventDroppedAttributesField, uint64(event.DroppedAttributeCount))
+		b = appendMessage(b, _OtlpSpanEventsField, eb)
+	}
+	b = appendVarint(b, _OtlpSpanDroppedEventsField, uint64(s.DroppedEvents()))
+
+	for _, link := range s.Links() {
+		traceID, spanID := link.SpanContext.TraceID(), link.SpanContext.SpanID()
+		var lb []byte
+		lb = appendMessage(lb, _OtlpLinkTraceIDField, traceID[:])
+		lb = appendMessage(lb, _OtlpLinkSpanIDField, spanID[:])
+		lb = appendString(lb, _OtlpLinkTraceStateField, link.SpanContext.TraceState().String())
+		lb = appendAttributes(lb, _OtlpLinkAttributesField, link.Attributes)
+		lb = appendVarint(lb, _OtlpLinkDroppedAttributesField, uint64(link.DroppedAttributeCount))
+		b = appendMessage(b, _OtlpSpanLinksField, lb)
+	}
+	b = appendVarint(b, _OtlpSpanDroppedLinksField, uint64(s.DroppedLinks()))
+
+	var status []byte
+	status = appendString(status, _OtlpStatusMessageField, s.Status().Description)
+	status = appendVarint(status, _OtlpStatusCodeField, otlpStatusCode(s.Status().Code))
+	return appendMessage(b, _OtlpSpanStatusField, status)
+}
+
+// otlpStatusCode ...
+func otlpStatusCode(code codes.Code) uint64 {
+	switch code {
+	case codes.Ok:
+		return _OtlpStatusOk
+	case codes.Error:
+		return _OtlpStatusError
+	}
+	return _OtlpStatusUnset
+}
+
+// appendAttributes appends the attributes as the KeyValue fields.
+func appendAttributes(b []byte, num protowire.Number, attrs []attribute.KeyValue) []byte {
+	for _, kv := range attrs {
+		kb := appendString(nil, _OtlpKeyValueKeyField, string(kv.Key))
+		kb = appendMessage(kb, _OtlpKeyValueValueField, encodeValue(kv.Value))
+		b = appendMessage(b, num, kb)
+	}
+	return b
+}
+
+// encodeValue returns the AnyValue of the attribute value. The field of the value
+// is always set even if it's the zero value, since it's the field of oneof.
+func encodeValue(v attribute.Value) []byte {
+	var b []byte
+	switch v.Type() {
+	case attribute.BOOL:
+		b = protowire.AppendTag(b, _OtlpBoolValueField, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v.AsBool()))
+	case attribute.INT64:
+		b = protowire.AppendTag(b, _OtlpIntValueField, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v.AsInt64()))
+	case attribute.FLOAT64:
+		b = protowire.AppendTag(b, _OtlpDoubleValueField, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v.AsFloat64()))
+	case attribute.STRING:
+		b = appendMessage(b, _OtlpStringValueField, []byte(v.AsString()))
+	case attribute.BOOLSLICE, attribute.INT64SLICE, attribute.FLOAT64SLICE, attribute.STRINGSLICE:
+		var values []attribute.Value
+		switch v.Type() {
+		case attribute.BOOLSLICE:
+			for _, e := range v.AsBoolSlice() {
+				values = append(values, attribute.BoolValue(e))
+			}
+		case attribute.INT64SLICE:
+			for _, e := range v.AsInt64Slice() {
+				values = append(values, attribute.Int64Value(e))
+			}
+		case attribute.FLOAT64SLICE:
+			for _, e := range v.AsFloat64Slice() {
+				values = append(values, attribute.Float64Value(e))
+			}
+		default:
+			for _, e := range v.AsStringSlice() {
+				values = append(values, attribute.StringValue(e))
+			}
+		}
+		var array []byte
+		for _, e := range values {
+			array = appendMessage(array, _OtlpArrayValuesField, encodeValue(e))
+		}
+		b = appendMessage(b, _OtlpArrayValueField, array)
+	}
+	return b
+}
+
+// appendMessage appends the length-delimited field, e.g. the message or bytes.
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendString appends the string field unless it's empty.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendVarint appends the varint field unless it's 0.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendTime appends the fixed64 field of the unix nanoseconds of the time.
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, uint64(t.UnixNano()))
+}
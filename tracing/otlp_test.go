@@ -0,0 +1,312 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/shelton-hu/pi/config"
+)
+
+// pbMessage is the decoded protobuf message, whose values of the fields are the
+// uint64 of the varint and fixed64 fields, or the []byte of the length-delimited ones.
+type pbMessage map[protowire.Number][]interface{}
+
+// decodeMessage decodes the protobuf message, it returns nil when b is invalid.
+func decodeMessage(b []byte) pbMessage {
+	m := make(pbMessage)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil
+		}
+		b = b[n:]
+		var v interface{}
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			return nil
+		}
+		if n < 0 {
+			return nil
+		}
+		b = b[n:]
+		m[num] = append(m[num], v)
+	}
+	return m
+}
+
+// messages returns the messages of the field.
+func (m pbMessage) messages(num protowire.Number) []pbMessage {
+	var ms []pbMessage
+	for _, v := range m[num] {
+		b, _ := v.([]byte)
+		ms = append(ms, decodeMessage(b))
+	}
+	return ms
+}
+
+// message returns the first message of the field, or the empty one.
+func (m pbMessage) message(num protowire.Number) pbMessage {
+	if ms := m.messages(num); len(ms) > 0 {
+		return ms[0]
+	}
+	return pbMessage{}
+}
+
+// bytes returns the first bytes of the field.
+func (m pbMessage) bytes(num protowire.Number) []byte {
+	if len(m[num]) == 0 {
+		return nil
+	}
+	b, _ := m[num][0].([]byte)
+	return b
+}
+
+// uint returns the first varint or fixed64 of the field.
+func (m pbMessage) uint(num protowire.Number) uint64 {
+	if len(m[num]) == 0 {
+		return 0
+	}
+	v, _ := m[num][0].(uint64)
+	return v
+}
+
+// otlpCollector is the fake OTLP/HTTP collector which replies the statuses in
+// order, and records the requests.
+type otlpCollector struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []pbMessage
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := ioutil.ReadAll(r.Body)
+	body := decodeMessage(data)
+	if body == nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, body)
+	status := http.StatusOK
+	if len(c.statuses) > 0 {
+		status, c.statuses = c.statuses[0], c.statuses[1:]
+	}
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(status)
+}
+
+// testSpans returns the failed child span which links to another span.
+func testSpans() tracetest.SpanStubs {
+	link := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{2},
+		SpanID:  trace.SpanID{2},
+	})
+	return tracetest.SpanStubs{{
+		Name: "span",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: trace.FlagsSampled,
+		}),
+		Parent: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{1},
+			SpanID:  trace.SpanID{3},
+		}),
+		SpanKind:          trace.SpanKindClient,
+		StartTime:         time.Unix(1, 0),
+		EndTime:           time.Unix(2, 0),
+		Attributes:        []attribute.KeyValue{attribute.String("peer", "db")},
+		Events:            []sdktrace.Event{{Name: "retry", Time: time.Unix(1, 500)}},
+		Links:             []sdktrace.Link{{SpanContext: link, DroppedAttributeCount: 1}},
+		Status:            sdktrace.Status{Code: codes.Error, Description: "failed"},
+		DroppedAttributes: 3,
+		DroppedEvents:     4,
+		DroppedLinks:      5,
+		Resource:          serviceResource("test"),
+	}}
+}
+
+func TestOtlpExporter(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{name: "ok", requests: 1},
+		{name: "retry unavailable", statuses: []int{http.StatusServiceUnavailable}, requests: 2},
+		{name: "no retry bad request", statuses: []int{http.StatusBadRequest}, requests: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &otlpCollector{statuses: tt.statuses}
+			srv := httptest.NewServer(collector)
+			defer srv.Close()
+
+			ctx := context.Background()
+			exporter, err := NewOtlpExporter(ctx, config.Otlp{
+				Endpoint: srv.URL + "/",
+				Headers:  map[string]string{"Authorization": "Bearer token"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exporter.Shutdown(ctx)
+
+			err = exporter.ExportSpans(ctx, testSpans().Snapshots())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExportSpans() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			collector.mu.Lock()
+			defer collector.mu.Unlock()
+			if len(collector.requests) != tt.requests {
+				t.Fatalf("requests = %d, want %d", len(collector.requests), tt.requests)
+			}
+			r := collector.requests[0]
+			if r.URL.Path != _OtlpTracesPath {
+				t.Errorf("path = %s, want %s", r.URL.Path, _OtlpTracesPath)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+				t.Errorf("content type = %s", ct)
+			}
+			if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+				t.Errorf("authorization = %s", auth)
+			}
+
+			checkSpans(t, collector.bodies[0])
+		})
+	}
+}
+
+func TestOtlpExporterGivesUpWhenContextDone(t *testing.T) {
+	collector := &otlpCollector{statuses: []int{
+		http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable,
+	}}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	exporter, err := NewOtlpExporter(context.Background(), config.Otlp{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := exporter.ExportSpans(ctx, testSpans().Snapshots()); err == nil {
+		t.Fatal("ExportSpans() error = nil, want the error after giving up")
+	}
+}
+
+// checkSpans checks the ExportTraceServiceRequest of testSpans.
+func checkSpans(t *testing.T, body pbMessage) {
+	t.Helper()
+	resourceSpans := body.messages(_OtlpResourceSpansField)
+	if len(resourceSpans) != 1 {
+		t.Fatalf("resource spans = %d, want 1", len(resourceSpans))
+	}
+	attrs := resourceSpans[0].message(_OtlpResourceField).messages(_OtlpResourceAttributesField)
+	if len(attrs) != 1 || string(attrs[0].bytes(_OtlpKeyValueKeyField)) != "service.name" ||
+		string(attrs[0].message(_OtlpKeyValueValueField).bytes(_OtlpStringValueField)) != "test" {
+		t.Errorf("resource attributes = %v, want service.name", attrs)
+	}
+	scopeSpans := resourceSpans[0].messages(_OtlpScopeSpansField)
+	if len(scopeSpans) != 1 {
+		t.Fatalf("scope spans = %d, want 1", len(scopeSpans))
+	}
+	spans := scopeSpans[0].messages(_OtlpSpansField)
+	if len(spans) != 1 {
+		t.Fatalf("spans = %d, want 1", len(spans))
+	}
+
+	span := spans[0]
+	tests := []struct {
+		field string
+		got   interface{}
+		want  interface{}
+	}{
+		{"trace id", string(span.bytes(_OtlpSpanTraceIDField)), string([]byte{1, 15: 0})},
+		{"span id", string(span.bytes(_OtlpSpanSpanIDField)), string([]byte{1, 7: 0})},
+		{"parent span id", string(span.bytes(_OtlpSpanParentSpanIDField)), string([]byte{3, 7: 0})},
+		{"name", string(span.bytes(_OtlpSpanNameField)), "span"},
+		{"kind", span.uint(_OtlpSpanKindField), uint64(3)},
+		{"start time", span.uint(_OtlpSpanStartTimeField), uint64(time.Second)},
+		{"end time", span.uint(_OtlpSpanEndTimeField), uint64(2 * time.Second)},
+		{"attributes", len(span.messages(_OtlpSpanAttributesField)), 1},
+		{"dropped attributes", span.uint(_OtlpSpanDroppedAttributesField), uint64(3)},
+		{"event name", string(span.message(_OtlpSpanEventsField).bytes(_OtlpEventNameField)), "retry"},
+		{"event time", span.message(_OtlpSpanEventsField).uint(_OtlpEventTimeField), uint64(time.Second + 500)},
+		{"dropped events", span.uint(_OtlpSpanDroppedEventsField), uint64(4)},
+		{"link trace id", string(span.message(_OtlpSpanLinksField).bytes(_OtlpLinkTraceIDField)), string([]byte{2, 15: 0})},
+		{"link dropped attributes", span.message(_OtlpSpanLinksField).uint(_OtlpLinkDroppedAttributesField), uint64(1)},
+		{"dropped links", span.uint(_OtlpSpanDroppedLinksField), uint64(5)},
+		{"status code", span.message(_OtlpSpanStatusField).uint(_OtlpStatusCodeField), uint64(_OtlpStatusError)},
+		{"status message", string(span.message(_OtlpSpanStatusField).bytes(_OtlpStatusMessageField)), "failed"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value attribute.Value
+		field protowire.Number
+		want  interface{}
+	}{
+		{"string", attribute.StringValue("a"), _OtlpStringValueField, "a"},
+		{"empty string", attribute.StringValue(""), _OtlpStringValueField, ""},
+		{"false", attribute.BoolValue(false), _OtlpBoolValueField, uint64(0)},
+		{"true", attribute.BoolValue(true), _OtlpBoolValueField, uint64(1)},
+		{"negative int", attribute.Int64Value(-1), _OtlpIntValueField, uint64(math.MaxUint64)},
+		{"double", attribute.Float64Value(1.5), _OtlpDoubleValueField, math.Float64bits(1.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := decodeMessage(encodeValue(tt.value))
+			if len(m[tt.field]) != 1 {
+				t.Fatalf("value = %v, want field %d set", m, tt.field)
+			}
+			got := m[tt.field][0]
+			if b, ok := got.([]byte); ok {
+				got = string(b)
+			}
+			if got != tt.want {
+				t.Errorf("value = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	array := decodeMessage(encodeValue(attribute.StringSliceValue([]string{"a", "b"}))).
+		message(_OtlpArrayValueField).messages(_OtlpArrayValuesField)
+	if len(array) != 2 || string(array[1].bytes(_OtlpStringValueField)) != "b" {
+		t.Errorf("array value = %v, want [a b]", array)
+	}
+}
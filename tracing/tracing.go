@@ -0,0 +1,198 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+)
+
+// Kind is the kind of the span.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+// Tracer is the tracing backend of the instrumentation, which is backed by jaeger
+// through opentracing or by opentelemetry.
+type Tracer interface {
+	// StartSpan starts the span as the child of the span in ctx, or of the remote
+	// span extracted into ctx, and returns the context with the new span.
+	StartSpan(ctx context.Context, name string, opts ...SpanOptions) (context.Context, Span)
+
+	// SpanFromContext returns the span in ctx, or nil when there is none.
+	SpanFromContext(ctx context.Context) Span
+
+	// Inject injects the span in ctx into the carrier, e.g. the rpc metadata or
+	// the kafka headers.
+	Inject(ctx context.Context, carrier map[string]string)
+
+	// Extract extracts the remote span from the carrier into ctx, which is the
+	// parent of the span started from the returned context.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+
+	// Close flushes the finished spans and closes the tracer.
+	Close(ctx context.Context) error
+}
+
+// Span is a traced operation.
+type Span interface {
+	// SetTag sets the tag of the span, which is an attribute in opentelemetry.
+	SetTag(key string, value interface{})
+
+	// LogKV logs the alternating keys and values to the span, which is an event
+	// in opentelemetry.
+	LogKV(keyValues ...interface{})
+
+	// SetError marks the span as failed by the error.
+	SetError(err error)
+
+	// TraceID returns the hex trace id of the span, or empty when it's unknown.
+	TraceID() string
+
+	// SpanID returns the hex span id of the span, or empty when it's unknown.
+	SpanID() string
+
+	// Finish finishes the span.
+	Finish()
+}
+
+// SpanOptions ...
+type SpanOptions func(*SpanOption)
+
+// SpanOption ...
+type SpanOption struct {
+	kind Kind
+	tags map[string]interface{}
+}
+
+// newSpanOption ...
+func newSpanOption(opts ...SpanOptions) *SpanOption {
+	o := &SpanOption{
+		kind: KindInternal,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// SetSpanKind sets the kind of the span, default is KindInternal.
+func SetSpanKind(kind Kind) SpanOptions {
+	return func(o *SpanOption) {
+		o.kind = kind
+	}
+}
+
+// SetSpanTag sets the tag of the span when it's started.
+func SetSpanTag(key string, value interface{}) SpanOptions {
+	return func(o *SpanOption) {
+		if o.tags == nil {
+			o.tags = make(map[string]interface{})
+		}
+		o.tags[key] = value
+	}
+}
+
+// holder holds the global tracer in the atomic value, whose concrete type must
+// be consistent.
+type holder struct {
+	tracer Tracer
+}
+
+// std holds the global tracer.
+var std atomic.Value
+
+func init() {
+	std.Store(&holder{tracer: noopTracer{}})
+}
+
+// SetGlobal sets the global tracer used by the instrumentation of all the packages.
+func SetGlobal(tracer Tracer) {
+	std.Store(&holder{tracer: tracer})
+}
+
+// Global returns the global tracer, which is a noop one before SetGlobal.
+func Global() Tracer {
+	return std.Load().(*holder).tracer
+}
+
+// tracerKey is the context key of the tracer.
+type tracerKey struct{}
+
+// NewContext returns the context carrying the tracer, which is used instead of the
+// global tracer by the package level functions, so the spans of a pi which isn't
+// the global one are recorded by its own tracer. ctx is returned when tracer is nil.
+func NewContext(ctx context.Context, tracer Tracer) context.Context {
+	if tracer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// FromContext returns the tracer of ctx, or the global tracer when ctx carries none.
+func FromContext(ctx context.Context) Tracer {
+	if ctx != nil {
+		if tracer, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+			return tracer
+		}
+	}
+	return Global()
+}
+
+// NewNoopTracer returns the tracer which records nothing, e.g. the one of a pi
+// whose tracing is disabled.
+func NewNoopTracer() Tracer {
+	return noopTracer{}
+}
+
+// StartSpan starts the span by the tracer of ctx, see FromContext.
+func StartSpan(ctx context.Context, name string, opts ...SpanOptions) (context.Context, Span) {
+	return FromContext(ctx).StartSpan(ctx, name, opts...)
+}
+
+// SpanFromContext returns the span in ctx by the tracer of ctx.
+func SpanFromContext(ctx context.Context) Span {
+	return FromContext(ctx).SpanFromContext(ctx)
+}
+
+// Inject injects the span in ctx into the carrier by the tracer of ctx.
+func Inject(ctx context.Context, carrier map[string]string) {
+	FromContext(ctx).Inject(ctx, carrier)
+}
+
+// Extract extracts the remote span from the carrier by the tracer of ctx. The keys
+// of the carrier are matched case-insensitively, since the rpc metadata and http
+// headers are canonicalized.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	lower := make(map[string]string, len(carrier))
+	for k, v := range carrier {
+		lower[strings.ToLower(k)] = v
+	}
+	return FromContext(ctx).Extract(ctx, lower)
+}
+
+// noopTracer ...
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, name string, opts ...SpanOptions) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+func (noopTracer) SpanFromContext(ctx context.Context) Span                               { return nil }
+func (noopTracer) Inject(ctx context.Context, carrier map[string]string)                  {}
+func (noopTracer) Extract(ctx context.Context, carrier map[string]string) context.Context { return ctx }
+func (noopTracer) Close(ctx context.Context) error                                        { return nil }
+
+// noopSpan ...
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value interface{}) {}
+func (noopSpan) LogKV(keyValues ...interface{})       {}
+func (noopSpan) SetError(err error)                   {}
+func (noopSpan) TraceID() string                      { return "" }
+func (noopSpan) SpanID() string                       { return "" }
+func (noopSpan) Finish()                              {}
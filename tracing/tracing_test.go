@@ -0,0 +1,29 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	tracer, exporter := NewMemoryTracer("test")
+	ctx := NewContext(context.Background(), tracer)
+	if FromContext(ctx) != tracer {
+		t.Error("FromContext() isn't the tracer of the context")
+	}
+	if FromContext(context.Background()) != Global() {
+		t.Error("FromContext() isn't the global tracer without the tracer of the context")
+	}
+	if NewContext(ctx, nil) != ctx {
+		t.Error("NewContext() with the nil tracer changes the context")
+	}
+
+	ctx, span := StartSpan(ctx, "span")
+	if SpanFromContext(ctx) == nil {
+		t.Error("SpanFromContext() = nil, want the span of the tracer of the context")
+	}
+	span.Finish()
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Name != "span" {
+		t.Errorf("spans = %v, want the span recorded by the tracer of the context", spans)
+	}
+}
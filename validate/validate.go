@@ -0,0 +1,163 @@
+package validate
+
+import (
+	stdErrors "errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+// _InvalidRequestMessage is the message of the errors of the invalid requests.
+const _InvalidRequestMessage = "invalid request"
+
+// Validator is the request which validates itself, e.g. the types generated by
+// protoc-gen-validate.
+type Validator interface {
+	Validate() error
+}
+
+// fieldError is the error of a field returned by Validate, e.g. the validation
+// errors generated by protoc-gen-validate.
+type fieldError interface {
+	Field() string
+	Reason() string
+}
+
+// Violation is the violation of a field of the struct validated by Struct.
+type Violation struct {
+	// Field is the json path of the field, e.g. user.emails[0].
+	Field string
+
+	// Tag is the `validate` tag which the field failed on.
+	Tag string
+}
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+// Request validates the request by its Validate method when it's a Validator,
+// or else by its `validate` struct tags, and returns the invalid argument error
+// whose details are the violations keyed by the json paths of the fields.
+func Request(req interface{}) error {
+	if req == nil {
+		return nil
+	}
+	if v, ok := req.(Validator); ok {
+		return ToError(v.Validate())
+	}
+	violations, err := Struct(req)
+	if err != nil {
+		return ToError(err)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	e := piErrors.InvalidArgumentf(_InvalidRequestMessage)
+	for _, v := range violations {
+		e = e.WithDetail(v.Field, "failed on the "+v.Tag+" tag")
+	}
+	return e
+}
+
+// Struct validates v by its `validate` struct tags, and returns the violations of
+// the fields, which are named by the json paths. Nothing is validated when v isn't
+// a struct, and the error is returned when v can't be validated.
+func Struct(v interface{}) ([]*Violation, error) {
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	validateOnce.Do(func() {
+		validate = validator.New()
+		validate.RegisterTagNameFunc(jsonName)
+	})
+	err := validate.Struct(v)
+	if err == nil {
+		return nil, nil
+	}
+	var fieldErrs validator.ValidationErrors
+	if !stdErrors.As(err, &fieldErrs) {
+		return nil, err
+	}
+	return violations(fieldErrs), nil
+}
+
+// violations ...
+func violations(fieldErrs validator.ValidationErrors) []*Violation {
+	vs := make([]*Violation, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		// the namespace starts with the struct type name.
+		field := fieldErr.Namespace()
+		if i := strings.Index(field, "."); i >= 0 {
+			field = field[i+1:]
+		}
+		vs = append(vs, &Violation{Field: field, Tag: fieldErr.Tag()})
+	}
+	return vs
+}
+
+// ToError returns the invalid argument error of the validation error, which is
+// returned as it is when it's a pi error already.
+func ToError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *piErrors.Error
+	if stdErrors.As(err, &e) {
+		return e
+	}
+
+	e = piErrors.InvalidArgumentf(_InvalidRequestMessage)
+	var fieldErrs validator.ValidationErrors
+	if stdErrors.As(err, &fieldErrs) {
+		for _, v := range violations(fieldErrs) {
+			e = e.WithDetail(v.Field, "failed on the "+v.Tag+" tag")
+		}
+		return e
+	}
+
+	errs := []error{err}
+	if multi, ok := err.(interface{ AllErrors() []error }); ok {
+		errs = multi.AllErrors()
+	}
+	for _, err := range errs {
+		field, reason, ok := violation(err)
+		if !ok {
+			// the message of the error which isn't of a field.
+			return piErrors.InvalidArgumentf("%s", err.Error())
+		}
+		e = e.WithDetail(field, reason)
+	}
+	return e
+}
+
+// violation returns the json path and the reason of the field error, whose cause
+// may be the error of the nested field.
+func violation(err error) (string, string, bool) {
+	fe, ok := err.(fieldError)
+	if !ok {
+		return "", "", false
+	}
+	field, reason := fe.Field(), fe.Reason()
+	if cause, ok := err.(interface{ Cause() error }); ok && cause.Cause() != nil {
+		if nested, nestedReason, ok := violation(cause.Cause()); ok {
+			return field + "." + nested, nestedReason, true
+		}
+	}
+	return field, reason, true
+}
+
+// jsonName ...
+func jsonName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
@@ -0,0 +1,109 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	piErrors "github.com/shelton-hu/pi/errors"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type user struct {
+	Name      string     `json:"name" validate:"required"`
+	Age       int        `json:"age,omitempty" validate:"gte=0,lte=150"`
+	Emails    []string   `json:"emails" validate:"dive,email"`
+	Address   address    `json:"address"`
+	Addresses []*address `json:"addresses" validate:"dive"`
+	Note      string     `validate:"max=3"`
+}
+
+// selfValidated is the request which validates itself.
+type selfValidated struct {
+	err error
+}
+
+func (r *selfValidated) Validate() error {
+	return r.err
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want []*Violation
+	}{
+		{name: "not struct", v: "x"},
+		{name: "valid", v: &user{Name: "a", Address: address{City: "b"}}},
+		{
+			name: "invalid",
+			v: user{
+				Age:       200,
+				Emails:    []string{"a@b.com", "x"},
+				Addresses: []*address{{City: "c"}, {}},
+				Note:      "long",
+			},
+			want: []*Violation{
+				{Field: "name", Tag: "required"},
+				{Field: "age", Tag: "lte"},
+				{Field: "emails[1]", Tag: "email"},
+				{Field: "address.city", Tag: "required"},
+				{Field: "addresses[1].city", Tag: "required"},
+				{Field: "Note", Tag: "max"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Struct(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				for _, v := range got {
+					t.Logf("got %+v", v)
+				}
+				t.Errorf("Struct violations mismatch")
+			}
+		})
+	}
+}
+
+func TestRequest(t *testing.T) {
+	denied := piErrors.PermissionDeniedf("denied")
+	tests := []struct {
+		name        string
+		req         interface{}
+		wantCode    piErrors.Code
+		wantDetails map[string]string
+	}{
+		{name: "nil", req: nil, wantCode: piErrors.OK},
+		{name: "valid", req: &user{Name: "a", Address: address{City: "b"}}, wantCode: piErrors.OK},
+		{
+			name:        "invalid",
+			req:         &user{Address: address{City: "b"}},
+			wantCode:    piErrors.InvalidArgument,
+			wantDetails: map[string]string{"name": "failed on the required tag"},
+		},
+		{name: "self valid", req: &selfValidated{}, wantCode: piErrors.OK},
+		{name: "self pi error", req: &selfValidated{err: denied}, wantCode: piErrors.PermissionDenied},
+		{name: "self error", req: &selfValidated{err: errors.New("bad")}, wantCode: piErrors.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Request(tt.req)
+			if code := piErrors.CodeOf(err); code != tt.wantCode {
+				t.Fatalf("Request = %v, want %s", err, tt.wantCode)
+			}
+			if tt.wantDetails != nil && !reflect.DeepEqual(piErrors.FromError(err).Details, tt.wantDetails) {
+				t.Errorf("details = %v, want %v", piErrors.FromError(err).Details, tt.wantDetails)
+			}
+		})
+	}
+}